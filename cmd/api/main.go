@@ -7,6 +7,7 @@ import (
 	"pt-besq-core/internal/handler"
 	"pt-besq-core/internal/middleware"
 	"pt-besq-core/internal/repository"
+	"pt-besq-core/internal/storage"
 	"pt-besq-core/internal/websocket"
 	"time"
 
@@ -32,13 +33,19 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"}, // Change to specific domains in production
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Disposition"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "If-Match"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
-	// 5. Setup WebSocket Hub
+	// 5. Setup File Storage (lihat package storage untuk variabel environment-nya)
+	store, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatalln("❌ FATAL: Gagal menyiapkan storage file:", err)
+	}
+
+	// 5b. Setup WebSocket Hub
 	hub := websocket.NewHub()
 	go hub.Run()
 
@@ -51,6 +58,7 @@ func main() {
 	dashHandler := handler.NewDashboardHandler()
 	auditHandler := handler.NewAuditHandler()
 	notifHandler := handler.NewNotificationHandler(hub)
+	attHandler := handler.NewAttachmentHandler(store)
 
 	// 7. PUBLIC ROUTES (No Authentication Required)
 	public := r.Group("/api")
@@ -111,37 +119,33 @@ func main() {
 		// ============================================
 		// C. TEMPLATES (All Authenticated Users)
 		// ============================================
-		protected.GET("/templates", func(c *gin.Context) {
-			data, err := repository.GetAllTemplates()
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-			c.JSON(http.StatusOK, gin.H{"data": data})
-		})
+		protected.GET("/templates", tmplHandler.GetAll)
+		protected.GET("/templates/:id", tmplHandler.GetByID)
 		protected.GET("/templates/:id/fields", tmplHandler.GetFields)
+		protected.GET("/templates/:id/versions", tmplHandler.GetVersions)
+		protected.GET("/templates/:id/fields/:key/options", tmplHandler.GetFieldOptions)
+		protected.GET("/templates/:id/export", tmplHandler.Export)
+		protected.GET("/templates/:id/approval-policy", tmplHandler.GetApprovalPolicy)
+		protected.GET("/templates/:id/batch-pattern", tmplHandler.GetBatchPattern)
 
 		// ============================================
 		// D. WORKFLOWS (Read Access for All)
 		// ============================================
 		protected.GET("/workflows", wfHandler.GetList)
-		protected.GET("/workflows/:id", func(c *gin.Context) {
-			// Get single workflow details
-			c.JSON(http.StatusOK, gin.H{"message": "Get workflow details"})
-		})
+		protected.GET("/workflows/:id/versions", wfHandler.GetVersions)
+		protected.GET("/workflows/:id", wfHandler.GetByID)
 
 		// ============================================
 		// E. PROCESS INSTANCES (Read Access)
 		// ============================================
 		protected.GET("/instances", insHandler.GetList)
-		protected.GET("/instances/:id", func(c *gin.Context) {
-			// Get instance with full details
-			c.JSON(http.StatusOK, gin.H{"message": "Get instance details"})
-		})
-		protected.GET("/instances/:id/history", func(c *gin.Context) {
-			// Get instance change history
-			c.JSON(http.StatusOK, gin.H{"message": "Get instance history"})
-		})
+		protected.GET("/instances/:id", insHandler.GetByID)
+		protected.GET("/instances/:id/history", insHandler.GetHistory)
+		protected.GET("/instances/:id/signatures/verify", insHandler.VerifySignatures)
+		protected.GET("/instances/:id/genealogy", insHandler.GetGenealogy)
+		protected.GET("/instances/:id/attachments", attHandler.List)
+		protected.GET("/attachments/:id", attHandler.Download)
+		protected.GET("/attachments/:id/preview", attHandler.Preview)
 
 		// ============================================
 		// F. ADMIN ONLY ROUTES
@@ -152,20 +156,19 @@ func main() {
 			// Workflow Management
 			adminOnly.POST("/workflows", wfHandler.Create)
 			adminOnly.PUT("/workflows/:id", wfHandler.UpdateLayout)
+			adminOnly.POST("/workflows/:id/publish", wfHandler.Publish)
 			adminOnly.DELETE("/workflows/:id", func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{"message": "Workflow deleted"})
 			})
 
 			// Template Management
-			adminOnly.POST("/templates", func(c *gin.Context) {
-				c.JSON(http.StatusCreated, gin.H{"message": "Template created"})
-			})
-			adminOnly.PUT("/templates/:id", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Template updated"})
-			})
-			adminOnly.DELETE("/templates/:id", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Template deleted"})
-			})
+			adminOnly.POST("/templates", tmplHandler.Create)
+			adminOnly.POST("/templates/import", tmplHandler.Import)
+			adminOnly.PUT("/templates/:id", tmplHandler.Update)
+			adminOnly.PUT("/templates/:id/approval-policy", tmplHandler.UpdateApprovalPolicy)
+			adminOnly.PUT("/templates/:id/batch-pattern", tmplHandler.UpdateBatchPattern)
+			adminOnly.POST("/templates/:id/batch-pattern/preview", tmplHandler.PreviewBatchPattern)
+			adminOnly.DELETE("/templates/:id", tmplHandler.Delete)
 
 			// User Management
 			adminOnly.GET("/users", func(c *gin.Context) {
@@ -196,15 +199,11 @@ func main() {
 		supervisorRoutes := protected.Group("/")
 		supervisorRoutes.Use(middleware.RequireRoles("admin", "supervisor"))
 		{
-			// Approve/Reject Instances
-			supervisorRoutes.PUT("/instances/:id/approve", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Instance approved"})
-			})
-			supervisorRoutes.PUT("/instances/:id/reject", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Instance rejected"})
-			})
+			// Workflow dry-run
+			supervisorRoutes.POST("/workflows/:id/simulate", wfHandler.Simulate)
 
 			// Reports
+			supervisorRoutes.GET("/instances/:id/recall", insHandler.GetRecallReport)
 			supervisorRoutes.GET("/reports/production", func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{"message": "Production report"})
 			})
@@ -221,20 +220,26 @@ func main() {
 		{
 			// Create & Update Instances
 			writeAccess.POST("/instances", insHandler.CreateInstance)
-			writeAccess.PUT("/instances/:id", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Instance updated"})
-			})
-			writeAccess.PUT("/instances/:id/status", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Status updated"})
-			})
+			writeAccess.PUT("/instances/:id", insHandler.UpdateInstance)
+			writeAccess.PUT("/instances/:id/status", insHandler.UpdateStatus)
+
+			// Genealogy (batch/lot asal yang dipakai instance, split & merge batch)
+			writeAccess.POST("/instances/:id/parents", insHandler.AddParent)
+			writeAccess.DELETE("/instances/:id/parents/:parentId", insHandler.RemoveParent)
+			writeAccess.POST("/instances/:id/split", insHandler.Split)
+			writeAccess.POST("/instances/merge", insHandler.Merge)
+
+			// Approve/Reject Instances (langkah yang boleh ditandatangani ditentukan rantai approval template)
+			writeAccess.PUT("/instances/:id/approve", insHandler.Approve)
+			writeAccess.PUT("/instances/:id/reject", insHandler.Reject)
 
 			// Export Data
 			writeAccess.GET("/instances/export", insHandler.ExportExcel)
 
 			// File Upload (for attachments)
-			writeAccess.POST("/instances/:id/upload", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "File uploaded"})
-			})
+			writeAccess.POST("/instances/:id/upload", attHandler.UploadToInstance)
+			writeAccess.POST("/attachments", attHandler.Upload)
+			writeAccess.DELETE("/attachments/:id", attHandler.Delete)
 		}
 	}
 
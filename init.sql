@@ -67,6 +67,8 @@ CREATE TABLE IF NOT EXISTS `process_templates` (
   `icon` VARCHAR(50),
   `color` VARCHAR(20),
   `estimated_duration` INT COMMENT 'in minutes',
+  `current_version` INT DEFAULT 0 COMMENT 'latest published template_versions.version',
+  `approval_mode` ENUM('ordered', 'parallel') DEFAULT 'ordered' COMMENT 'how template_approval_steps are signed',
   `is_active` TINYINT(1) DEFAULT 1,
   `created_by` INT,
   `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -84,19 +86,74 @@ CREATE TABLE IF NOT EXISTS `field_definitions` (
   `template_id` INT NOT NULL,
   `field_key` VARCHAR(50) NOT NULL,
   `field_label` VARCHAR(100) NOT NULL,
-  `field_type` ENUM('text', 'number', 'date', 'datetime', 'select', 'textarea', 'checkbox', 'file') NOT NULL,
+  `field_type` ENUM('text', 'number', 'date', 'datetime', 'select', 'textarea', 'checkbox', 'file', 'computed') NOT NULL,
   `is_required` TINYINT(1) DEFAULT 0,
   `validation_rule` TEXT COMMENT 'JSON format',
+  `expression` TEXT COMMENT 'Formula for computed fields, e.g. rubber_weight + filler_weight',
+  `show_when` TEXT COMMENT 'Field is shown (and stored) only when true, e.g. mode == ''fast''',
+  `required_when` TEXT COMMENT 'Field is required when true, in addition to is_required',
   `default_value` VARCHAR(255),
   `placeholder` VARCHAR(255),
   `help_text` TEXT,
   `display_order` INT DEFAULT 0,
   `is_active` TINYINT(1) DEFAULT 1,
+  UNIQUE KEY uq_template_field_key (template_id, field_key),
   INDEX idx_template_id (template_id),
   INDEX idx_display_order (display_order),
   FOREIGN KEY (template_id) REFERENCES process_templates(id) ON DELETE CASCADE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- ============================================
+-- 4b. TEMPLATE VERSIONS (immutable field schema snapshots)
+-- ============================================
+CREATE TABLE IF NOT EXISTS `template_versions` (
+  `id` INT AUTO_INCREMENT PRIMARY KEY,
+  `template_id` INT NOT NULL,
+  `version` INT NOT NULL,
+  `fields_snapshot` LONGTEXT NOT NULL COMMENT 'JSON array of field definitions',
+  `created_by` INT,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uq_template_version (template_id, version),
+  FOREIGN KEY (template_id) REFERENCES process_templates(id) ON DELETE CASCADE,
+  FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- ============================================
+-- 4c. TEMPLATE APPROVAL STEPS (sign-off chain per template)
+-- ============================================
+CREATE TABLE IF NOT EXISTS `template_approval_steps` (
+  `id` INT AUTO_INCREMENT PRIMARY KEY,
+  `template_id` INT NOT NULL,
+  `step_order` INT NOT NULL,
+  `name` VARCHAR(100) NOT NULL,
+  `role` ENUM('admin', 'operator', 'supervisor', 'viewer') NULL COMMENT 'any user with this role may sign',
+  `user_ids` TEXT NULL COMMENT 'JSON array of users allowed to sign',
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uq_template_step (template_id, step_order),
+  FOREIGN KEY (template_id) REFERENCES process_templates(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- ============================================
+-- 4d. BATCH NUMBER PATTERNS (automatic process_instances.batch_number)
+-- ============================================
+CREATE TABLE IF NOT EXISTS `batch_number_patterns` (
+  `template_id` INT PRIMARY KEY,
+  `pattern` VARCHAR(100) NOT NULL COMMENT 'e.g. MIX-{YYYY}{MM}{DD}-{SEQ:4}',
+  `reset_period` ENUM('never', 'daily', 'monthly', 'yearly') NOT NULL DEFAULT 'daily',
+  `updated_by` INT,
+  `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  FOREIGN KEY (template_id) REFERENCES process_templates(id) ON DELETE CASCADE,
+  FOREIGN KEY (updated_by) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS `batch_number_sequences` (
+  `template_id` INT NOT NULL,
+  `period_key` VARCHAR(10) NOT NULL COMMENT '2026-10-17 (daily), 2026-10 (monthly), 2026 (yearly), all (never)',
+  `last_value` BIGINT NOT NULL,
+  PRIMARY KEY (template_id, period_key),
+  FOREIGN KEY (template_id) REFERENCES process_templates(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
 -- ============================================
 -- 5. WORKFLOWS
 -- ============================================
@@ -104,10 +161,11 @@ CREATE TABLE IF NOT EXISTS `workflows` (
   `id` INT AUTO_INCREMENT PRIMARY KEY,
   `name` VARCHAR(100) NOT NULL,
   `description` TEXT,
-  `canvas_config` LONGTEXT,
-  `version` INT DEFAULT 1,
+  `canvas_config` LONGTEXT COMMENT 'draft canvas being edited',
+  `version` INT DEFAULT 0 COMMENT 'latest published workflow_versions.version (0 = never published)',
   `is_active` TINYINT(1) DEFAULT 1,
-  `is_published` TINYINT(1) DEFAULT 0,
+  `is_published` TINYINT(1) DEFAULT 0 COMMENT '1 when the draft equals the latest published version',
+  `revision` INT NOT NULL DEFAULT 1 COMMENT 'optimistic lock: bumped on every draft canvas save, sent as ETag',
   `created_by` INT,
   `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
   `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
@@ -116,6 +174,21 @@ CREATE TABLE IF NOT EXISTS `workflows` (
   FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- ============================================
+-- 5b. WORKFLOW VERSIONS (immutable published canvas snapshots)
+-- ============================================
+CREATE TABLE IF NOT EXISTS `workflow_versions` (
+  `id` INT AUTO_INCREMENT PRIMARY KEY,
+  `workflow_id` INT NOT NULL,
+  `version` INT NOT NULL,
+  `canvas_snapshot` LONGTEXT NOT NULL,
+  `created_by` INT,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uq_workflow_version (workflow_id, version),
+  FOREIGN KEY (workflow_id) REFERENCES workflows(id) ON DELETE CASCADE,
+  FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
 -- ============================================
 -- 6. PROCESS INSTANCES
 -- ============================================
@@ -123,7 +196,14 @@ CREATE TABLE IF NOT EXISTS `process_instances` (
   `id` BIGINT AUTO_INCREMENT PRIMARY KEY,
   `template_id` INT NOT NULL,
   `workflow_id` INT NOT NULL,
+  `template_version` INT NULL COMMENT 'template_versions.version used to validate data_payload',
+  `workflow_version` INT NULL COMMENT 'workflow_versions.version this instance runs on',
+  `node_id` VARCHAR(64) NULL COMMENT 'workflow canvas node (stage) this instance belongs to',
+  `source_instance_id` BIGINT NULL COMMENT 'previous stage instance that created this one',
+  `root_instance_id` BIGINT NULL COMMENT 'first stage instance of this workflow run (NULL = this is the first)',
   `batch_number` VARCHAR(50) UNIQUE,
+  `quantity` DECIMAL(14,3) NULL COMMENT 'batch size; split/merge allocations are drawn from it',
+  `unit` VARCHAR(20) NULL,
   `data_payload` LONGTEXT,
   `status` ENUM('draft', 'in_progress', 'completed', 'rejected', 'cancelled') DEFAULT 'draft',
   `priority` ENUM('low', 'normal', 'high', 'urgent') DEFAULT 'normal',
@@ -134,6 +214,7 @@ CREATE TABLE IF NOT EXISTS `process_instances` (
   `created_by` INT,
   `approved_by` INT,
   `approved_at` TIMESTAMP NULL,
+  `revision` INT NOT NULL DEFAULT 1 COMMENT 'optimistic lock: bumped on every payload/status change, sent as ETag',
   `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
   `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
   INDEX idx_template_id (template_id),
@@ -142,19 +223,111 @@ CREATE TABLE IF NOT EXISTS `process_instances` (
   INDEX idx_batch_number (batch_number),
   INDEX idx_created_at (created_at),
   INDEX idx_created_by (created_by),
+  INDEX idx_source_instance (source_instance_id),
+  INDEX idx_root_instance (root_instance_id),
   FOREIGN KEY (template_id) REFERENCES process_templates(id),
   FOREIGN KEY (workflow_id) REFERENCES workflows(id),
+  FOREIGN KEY (source_instance_id) REFERENCES process_instances(id) ON DELETE SET NULL,
+  FOREIGN KEY (root_instance_id) REFERENCES process_instances(id) ON DELETE SET NULL,
   FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
   FOREIGN KEY (approved_by) REFERENCES users(id) ON DELETE SET NULL
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- ============================================
+-- 6b. WORKFLOW JOIN STATES (parallel branches waiting at a join node)
+-- ============================================
+CREATE TABLE IF NOT EXISTS `workflow_join_states` (
+  `id` BIGINT AUTO_INCREMENT PRIMARY KEY,
+  `root_instance_id` BIGINT NOT NULL COMMENT 'workflow run this join belongs to',
+  `workflow_id` INT NOT NULL,
+  `workflow_version` INT NULL,
+  `node_id` VARCHAR(64) NOT NULL COMMENT 'join node in the workflow canvas',
+  `required` INT NOT NULL COMMENT 'inbound branches needed before the join releases',
+  `released_at` TIMESTAMP NULL,
+  `released_by_instance_id` BIGINT NULL,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  INDEX idx_join_run (root_instance_id, node_id),
+  FOREIGN KEY (root_instance_id) REFERENCES process_instances(id) ON DELETE CASCADE,
+  FOREIGN KEY (workflow_id) REFERENCES workflows(id) ON DELETE CASCADE,
+  FOREIGN KEY (released_by_instance_id) REFERENCES process_instances(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS `workflow_join_arrivals` (
+  `join_state_id` BIGINT NOT NULL,
+  `edge_key` VARCHAR(150) NOT NULL COMMENT 'inbound edge of the join node',
+  `instance_id` BIGINT NULL COMMENT 'completed stage instance that arrived',
+  `arrived_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (join_state_id, edge_key),
+  FOREIGN KEY (join_state_id) REFERENCES workflow_join_states(id) ON DELETE CASCADE,
+  FOREIGN KEY (instance_id) REFERENCES process_instances(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- ============================================
+-- 6c. INSTANCE APPROVALS (decisions for the current approval round)
+-- ============================================
+CREATE TABLE IF NOT EXISTS `instance_approvals` (
+  `id` BIGINT AUTO_INCREMENT PRIMARY KEY,
+  `instance_id` BIGINT NOT NULL,
+  `step_id` INT NOT NULL DEFAULT 0 COMMENT 'template_approval_steps.id (0 = default supervisor step)',
+  `step_order` INT NOT NULL,
+  `step_name` VARCHAR(100) NOT NULL,
+  `decision` ENUM('approved', 'rejected') NOT NULL,
+  `decided_by` INT,
+  `comment` TEXT,
+  `decided_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uq_instance_step (instance_id, step_id),
+  FOREIGN KEY (instance_id) REFERENCES process_instances(id) ON DELETE CASCADE,
+  FOREIGN KEY (decided_by) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- ============================================
+-- 6d. ELECTRONIC SIGNATURES (append-only, hash-chained per instance)
+-- ============================================
+CREATE TABLE IF NOT EXISTS `electronic_signatures` (
+  `id` BIGINT AUTO_INCREMENT PRIMARY KEY,
+  `instance_id` BIGINT NOT NULL,
+  `user_id` INT NOT NULL,
+  `username` VARCHAR(50) NOT NULL COMMENT 'signer identity at signing time',
+  `full_name` VARCHAR(100),
+  `meaning` ENUM('reviewed', 'approved', 'rejected') NOT NULL,
+  `decision` ENUM('approved', 'rejected') NOT NULL,
+  `step_name` VARCHAR(100),
+  `comment` TEXT,
+  `payload_hash` CHAR(64) NOT NULL COMMENT 'SHA-256 of data_payload at signing time',
+  `prev_hash` CHAR(64) NOT NULL COMMENT 'record_hash of the previous signature on this instance',
+  `record_hash` CHAR(64) NOT NULL COMMENT 'SHA-256 over all fields above',
+  `signed_at` TIMESTAMP NOT NULL,
+  INDEX idx_instance_id (instance_id),
+  FOREIGN KEY (instance_id) REFERENCES process_instances(id),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- ============================================
+-- 6e. INSTANCE LINKS (batch genealogy: child consumed, split or merged from parent)
+-- ============================================
+CREATE TABLE IF NOT EXISTS `instance_links` (
+  `id` BIGINT AUTO_INCREMENT PRIMARY KEY,
+  `parent_instance_id` BIGINT NOT NULL COMMENT 'input batch / material lot',
+  `child_instance_id` BIGINT NOT NULL COMMENT 'batch made from the parent',
+  `link_type` ENUM('consumed', 'split', 'merged') NOT NULL DEFAULT 'consumed',
+  `quantity` DECIMAL(14,3) NULL COMMENT 'amount of the parent used in the child (required for split/merged)',
+  `unit` VARCHAR(20) NULL,
+  `created_by` INT,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uq_instance_link (parent_instance_id, child_instance_id),
+  INDEX idx_child_instance (child_instance_id),
+  FOREIGN KEY (parent_instance_id) REFERENCES process_instances(id) ON DELETE CASCADE,
+  FOREIGN KEY (child_instance_id) REFERENCES process_instances(id) ON DELETE CASCADE,
+  FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
 -- ============================================
 -- 7. INSTANCE HISTORY
 -- ============================================
 CREATE TABLE IF NOT EXISTS `instance_history` (
   `id` BIGINT AUTO_INCREMENT PRIMARY KEY,
   `instance_id` BIGINT NOT NULL,
-  `action` ENUM('created', 'updated', 'status_changed', 'approved', 'rejected') NOT NULL,
+  `action` ENUM('created', 'updated', 'status_changed', 'approved', 'rejected', 'linked', 'unlinked', 'split', 'merged') NOT NULL,
   `old_value` TEXT,
   `new_value` TEXT,
   `changed_by` INT,
@@ -222,6 +395,20 @@ CREATE TABLE IF NOT EXISTS `file_attachments` (
   FOREIGN KEY (uploaded_by) REFERENCES users(id) ON DELETE SET NULL
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- ============================================
+-- 10b. ATTACHMENT THUMBNAILS (generated on image upload)
+-- ============================================
+CREATE TABLE IF NOT EXISTS `attachment_thumbnails` (
+  `attachment_id` BIGINT NOT NULL,
+  `size` VARCHAR(10) NOT NULL COMMENT 'sm | md',
+  `file_path` VARCHAR(500) NOT NULL COMMENT 'storage key',
+  `mime_type` VARCHAR(100) NOT NULL,
+  `width` INT NOT NULL,
+  `height` INT NOT NULL,
+  PRIMARY KEY (attachment_id, size),
+  FOREIGN KEY (attachment_id) REFERENCES file_attachments(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
 -- ============================================
 -- 11. SCHEDULED REPORTS
 -- ============================================
@@ -283,7 +470,8 @@ INSERT INTO system_settings (setting_key, setting_value, setting_type, descripti
 ('company_name', 'PT Besq Manufacturing', 'string', 'Company name displayed in the system', 1, 1),
 ('max_file_upload_size', '10485760', 'number', 'Maximum file upload size in bytes (10MB)', 0, 1),
 ('session_timeout_minutes', '1440', 'number', 'User session timeout in minutes', 0, 1),
-('enable_notifications', 'true', 'boolean', 'Enable real-time notifications', 0, 1)
+('enable_notifications', 'true', 'boolean', 'Enable real-time notifications', 0, 1),
+('timezone', 'Asia/Jakarta', 'string', 'Factory time zone (IANA name) used for batch number dates and sequence resets', 0, 1)
 ON DUPLICATE KEY UPDATE setting_key=setting_key;
 
 -- Insert sample process instance
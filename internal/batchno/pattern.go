@@ -0,0 +1,323 @@
+// Package batchno menyusun nomor batch dari pola per template, misalnya
+//
+//	MIX-{YYYY}{MM}{DD}-{SEQ:4}  ->  MIX-20261017-0007
+//
+// Token yang dikenal: {YYYY} tahun 4 digit, {YY} tahun 2 digit, {MM} bulan, {DD} tanggal,
+// {SEQ} nomor urut dan {SEQ:n} nomor urut tepat n digit (diisi nol). Setiap pola wajib
+// punya tepat satu token SEQ. Nomor urut direset sesuai periode (harian, bulanan, tahunan
+// atau tidak pernah) sehingga pola harus memuat tanggal yang cukup untuk membedakan periodenya.
+// Tanggal selalu dihitung di zona waktu pabrik (lihat LoadLocation), bukan zona waktu server.
+package batchno
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // image Alpine tidak punya /usr/share/zoneinfo
+	"unicode"
+)
+
+var ErrInvalidPattern = errors.New("invalid batch number pattern")
+
+// Periode reset nomor urut
+const (
+	ResetNever   = "never"
+	ResetDaily   = "daily"
+	ResetMonthly = "monthly"
+	ResetYearly  = "yearly"
+)
+
+// MaxLength adalah panjang maksimal nomor batch (kolom process_instances.batch_number)
+const MaxLength = 50
+
+// maxSeqDigits adalah jumlah digit maksimal nomor urut, termasuk {SEQ} tanpa padding
+const maxSeqDigits = 10
+
+// DefaultTimezone dipakai jika zona waktu pabrik belum diatur
+const DefaultTimezone = "Asia/Jakarta"
+
+// LoadLocation membaca zona waktu IANA (misal "Asia/Jakarta"); nama kosong berarti DefaultTimezone.
+// Data zona waktu ikut di-embed di binary sehingga tidak bergantung pada tzdata sistem.
+func LoadLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = DefaultTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("zona waktu '%s' tidak dikenal: %w", name, err)
+	}
+	return loc, nil
+}
+
+type tokenKind int
+
+const (
+	literal tokenKind = iota
+	year4
+	year2
+	month
+	day
+	seq
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // untuk literal
+	width int    // untuk seq: jumlah digit minimal (0 = tanpa padding)
+}
+
+// Pattern adalah pola nomor batch yang sudah di-parse
+type Pattern struct {
+	Source string
+	Reset  string
+	tokens []token
+}
+
+// Parse memeriksa pola dan periode resetnya
+func Parse(source, reset string) (*Pattern, error) {
+	switch reset {
+	case ResetNever, ResetDaily, ResetMonthly, ResetYearly:
+	default:
+		return nil, fmt.Errorf("%w: reset_period '%s' tidak dikenal (never, daily, monthly, yearly)", ErrInvalidPattern, reset)
+	}
+
+	p := &Pattern{Source: source, Reset: reset}
+	rest := source
+	seqCount := 0
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open != 0 {
+			lit := rest
+			if open > 0 {
+				lit = rest[:open]
+			}
+			if err := checkLiteral(lit); err != nil {
+				return nil, err
+			}
+			p.tokens = append(p.tokens, token{kind: literal, text: lit})
+			rest = rest[len(lit):]
+			continue
+		}
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: '{' tanpa pasangan '}'", ErrInvalidPattern)
+		}
+		tok, err := parseToken(rest[1:end])
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind == seq {
+			seqCount++
+		}
+		p.tokens = append(p.tokens, tok)
+		rest = rest[end+1:]
+	}
+
+	if seqCount != 1 {
+		return nil, fmt.Errorf("%w: pola harus memuat tepat satu {SEQ}", ErrInvalidPattern)
+	}
+	if missing := p.missingDateParts(); missing != "" {
+		return nil, fmt.Errorf("%w: reset %s butuh %s di pola supaya nomor antar periode tidak bentrok", ErrInvalidPattern, reset, missing)
+	}
+	if n := len(p.Format(time.Date(2000, 12, 31, 0, 0, 0, 0, time.UTC), p.MaxSequence())); n > MaxLength {
+		return nil, fmt.Errorf("%w: nomor batch %d karakter, maksimal %d", ErrInvalidPattern, n, MaxLength)
+	}
+	return p, nil
+}
+
+func parseToken(name string) (token, error) {
+	switch name {
+	case "YYYY":
+		return token{kind: year4}, nil
+	case "YY":
+		return token{kind: year2}, nil
+	case "MM":
+		return token{kind: month}, nil
+	case "DD":
+		return token{kind: day}, nil
+	case "SEQ":
+		return token{kind: seq}, nil
+	}
+	if digits, ok := strings.CutPrefix(name, "SEQ:"); ok {
+		width, err := strconv.Atoi(digits)
+		if err != nil || width < 1 || width > maxSeqDigits {
+			return token{}, fmt.Errorf("%w: {SEQ:n} butuh n antara 1 dan %d", ErrInvalidPattern, maxSeqDigits)
+		}
+		return token{kind: seq, width: width}, nil
+	}
+	return token{}, fmt.Errorf("%w: token {%s} tidak dikenal", ErrInvalidPattern, name)
+}
+
+// checkLiteral hanya mengizinkan huruf, angka dan pemisah yang aman dipakai di label/barcode
+func checkLiteral(lit string) error {
+	for _, r := range lit {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case strings.ContainsRune("-_/.", r):
+		default:
+			return fmt.Errorf("%w: karakter '%c' tidak boleh dipakai (gunakan huruf, angka, - _ / .)", ErrInvalidPattern, r)
+		}
+	}
+	return nil
+}
+
+// missingDateParts mengembalikan bagian tanggal yang wajib ada untuk periode reset tetapi tidak ada di pola
+func (p *Pattern) missingDateParts() string {
+	has := map[tokenKind]bool{}
+	for _, t := range p.tokens {
+		has[t.kind] = true
+	}
+	var missing []string
+	if p.Reset != ResetNever && !has[year4] && !has[year2] {
+		missing = append(missing, "{YYYY} atau {YY}")
+	}
+	if (p.Reset == ResetMonthly || p.Reset == ResetDaily) && !has[month] {
+		missing = append(missing, "{MM}")
+	}
+	if p.Reset == ResetDaily && !has[day] {
+		missing = append(missing, "{DD}")
+	}
+	return strings.Join(missing, ", ")
+}
+
+// MaxSequence adalah nomor urut terbesar dalam satu periode: 10^n - 1 untuk {SEQ:n}
+// supaya panjang nomor batch tetap, atau 10 digit untuk {SEQ}
+func (p *Pattern) MaxSequence() int64 {
+	digits := maxSeqDigits
+	for _, t := range p.tokens {
+		if t.kind == seq && t.width > 0 {
+			digits = t.width
+		}
+	}
+	limit := int64(1)
+	for i := 0; i < digits; i++ {
+		limit *= 10
+	}
+	return limit - 1
+}
+
+// PeriodKey adalah kunci nomor urut untuk waktu t; nomor urut mulai dari 1 lagi saat kuncinya berganti
+func (p *Pattern) PeriodKey(t time.Time) string {
+	switch p.Reset {
+	case ResetDaily:
+		return t.Format("2006-01-02")
+	case ResetMonthly:
+		return t.Format("2006-01")
+	case ResetYearly:
+		return t.Format("2006")
+	}
+	return "all"
+}
+
+// Format menyusun nomor batch untuk waktu t dan nomor urut sequence
+func (p *Pattern) Format(t time.Time, sequence int64) string {
+	var b strings.Builder
+	for _, tok := range p.tokens {
+		switch tok.kind {
+		case literal:
+			b.WriteString(tok.text)
+		case year4:
+			b.WriteString(t.Format("2006"))
+		case year2:
+			b.WriteString(t.Format("06"))
+		case month:
+			b.WriteString(t.Format("01"))
+		case day:
+			b.WriteString(t.Format("02"))
+		case seq:
+			fmt.Fprintf(&b, "%0*d", tok.width, sequence)
+		}
+	}
+	return b.String()
+}
+
+// position adalah satu karakter yang bisa dihasilkan pola: literal, digit wajib, atau digit
+// opsional (digit ke-2 dan seterusnya dari {SEQ} tanpa padding)
+type position struct {
+	char     rune // 0 untuk digit
+	optional bool
+}
+
+// positions menjabarkan pola menjadi karakter per karakter. Tanggal dianggap digit bebas
+// sehingga Overlaps bersifat hati-hati: bisa menganggap bentrok pola yang sebenarnya
+// tidak pernah menghasilkan nomor yang sama, tetapi tidak pernah sebaliknya.
+func (p *Pattern) positions() []position {
+	var out []position
+	digits := func(n, optional int) {
+		for i := 0; i < n; i++ {
+			out = append(out, position{})
+		}
+		for i := 0; i < optional; i++ {
+			out = append(out, position{optional: true})
+		}
+	}
+	for _, t := range p.tokens {
+		switch t.kind {
+		case literal:
+			for _, r := range t.text {
+				out = append(out, position{char: unicode.ToLower(r)})
+			}
+		case year4:
+			digits(4, 0)
+		case year2, month, day:
+			digits(2, 0)
+		case seq:
+			if t.width > 0 {
+				digits(t.width, 0)
+			} else {
+				digits(1, maxSeqDigits-1)
+			}
+		}
+	}
+	return out
+}
+
+// Overlaps bernilai true jika ada nomor batch yang bisa dihasilkan kedua pola. Huruf
+// dibandingkan tanpa membedakan besar kecil, sama seperti kolom batch_number di database.
+func (p *Pattern) Overlaps(other *Pattern) bool {
+	a, b := p.positions(), other.positions()
+	type state struct{ i, j int }
+	seen := map[state]bool{}
+	queue := []state{{0, 0}}
+	push := func(s state) {
+		if !seen[s] {
+			seen[s] = true
+			queue = append(queue, s)
+		}
+	}
+	seen[state{0, 0}] = true
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		if s.i == len(a) && s.j == len(b) {
+			return true
+		}
+		// Digit opsional boleh dilewati di salah satu pola
+		if s.i < len(a) && a[s.i].optional {
+			push(state{s.i + 1, s.j})
+		}
+		if s.j < len(b) && b[s.j].optional {
+			push(state{s.i, s.j + 1})
+		}
+		if s.i < len(a) && s.j < len(b) && a[s.i].matches(b[s.j]) {
+			push(state{s.i + 1, s.j + 1})
+		}
+	}
+	return false
+}
+
+// matches bernilai true jika ada satu karakter yang bisa dihasilkan kedua posisi
+func (x position) matches(y position) bool {
+	switch {
+	case x.char == 0 && y.char == 0:
+		return true
+	case x.char == 0:
+		return y.char >= '0' && y.char <= '9'
+	case y.char == 0:
+		return x.char >= '0' && x.char <= '9'
+	}
+	return x.char == y.char
+}
@@ -0,0 +1,185 @@
+package batchno
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		reset   string
+		wantErr string // potongan pesan error; kosong berarti valid
+	}{
+		{"harian lengkap", "MIX-{YYYY}{MM}{DD}-{SEQ:4}", ResetDaily, ""},
+		{"bulanan dengan tahun 2 digit", "OVN/{YY}{MM}/{SEQ:3}", ResetMonthly, ""},
+		{"tahunan", "QC.{YYYY}.{SEQ}", ResetYearly, ""},
+		{"tidak pernah reset tanpa tanggal", "LOT_{SEQ:6}", ResetNever, ""},
+		{"reset tidak dikenal", "A-{SEQ}", "weekly", "reset_period"},
+		{"tanpa SEQ", "MIX-{YYYY}", ResetNever, "tepat satu {SEQ}"},
+		{"dua SEQ", "{SEQ}-{SEQ:2}", ResetNever, "tepat satu {SEQ}"},
+		{"token tidak dikenal", "MIX-{HH}-{SEQ}", ResetNever, "{HH}"},
+		{"kurung tidak ditutup", "MIX-{SEQ", ResetNever, "tanpa pasangan"},
+		{"lebar SEQ nol", "A{SEQ:0}", ResetNever, "antara 1 dan 10"},
+		{"lebar SEQ terlalu besar", "A{SEQ:11}", ResetNever, "antara 1 dan 10"},
+		{"karakter terlarang", "MIX {SEQ}", ResetNever, "karakter ' '"},
+		{"harian tanpa tanggal", "MIX-{YYYY}{MM}-{SEQ}", ResetDaily, "{DD}"},
+		{"bulanan tanpa bulan", "MIX-{YYYY}-{SEQ}", ResetMonthly, "{MM}"},
+		{"tahunan tanpa tahun", "MIX-{MM}-{SEQ}", ResetYearly, "{YYYY} atau {YY}"},
+		// 40 karakter literal + 10 digit SEQ maksimal = 50
+		{"tepat panjang maksimal", strings.Repeat("A", 40) + "{SEQ}", ResetNever, ""},
+		// SEQ:1 hanya 1 digit, tetapi {SEQ} tanpa padding bisa sampai 10 digit
+		{"panjang dengan SEQ maksimal melebihi batas", strings.Repeat("A", 41) + "{SEQ}", ResetNever, "maksimal 50"},
+		{"panjang dengan SEQ:n pas", strings.Repeat("A", 46) + "{SEQ:4}", ResetNever, ""},
+		{"panjang dengan SEQ:n melebihi", strings.Repeat("A", 47) + "{SEQ:4}", ResetNever, "maksimal 50"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.pattern, tt.reset)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Parse(%q) error: %v", tt.pattern, err)
+				}
+				if p.Source != tt.pattern || p.Reset != tt.reset {
+					t.Fatalf("Parse menyimpan %q/%q", p.Source, p.Reset)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidPattern) {
+				t.Fatalf("Parse(%q) err = %v, want ErrInvalidPattern", tt.pattern, err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Parse(%q) err = %q, want memuat %q", tt.pattern, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	at := time.Date(2026, 3, 7, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		pattern string
+		seq     int64
+		want    string
+	}{
+		{"MIX-{YYYY}{MM}{DD}-{SEQ:4}", 7, "MIX-20260307-0007"},
+		{"MIX-{YYYY}{MM}{DD}-{SEQ:4}", 9999, "MIX-20260307-9999"},
+		{"OVN/{YY}{MM}/{SEQ:3}", 42, "OVN/2603/042"},
+		{"QC.{YYYY}.{SEQ}", 123456, "QC.2026.123456"},
+		{"{SEQ:2}-{DD}", 1, "01-07"},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.pattern, ResetNever)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.pattern, err)
+		}
+		if got := p.Format(at, tt.seq); got != tt.want {
+			t.Errorf("Format(%q, %d) = %q, want %q", tt.pattern, tt.seq, got, tt.want)
+		}
+	}
+}
+
+func TestMaxSequence(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    int64
+	}{
+		{"A{SEQ:1}", 9},
+		{"A{SEQ:4}", 9999},
+		{"A{SEQ:10}", 9999999999},
+		{"A{SEQ}", 9999999999},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.pattern, ResetNever)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.pattern, err)
+		}
+		if got := p.MaxSequence(); got != tt.want {
+			t.Errorf("MaxSequence(%q) = %d, want %d", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestPeriodKey(t *testing.T) {
+	jakarta, err := LoadLocation("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2026-12-31 17:30 UTC sudah 2027-01-01 00:30 di Jakarta
+	utc := time.Date(2026, 12, 31, 17, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		pattern string
+		reset   string
+		at      time.Time
+		want    string
+	}{
+		{"A-{YYYY}{MM}{DD}-{SEQ}", ResetDaily, utc, "2026-12-31"},
+		{"A-{YYYY}{MM}{DD}-{SEQ}", ResetDaily, utc.In(jakarta), "2027-01-01"},
+		{"A-{YY}{MM}-{SEQ}", ResetMonthly, utc, "2026-12"},
+		{"A-{YY}{MM}-{SEQ}", ResetMonthly, utc.In(jakarta), "2027-01"},
+		{"A-{YYYY}-{SEQ}", ResetYearly, utc, "2026"},
+		{"A-{YYYY}-{SEQ}", ResetYearly, utc.In(jakarta), "2027"},
+		{"A-{SEQ}", ResetNever, utc, "all"},
+		{"A-{YYYY}-{SEQ}", ResetNever, utc.In(jakarta), "all"},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.pattern, tt.reset)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.pattern, err)
+		}
+		if got := p.PeriodKey(tt.at); got != tt.want {
+			t.Errorf("PeriodKey(%s, %s) = %q, want %q", tt.reset, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	loc, err := LoadLocation("")
+	if err != nil || loc.String() != DefaultTimezone {
+		t.Fatalf("LoadLocation(\"\") = %v, %v", loc, err)
+	}
+	if loc, err := LoadLocation(" Asia/Makassar "); err != nil || loc.String() != "Asia/Makassar" {
+		t.Fatalf("LoadLocation(Asia/Makassar) = %v, %v", loc, err)
+	}
+	if _, err := LoadLocation("Mars/Olympus"); err == nil {
+		t.Fatal("zona waktu tidak dikenal seharusnya error")
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"MIX-{YYYY}-{SEQ:4}", "OVN-{YYYY}-{SEQ:4}", false},
+		{"MIX-{YYYY}-{SEQ:4}", "MIX-{YYYY}-{SEQ:4}", true},
+		{"MIX-{YYYY}-{SEQ:4}", "mix-{YY}{MM}-{SEQ:4}", true},          // huruf tanpa beda besar kecil, YYYY dan YYMM sama-sama 4 digit
+		{"MIX-{YYYY}-{SEQ:4}", "MIX-{YYYY}-{SEQ:5}", false},           // panjang nomor urut berbeda
+		{"B{SEQ}", "B{YYYY}{SEQ}", true},                              // B20261 bisa dari keduanya
+		{"B{SEQ:3}", "B{YYYY}{SEQ}", false},                           // B + 3 digit vs B + minimal 5 digit
+		{"LOT-{SEQ}", "LOT-A{SEQ}", false},                            // huruf tidak pernah cocok dengan digit
+		{"{YYYY}/{SEQ:3}", "20{YY}/{SEQ:3}", true},                    // literal angka bisa cocok dengan tanggal
+		{"QC-{YYYY}{MM}{DD}{SEQ:2}", "QC-{YYYY}{MM}{SEQ:4}", true},    // sama-sama QC- + 10 digit
+		{"QC-{YYYY}{MM}{DD}-{SEQ:2}", "QC-{YYYY}{MM}-{SEQ:4}", false}, // posisi '-' berbeda
+	}
+	for _, tt := range tests {
+		a, err := Parse(tt.a, ResetNever)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.a, err)
+		}
+		b, err := Parse(tt.b, ResetNever)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.b, err)
+		}
+		if got := a.Overlaps(b); got != tt.want {
+			t.Errorf("Overlaps(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.Overlaps(a); got != tt.want {
+			t.Errorf("Overlaps(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
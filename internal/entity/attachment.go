@@ -0,0 +1,30 @@
+package entity
+
+import "time"
+
+// Attachment: File yang diunggah dan (opsional) sudah terikat ke sebuah instance
+type Attachment struct {
+	ID               int64     `db:"id" json:"id"`
+	InstanceID       *int64    `db:"instance_id" json:"instance_id,omitempty"`
+	Filename         string    `db:"filename" json:"filename"`
+	OriginalFilename string    `db:"original_filename" json:"original_filename"`
+	FilePath         string    `db:"file_path" json:"-"`
+	FileSize         int64     `db:"file_size" json:"file_size"`
+	MimeType         string    `db:"mime_type" json:"mime_type"`
+	UploadedBy       *int      `db:"uploaded_by" json:"uploaded_by,omitempty"`
+	UploadedByName   string    `db:"uploaded_by_name" json:"uploaded_by_name"`
+	CreatedAt        time.Time `db:"created_at" json:"created_at"`
+
+	// Thumbnails hanya ada untuk gambar; file lain di-preview dengan ikon generik
+	Thumbnails []AttachmentThumbnail `db:"-" json:"thumbnails"`
+}
+
+// AttachmentThumbnail: Versi kecil sebuah gambar lampiran untuk preview
+type AttachmentThumbnail struct {
+	AttachmentID int64  `db:"attachment_id" json:"-"`
+	Size         string `db:"size" json:"size"`
+	FilePath     string `db:"file_path" json:"-"`
+	MimeType     string `db:"mime_type" json:"mime_type"`
+	Width        int    `db:"width" json:"width"`
+	Height       int    `db:"height" json:"height"`
+}
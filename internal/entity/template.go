@@ -7,11 +7,101 @@ import (
 
 // ProcessTemplate: Cetakan dasar (misal: "Mixing", "Oven")
 type ProcessTemplate struct {
-	ID          int        `json:"id" db:"id"`
-	Name        string     `json:"name" db:"name"`
-	Description string     `json:"description" db:"description"`
-	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
-	Fields      []FieldDef `json:"fields,omitempty"` // Relasi ke definisi kolom
+	ID                int        `json:"id" db:"id"`
+	Name              string     `json:"name" db:"name"`
+	Description       string     `json:"description" db:"description"`
+	Category          string     `json:"category" db:"category"`
+	Icon              string     `json:"icon" db:"icon"`
+	Color             string     `json:"color" db:"color"`
+	EstimatedDuration *int       `json:"estimated_duration,omitempty" db:"estimated_duration"` // menit
+	IsActive          bool       `json:"is_active" db:"is_active"`
+	CreatedBy         *int       `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at" db:"updated_at"`
+	CurrentVersion    int        `json:"current_version" db:"current_version"`
+	Fields            []FieldDef `json:"fields,omitempty"` // Relasi ke definisi kolom
+}
+
+// ApprovalPolicy: Rantai tanda tangan sebelum instance sebuah template dianggap completed.
+// Mode "ordered" ditandatangani berurutan sesuai step_order, "parallel" boleh dalam urutan apa pun.
+type ApprovalPolicy struct {
+	TemplateID int            `json:"template_id"`
+	Mode       string         `json:"mode"`
+	Steps      []ApprovalStep `json:"steps"`
+}
+
+// ApprovalStep: Satu tanda tangan dalam rantai approval, terikat ke role atau user tertentu
+type ApprovalStep struct {
+	ID        int    `json:"id" db:"id"`
+	StepOrder int    `json:"step_order" db:"step_order"`
+	Name      string `json:"name" db:"name"`
+	Role      string `json:"role,omitempty" db:"role"`
+	UserIDs   []int  `json:"user_ids,omitempty" db:"-"`
+}
+
+// BatchNumberPattern: Pola nomor batch otomatis untuk instance sebuah template,
+// misalnya "MIX-{YYYY}{MM}{DD}-{SEQ:4}" dengan nomor urut yang direset setiap hari.
+type BatchNumberPattern struct {
+	TemplateID  int        `json:"template_id" db:"template_id"`
+	Pattern     string     `json:"pattern" db:"pattern"`
+	ResetPeriod string     `json:"reset_period" db:"reset_period"` // never, daily, monthly, yearly
+	UpdatedBy   *int       `json:"updated_by,omitempty" db:"updated_by"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// TemplateVersion: Snapshot immutable dari kolom template saat dipublish.
+// Instance menyimpan nomor versi ini agar data lama selalu dibaca dengan skema aslinya.
+type TemplateVersion struct {
+	ID         int        `json:"id"`
+	TemplateID int        `json:"template_id"`
+	Version    int        `json:"version"`
+	Fields     []FieldDef `json:"fields"`
+	CreatedBy  *int       `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TemplateBundle: Dokumen JSON portabel untuk memindahkan template antar server (test -> produksi).
+// Format bundle punya nomor versi sendiri supaya file lama tetap bisa diimport.
+type TemplateBundle struct {
+	Format        string         `json:"format"`
+	FormatVersion int            `json:"format_version"`
+	ExportedAt    time.Time      `json:"exported_at"`
+	Source        BundleSource   `json:"source"`
+	Template      BundleTemplate `json:"template"`
+}
+
+// BundleSource: Asal template yang diexport (hanya informasi, tidak dipakai saat import)
+type BundleSource struct {
+	TemplateID int `json:"template_id"`
+	Version    int `json:"version"`
+}
+
+// BundleTemplate: Isi template di dalam bundle, tanpa ID dan data audit milik server asal
+type BundleTemplate struct {
+	Name              string        `json:"name"`
+	Key               string        `json:"key"` // kunci portabel dari nama, dipakai untuk mendeteksi template yang sama di server tujuan
+	Description       string        `json:"description,omitempty"`
+	Category          string        `json:"category,omitempty"`
+	Icon              string        `json:"icon,omitempty"`
+	Color             string        `json:"color,omitempty"`
+	EstimatedDuration *int          `json:"estimated_duration,omitempty"`
+	Fields            []BundleField `json:"fields"`
+}
+
+// BundleField: Definisi kolom di dalam bundle (urutan array = display_order)
+type BundleField struct {
+	Key                 string `json:"key"`
+	Label               string `json:"label"`
+	Type                string `json:"type"`
+	IsRequired          bool   `json:"required"`
+	ValidationRule      string `json:"validation,omitempty"`
+	Expression          string `json:"expression,omitempty"`
+	ShowWhen            string `json:"show_when,omitempty"`
+	RequiredWhen        string `json:"required_when,omitempty"`
+	DefaultValue        string `json:"default_value,omitempty"`
+	Placeholder         string `json:"placeholder,omitempty"`
+	HelpText            string `json:"help_text,omitempty"`
+	OptionsFromTemplate string `json:"options_from_template,omitempty"` // template yang dirujuk options_from; template_id-nya dipetakan ulang saat import
 }
 
 // FieldDef: Definisi kolom dinamis agar user bisa edit form sendiri
@@ -23,25 +113,55 @@ type FieldDef struct {
 	Type           string `json:"type" db:"field_type"`   // number, text, date
 	IsRequired     bool   `json:"required" db:"is_required"`
 	ValidationRule string `json:"validation" db:"validation_rule"`
+	Expression     string `json:"expression,omitempty" db:"expression"`       // formula untuk tipe computed
+	ShowWhen       string `json:"show_when,omitempty" db:"show_when"`         // kolom tampil hanya jika kondisi benar
+	RequiredWhen   string `json:"required_when,omitempty" db:"required_when"` // wajib diisi jika kondisi benar
+	DefaultValue   string `json:"default_value" db:"default_value"`
+	Placeholder    string `json:"placeholder" db:"placeholder"`
+	HelpText       string `json:"help_text" db:"help_text"`
+	DisplayOrder   int    `json:"display_order" db:"display_order"`
+	IsActive       bool   `json:"is_active" db:"is_active"`
+}
+
+// WorkflowVersion: Snapshot canvas workflow yang dipublish. Instance berjalan di atas versi ini,
+// jadi mengedit draft tidak mengubah alur instance yang sedang berjalan.
+type WorkflowVersion struct {
+	ID         int             `json:"id" db:"id"`
+	WorkflowID int             `json:"workflow_id" db:"workflow_id"`
+	Version    int             `json:"version" db:"version"`
+	Canvas     json.RawMessage `json:"canvas" db:"canvas_snapshot"`
+	CreatedBy  *int            `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+}
+
+// FieldValue: Satu nilai payload yang sudah dipasangkan dengan label kolomnya
+type FieldValue struct {
+	Key   string      `json:"key"`
+	Label string      `json:"label"`
+	Type  string      `json:"type,omitempty"`
+	Value interface{} `json:"value"`
 }
 
 // ProcessInstance: Data nyata yang diinput operator
 type ProcessInstance struct {
-	ID           int64           `json:"id" db:"id"`
-	TemplateID   int             `json:"template_id" db:"template_id"`
-	WorkflowID   int             `json:"workflow_id" db:"workflow_id"`
-	
+	ID         int64 `json:"id" db:"id"`
+	TemplateID int   `json:"template_id" db:"template_id"`
+	WorkflowID int   `json:"workflow_id" db:"workflow_id"`
+
 	// DataPayload menampung JSON text dari database
-	DataPayload  json.RawMessage `json:"data" db:"data_payload"`
-	
-	Status       string          `json:"status" db:"status"`
-	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+	DataPayload json.RawMessage `json:"data" db:"data_payload"`
+
+	Status    string    `json:"status" db:"status"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
 type Workflow struct {
 	ID           int             `json:"id" db:"id"`
 	Name         string          `json:"name" db:"name"`
-	CanvasConfig json.RawMessage `json:"canvas_config" db:"canvas_config"` // Simpan posisi X,Y node
+	CanvasConfig json.RawMessage `json:"canvas_config" db:"canvas_config"` // Draft canvas (posisi X,Y node)
+	Version      int             `json:"version" db:"version"`             // Versi terakhir yang dipublish (0 = belum pernah)
+	IsPublished  bool            `json:"is_published" db:"is_published"`   // false jika draft punya perubahan yang belum dipublish
 	IsActive     bool            `json:"is_active" db:"is_active"`
+	Revision     int             `json:"revision" db:"revision"` // Naik setiap draft disimpan, dipakai sebagai ETag
 	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
-}
\ No newline at end of file
+}
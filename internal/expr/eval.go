@@ -0,0 +1,304 @@
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+type node interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+	collect(names map[string]bool)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(map[string]interface{}) (interface{}, error) { return n.value, nil }
+func (n *literalNode) collect(map[string]bool)                          {}
+
+type identNode struct {
+	name string
+}
+
+func (n *identNode) eval(vars map[string]interface{}) (interface{}, error) {
+	return normalize(vars[n.name]), nil
+}
+func (n *identNode) collect(names map[string]bool) { names[n.name] = true }
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(vars map[string]interface{}) (interface{}, error) {
+	out := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (n *listNode) collect(names map[string]bool) {
+	for _, item := range n.items {
+		item.collect(names)
+	}
+}
+
+type callNode struct {
+	name string
+	fn   func(args []interface{}) (interface{}, error)
+	args []node
+}
+
+func (n *callNode) eval(vars map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, 0, len(n.args))
+	for _, a := range n.args {
+		v, err := a.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	v, err := n.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", n.name, err)
+	}
+	return v, nil
+}
+
+func (n *callNode) collect(names map[string]bool) {
+	for _, a := range n.args {
+		a.collect(names)
+	}
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(vars map[string]interface{}) (interface{}, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "!":
+		if v == nil {
+			return true, nil
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator 'not' butuh nilai true/false")
+		}
+		return !b, nil
+	case "-":
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("operator '-' butuh angka")
+		}
+		return -f, nil
+	}
+	return nil, fmt.Errorf("operator '%s' tidak dikenal", n.op)
+}
+
+func (n *unaryNode) collect(names map[string]bool) { n.operand.collect(names) }
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) collect(names map[string]bool) {
+	n.left.collect(names)
+	n.right.collect(names)
+}
+
+func (n *binaryNode) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// and/or dievaluasi secara short-circuit
+	switch n.op {
+	case "&&", "||":
+		lb, err := asBool(left, n.op)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "&&" && !lb {
+			return false, nil
+		}
+		if n.op == "||" && lb {
+			return true, nil
+		}
+		right, err := n.right.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		return asBool(right, n.op)
+	}
+
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		list, ok := right.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("operator 'in' butuh daftar, misal [1, 2]")
+		}
+		for _, item := range list {
+			if equal(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "<", "<=", ">", ">=":
+		return compare(n.op, left, right)
+	case "+":
+		if ls, ok := left.(string); ok {
+			if rs, ok := right.(string); ok {
+				return ls + rs, nil
+			}
+		}
+		return arithmetic(n.op, left, right)
+	case "-", "*", "/", "%":
+		return arithmetic(n.op, left, right)
+	}
+	return nil, fmt.Errorf("operator '%s' tidak dikenal", n.op)
+}
+
+func asBool(v interface{}, op string) (bool, error) {
+	switch b := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return b, nil
+	}
+	return false, fmt.Errorf("operator '%s' butuh nilai true/false", op)
+}
+
+func equal(a, b interface{}) bool {
+	switch av := a.(type) {
+	case nil:
+		return b == nil
+	case float64:
+		bv, ok := b.(float64)
+		return ok && av == bv
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	}
+	return false
+}
+
+// compare membandingkan dua angka atau dua string. Nilai kosong (null) selalu menghasilkan false,
+// sehingga "suhu > 180" tidak pernah terpenuhi kalau suhu belum diisi.
+func compare(op string, a, b interface{}) (interface{}, error) {
+	if a == nil || b == nil {
+		return false, nil
+	}
+	if af, ok := a.(float64); ok {
+		bf, ok := b.(float64)
+		if !ok {
+			return nil, fmt.Errorf("tidak bisa membandingkan angka dengan %T", b)
+		}
+		switch op {
+		case "<":
+			return af < bf, nil
+		case "<=":
+			return af <= bf, nil
+		case ">":
+			return af > bf, nil
+		default:
+			return af >= bf, nil
+		}
+	}
+	if as, ok := a.(string); ok {
+		bs, ok := b.(string)
+		if !ok {
+			return nil, fmt.Errorf("tidak bisa membandingkan teks dengan %T", b)
+		}
+		switch op {
+		case "<":
+			return as < bs, nil
+		case "<=":
+			return as <= bs, nil
+		case ">":
+			return as > bs, nil
+		default:
+			return as >= bs, nil
+		}
+	}
+	return nil, fmt.Errorf("operator '%s' butuh angka atau teks", op)
+}
+
+func arithmetic(op string, a, b interface{}) (interface{}, error) {
+	if a == nil || b == nil {
+		return nil, fmt.Errorf("operator '%s' tidak bisa dipakai pada nilai kosong", op)
+	}
+	af, ok1 := a.(float64)
+	bf, ok2 := b.(float64)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("operator '%s' butuh angka", op)
+	}
+	switch op {
+	case "+":
+		return af + bf, nil
+	case "-":
+		return af - bf, nil
+	case "*":
+		return af * bf, nil
+	case "/":
+		if bf == 0 {
+			return nil, fmt.Errorf("pembagian dengan nol")
+		}
+		return af / bf, nil
+	case "%":
+		if bf == 0 {
+			return nil, fmt.Errorf("pembagian dengan nol")
+		}
+		return math.Mod(af, bf), nil
+	}
+	return nil, fmt.Errorf("operator '%s' tidak dikenal", op)
+}
+
+// normalize menyeragamkan tipe angka supaya perbandingan cukup menangani float64
+func normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+		return n.String()
+	case []interface{}:
+		out := make([]interface{}, len(n))
+		for i, item := range n {
+			out[i] = normalize(item)
+		}
+		return out
+	}
+	return v
+}
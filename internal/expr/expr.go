@@ -0,0 +1,71 @@
+// Package expr adalah bahasa ekspresi kecil yang aman untuk aturan form dan workflow.
+//
+// Ekspresi hanya bisa membaca variabel yang diberikan (biasanya isi data_payload),
+// tidak bisa memanggil apa pun di luar daftar fungsi bawaan, dan tidak punya efek samping.
+// Contoh: "curing_time >= 30", "oven_temp > 180 and mode == 'fast'", "round(a * b, 2)".
+package expr
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Expr adalah ekspresi yang sudah di-parse dan siap dievaluasi berulang kali
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse mengubah teks ekspresi menjadi Expr
+func Parse(src string) (*Expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseExpression(1)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("token tidak terduga '%s' di posisi %d", t.text, t.pos)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String mengembalikan teks asli ekspresi
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval menghitung nilai ekspresi. Variabel yang tidak ada dianggap null.
+func (e *Expr) Eval(vars map[string]interface{}) (interface{}, error) {
+	return e.root.eval(vars)
+}
+
+// EvalBool mengevaluasi ekspresi sebagai kondisi. Hasil null dianggap false.
+func (e *Expr) EvalBool(vars map[string]interface{}) (bool, error) {
+	val, err := e.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	switch v := val.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	return false, fmt.Errorf("ekspresi '%s' tidak menghasilkan true/false", e.src)
+}
+
+// Identifiers mengembalikan semua nama variabel yang dipakai (terurut, tanpa duplikat)
+func (e *Expr) Identifiers() []string {
+	seen := map[string]bool{}
+	e.root.collect(seen)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,203 @@
+package expr
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string // teks token tanpa EOF
+	}{
+		{"a>=1.5", []string{"a", ">=", "1.5"}},
+		{"suhu = 180", []string{"suhu", "==", "180"}},
+		{"x AND not y Or z", []string{"x", "&&", "!", "y", "||", "z"}},
+		{"mode in ['a', \"b\"]", []string{"mode", "in", "[", "a", ",", "b", "]"}},
+		{`'it\'s'`, []string{"it's"}},
+		{".5+_x1", []string{".5", "+", "_x1"}},
+		{"suhu_°C", nil}, // '°' bukan huruf
+	}
+	for _, tt := range tests {
+		tokens, err := tokenize(tt.src)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("tokenize(%q) seharusnya error", tt.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("tokenize(%q): %v", tt.src, err)
+			continue
+		}
+		var got []string
+		for _, tok := range tokens[:len(tokens)-1] {
+			got = append(got, tok.text)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		wantErr string
+	}{
+		{"", "berakhir terlalu cepat"},
+		{"a >", "berakhir terlalu cepat"},
+		{"(a > 1", "diharapkan ')'"},
+		{"a b", "token tidak terduga 'b'"},
+		{"[1, 2", "diharapkan ',' atau ']'"},
+		{"exec('rm')", "fungsi 'exec' tidak dikenal"},
+		{"'abc", "string tidak ditutup"},
+		{"1.2.3", "angka tidak valid"},
+		{"a # b", "karakter tidak dikenal '#'"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Parse(%q) err = %v, want memuat %q", tt.src, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	vars := map[string]interface{}{
+		"a":      3.0,
+		"b":      4,
+		"n":      json.Number("2.5"),
+		"mode":   "fast",
+		"tags":   []interface{}{"x", 1},
+		"flag":   true,
+		"kosong": nil,
+	}
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		// prioritas operator
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"20 / 2 / 5", 2.0},
+		{"-2 * 3", -6.0},
+		{"7 % 4 + 1", 4.0},
+		{"a + b > 6 and mode == 'fast'", true},
+		{"true or false and false", true},
+		{"(true or false) and false", false},
+		{"not a > 5", true},
+		{"not flag and true", false},
+		{"not kosong", true},
+		// nilai dan tipe
+		{"b", 4.0},
+		{"n * 2", 5.0},
+		{"mode + '-1'", "fast-1"},
+		{"mode = 'fast'", true},
+		{"mode != 'slow'", true},
+		{"'abc' < 'abd'", true},
+		{"a in [1, 2, 3]", true},
+		{"1 in tags", true},
+		{"'y' in tags", false},
+		{"kosong == null", true},
+		{"kosong > 5", false},
+		{"kosong < 5", false},
+		{"tidak_ada", nil},
+		// fungsi bawaan
+		{"round(a / 7, 2)", 0.43},
+		{"min(a, b, 1)", 1.0},
+		{"max(a, b)", 4.0},
+		{"abs(-a)", 3.0},
+		{"len(mode) + len(tags) + len(kosong)", 6.0},
+		// short-circuit: sisi kanan tidak dievaluasi
+		{"false and 1 / 0 > 1", false},
+		{"true or 1 / 0 > 1", true},
+		{"kosong and mode + 1", false},
+		{"flag or 'teks'", true},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.src, err)
+			continue
+		}
+		got, err := e.Eval(vars)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Eval(%q) = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	vars := map[string]interface{}{"a": 3.0, "mode": "fast", "kosong": nil}
+	tests := []struct {
+		src     string
+		wantErr string
+	}{
+		{"a / 0", "pembagian dengan nol"},
+		{"a % 0", "pembagian dengan nol"},
+		{"a + mode", "butuh angka"},
+		{"kosong + 1", "nilai kosong"},
+		{"a > 'x'", "membandingkan angka"},
+		{"true and a", "butuh nilai true/false"},
+		{"false or 1 / 0 > 1", "pembagian dengan nol"},
+		{"not a", "'not'"},
+		{"-mode", "'-' butuh angka"},
+		{"a in mode", "butuh daftar"},
+		{"round(mode)", "round(): argumen ke-1 harus angka"},
+		{"abs(1, 2)", "jumlah argumen"},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.src, err)
+			continue
+		}
+		_, err = e.Eval(vars)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Eval(%q) err = %v, want memuat %q", tt.src, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEvalBool(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    bool
+		wantErr bool
+	}{
+		{"a > 1", true, false},
+		{"tidak_ada", false, false},
+		{"a + 1", false, true},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.src)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.src, err)
+		}
+		got, err := e.EvalBool(map[string]interface{}{"a": 2.0})
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("EvalBool(%q) = %v, %v", tt.src, got, err)
+		}
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	e, err := Parse("round(b * a, 2) > 5 and mode in [a, 'x'] and not true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Identifiers(), []string{"a", "b", "mode"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Identifiers = %v, want %v", got, want)
+	}
+	if e.String() != "round(b * a, 2) > 5 and mode in [a, 'x'] and not true" {
+		t.Errorf("String = %q", e.String())
+	}
+}
@@ -0,0 +1,81 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+)
+
+// functions adalah daftar fungsi bawaan yang boleh dipanggil dari ekspresi
+var functions = map[string]func(args []interface{}) (interface{}, error){
+	"abs": func(args []interface{}) (interface{}, error) {
+		nums, err := numbers(args, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		return math.Abs(nums[0]), nil
+	},
+	"min": func(args []interface{}) (interface{}, error) {
+		nums, err := numbers(args, 1, -1)
+		if err != nil {
+			return nil, err
+		}
+		result := nums[0]
+		for _, n := range nums[1:] {
+			result = math.Min(result, n)
+		}
+		return result, nil
+	},
+	"max": func(args []interface{}) (interface{}, error) {
+		nums, err := numbers(args, 1, -1)
+		if err != nil {
+			return nil, err
+		}
+		result := nums[0]
+		for _, n := range nums[1:] {
+			result = math.Max(result, n)
+		}
+		return result, nil
+	},
+	"round": func(args []interface{}) (interface{}, error) {
+		nums, err := numbers(args, 1, 2)
+		if err != nil {
+			return nil, err
+		}
+		places := 0.0
+		if len(nums) == 2 {
+			places = nums[1]
+		}
+		pow := math.Pow(10, places)
+		return math.Round(nums[0]*pow) / pow, nil
+	},
+	"len": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("butuh 1 argumen")
+		}
+		switch v := args[0].(type) {
+		case nil:
+			return 0.0, nil
+		case string:
+			return float64(len([]rune(v))), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("argumen harus teks atau daftar")
+	},
+}
+
+// numbers memastikan semua argumen berupa angka dengan jumlah min..max (max -1 = bebas)
+func numbers(args []interface{}, min, max int) ([]float64, error) {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return nil, fmt.Errorf("jumlah argumen tidak sesuai")
+	}
+	out := make([]float64, len(args))
+	for i, a := range args {
+		f, ok := a.(float64)
+		if !ok {
+			return nil, fmt.Errorf("argumen ke-%d harus angka", i+1)
+		}
+		out[i] = f
+	}
+	return out, nil
+}
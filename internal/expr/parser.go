@@ -0,0 +1,165 @@
+package expr
+
+import "fmt"
+
+// Urutan prioritas operator biner (semakin besar semakin kuat mengikat)
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3, "in": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	t := p.next()
+	if t.kind != kind {
+		return fmt.Errorf("diharapkan '%s' di posisi %d", text, t.pos)
+	}
+	return nil
+}
+
+// parseExpression memakai precedence climbing untuk operator biner
+func (p *parser) parseExpression(minPrec int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if t.kind != tokOp {
+			return left, nil
+		}
+		prec, ok := binaryPrecedence[t.text]
+		if !ok || prec < minPrec {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parseExpression(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.peek()
+	if t.kind == tokOp && (t.text == "!" || t.text == "-") {
+		p.next()
+		// "not" mengikat lebih lemah dari perbandingan: not a > 5  ==  not (a > 5)
+		var operand node
+		var err error
+		if t.text == "!" {
+			operand, err = p.parseExpression(binaryPrecedence["=="])
+		} else {
+			operand, err = p.parseUnary()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: t.text, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &literalNode{value: t.num}, nil
+
+	case tokString:
+		return &literalNode{value: t.text}, nil
+
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if p.peek().kind == tokLParen {
+			return p.parseCall(t)
+		}
+		return &identNode{name: t.text}, nil
+
+	case tokLParen:
+		inner, err := p.parseExpression(1)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+
+	case tokLBracket:
+		items, err := p.parseList(tokRBracket, "]")
+		if err != nil {
+			return nil, err
+		}
+		return &listNode{items: items}, nil
+
+	case tokEOF:
+		return nil, fmt.Errorf("ekspresi berakhir terlalu cepat")
+	}
+	return nil, fmt.Errorf("token tidak terduga '%s' di posisi %d", t.text, t.pos)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("fungsi '%s' tidak dikenal", name.text)
+	}
+	p.next() // "("
+	args, err := p.parseList(tokRParen, ")")
+	if err != nil {
+		return nil, err
+	}
+	return &callNode{name: name.text, fn: fn, args: args}, nil
+}
+
+func (p *parser) parseList(closing tokenKind, closingText string) ([]node, error) {
+	var items []node
+	if p.peek().kind == closing {
+		p.next()
+		return items, nil
+	}
+	for {
+		item, err := p.parseExpression(1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		t := p.next()
+		if t.kind == closing {
+			return items, nil
+		}
+		if t.kind != tokComma {
+			return nil, fmt.Errorf("diharapkan ',' atau '%s' di posisi %d", closingText, t.pos)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"pt-besq-core/internal/entity"
+	"pt-besq-core/internal/imaging"
+	"pt-besq-core/internal/repository"
+	"pt-besq-core/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartOverhead adalah ruang tambahan di atas batas ukuran file untuk header multipart
+const multipartOverhead = 1 << 20
+
+type AttachmentHandler struct {
+	Repo    *repository.AttachmentRepository
+	Details *repository.EnhancedInstanceRepository
+	Store   storage.Storage
+}
+
+func NewAttachmentHandler(store storage.Storage) *AttachmentHandler {
+	return &AttachmentHandler{
+		Repo:    repository.NewAttachmentRepository(),
+		Details: repository.NewEnhancedInstanceRepository(),
+		Store:   store,
+	}
+}
+
+// UploadToInstance mengunggah file (multipart, field "file") langsung sebagai lampiran instance.
+// Instance yang sudah di-approve, selesai atau dibatalkan tidak bisa diberi lampiran baru.
+// Endpoint: POST /api/instances/:id/upload
+func (h *AttachmentHandler) UploadToInstance(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+	// Dicek sebelum body dibaca supaya upload ke instance yang salah tidak perlu dikirim sampai habis
+	if err := h.Repo.CheckUploadTarget(id); err != nil {
+		respondAttachmentError(c, err)
+		return
+	}
+	h.upload(c, &id)
+}
+
+// Upload mengunggah file yang belum terikat ke instance. ID-nya dipakai sebagai nilai kolom
+// bertipe file saat membuat/mengedit instance; file terikat ke instance saat data disimpan.
+// Endpoint: POST /api/attachments
+func (h *AttachmentHandler) Upload(c *gin.Context) {
+	h.upload(c, nil)
+}
+
+// upload membaca file multipart, memeriksa ukuran dan tipe isinya, menulis ke storage lalu menyimpan metadata
+func (h *AttachmentHandler) upload(c *gin.Context, instanceID *int64) {
+	maxSize, err := h.Repo.MaxUploadSize()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membaca batas ukuran upload: " + err.Error()})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || (err == nil && header.Size > maxSize) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    fmt.Sprintf("Ukuran file melebihi batas %d byte", maxSize),
+			"max_size": maxSize,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File wajib dikirim sebagai multipart field 'file'"})
+		return
+	}
+	if header.Size == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File kosong"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File tidak bisa dibaca"})
+		return
+	}
+	defer file.Close()
+
+	// Tipe file ditentukan dari isinya, bukan dari Content-Type atau ekstensi kiriman client
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File tidak bisa dibaca"})
+		return
+	}
+	original := cleanFilename(header.Filename)
+	mimeType, ok := storage.DetectType(head[:n], original)
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":     "Tipe file tidak diizinkan",
+			"mime_type": mimeType,
+			"allowed":   storage.AllowedExtensions(),
+		})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "File tidak bisa dibaca"})
+		return
+	}
+
+	// Gambar dibaca utuh: lokasi GPS dibuang dari file aslinya lalu dibuatkan thumbnail
+	var body io.Reader = file
+	size := header.Size
+	var thumbs []imaging.Thumbnail
+	if strings.HasPrefix(mimeType, "image/") {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File tidak bisa dibaca"})
+			return
+		}
+		clean, orientation, err := imaging.StripLocation(data, mimeType)
+		if errors.Is(err, imaging.ErrCannotClean) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Metadata lokasi gambar tipe ini tidak bisa dibersihkan", "mime_type": mimeType})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File gambar rusak"})
+			return
+		}
+		body, size = bytes.NewReader(clean), int64(len(clean))
+		if imaging.CanThumbnail(mimeType) {
+			thumbs, err = imaging.Thumbnails(clean, mimeType, orientation)
+			if err != nil {
+				// File tetap disimpan; preview-nya memakai ikon generik
+				log.Printf("⚠️ Thumbnail %s tidak dibuat: %v", original, err)
+				thumbs = nil
+			}
+		}
+	}
+
+	// Nama file di storage acak; nama asli hanya disimpan sebagai metadata
+	name, err := randomName(filepath.Ext(original))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat nama file"})
+		return
+	}
+	ctx := c.Request.Context()
+	var stored []string
+	cleanup := func() {
+		// Isi file tanpa metadata tidak bisa dipakai, jadi ikut dihapus
+		for _, key := range stored {
+			if err := h.Store.Delete(ctx, key); err != nil {
+				log.Printf("⚠️ Gagal menghapus file %s setelah upload gagal: %v", key, err)
+			}
+		}
+	}
+
+	key := path.Join("attachments", time.Now().Format("2006/01"), name)
+	if err := h.Store.Put(ctx, key, body, size, mimeType); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan file: " + err.Error()})
+		return
+	}
+	stored = append(stored, key)
+
+	userID := currentUserID(c)
+	att := entity.Attachment{
+		InstanceID:       instanceID,
+		Filename:         name,
+		OriginalFilename: original,
+		FilePath:         key,
+		FileSize:         size,
+		MimeType:         mimeType,
+		UploadedBy:       &userID,
+	}
+	for _, th := range thumbs {
+		thumbKey := path.Join("thumbnails", th.Size, strings.TrimSuffix(name, filepath.Ext(name))+thumbnailExt(th.MimeType))
+		if err := h.Store.Put(ctx, thumbKey, bytes.NewReader(th.Data), int64(len(th.Data)), th.MimeType); err != nil {
+			cleanup()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan thumbnail: " + err.Error()})
+			return
+		}
+		stored = append(stored, thumbKey)
+		att.Thumbnails = append(att.Thumbnails, entity.AttachmentThumbnail{
+			Size:     th.Size,
+			FilePath: thumbKey,
+			MimeType: th.MimeType,
+			Width:    th.Width,
+			Height:   th.Height,
+		})
+	}
+
+	if err := h.Repo.Create(&att); err != nil {
+		cleanup()
+		respondAttachmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "File uploaded", "data": att})
+}
+
+// List menampilkan lampiran sebuah instance
+// Endpoint: GET /api/instances/:id/attachments
+func (h *AttachmentHandler) List(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+	if _, err := h.Details.GetWithDetails(id); err != nil {
+		respondAttachmentError(c, err)
+		return
+	}
+	attachments, err := h.Details.GetAttachments(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal ambil lampiran: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"instance_id": id, "data": attachments})
+}
+
+// Download mengirim isi file dengan nama aslinya
+// Endpoint: GET /api/attachments/:id
+func (h *AttachmentHandler) Download(c *gin.Context) {
+	id, ok := attachmentIDParam(c)
+	if !ok {
+		return
+	}
+	att, err := h.Repo.GetByID(id)
+	if err == nil {
+		err = h.Repo.CanRead(att, currentUserID(c), c.GetString("role"))
+	}
+	if err != nil {
+		respondAttachmentError(c, err)
+		return
+	}
+
+	body, err := h.Store.Get(c.Request.Context(), att.FilePath)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Isi file tidak ditemukan di storage"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membaca file: " + err.Error()})
+		return
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, att.FileSize, att.MimeType, body, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": att.OriginalFilename}),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// Preview mengirim thumbnail gambar untuk ditampilkan langsung (inline). Query size: sm atau md (default).
+// File tanpa thumbnail (PDF, dokumen, gambar yang tidak bisa di-decode) mendapat ikon SVG generik.
+// Endpoint: GET /api/attachments/:id/preview
+func (h *AttachmentHandler) Preview(c *gin.Context) {
+	id, ok := attachmentIDParam(c)
+	if !ok {
+		return
+	}
+	size := c.DefaultQuery("size", "md")
+	known := false
+	for _, s := range imaging.Sizes {
+		known = known || s.Name == size
+	}
+	if !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "size harus sm atau md"})
+		return
+	}
+
+	att, err := h.Repo.GetByID(id)
+	if err == nil {
+		err = h.Repo.CanRead(att, currentUserID(c), c.GetString("role"))
+	}
+	if err != nil {
+		respondAttachmentError(c, err)
+		return
+	}
+
+	// Thumbnail tidak pernah berubah untuk ID yang sama
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Header("X-Content-Type-Options", "nosniff")
+	for _, th := range att.Thumbnails {
+		if th.Size != size {
+			continue
+		}
+		body, err := h.Store.Get(c.Request.Context(), th.FilePath)
+		if errors.Is(err, storage.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membaca thumbnail: " + err.Error()})
+			return
+		}
+		defer body.Close()
+		c.DataFromReader(http.StatusOK, -1, th.MimeType, body, map[string]string{
+			"Content-Disposition": mime.FormatMediaType("inline", map[string]string{"filename": att.OriginalFilename}),
+		})
+		return
+	}
+
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	c.Data(http.StatusOK, "image/svg+xml", imaging.Icon(att.MimeType, att.OriginalFilename))
+}
+
+// Delete menghapus file lampiran beserta isinya di storage
+// Endpoint: DELETE /api/attachments/:id
+func (h *AttachmentHandler) Delete(c *gin.Context) {
+	id, ok := attachmentIDParam(c)
+	if !ok {
+		return
+	}
+	att, err := h.Repo.Delete(id, currentUserID(c), c.GetString("role"))
+	if err != nil {
+		respondAttachmentError(c, err)
+		return
+	}
+	// Metadata sudah terhapus; isi file yang gagal dihapus hanya menjadi sampah di storage
+	keys := []string{att.FilePath}
+	for _, th := range att.Thumbnails {
+		keys = append(keys, th.FilePath)
+	}
+	for _, key := range keys {
+		if err := h.Store.Delete(c.Request.Context(), key); err != nil {
+			log.Printf("⚠️ Gagal menghapus file %s dari storage: %v", key, err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "File dihapus", "id": id})
+}
+
+// respondAttachmentError memetakan error lampiran ke HTTP status yang sesuai
+func respondAttachmentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrInstanceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instance tidak ditemukan"})
+	case errors.Is(err, repository.ErrAttachmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "File tidak ditemukan"})
+	case errors.Is(err, repository.ErrAttachmentForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Anda tidak punya akses ke file ini"})
+	case errors.Is(err, repository.ErrInstanceLocked):
+		c.JSON(http.StatusConflict, gin.H{"error": "Instance sudah di-approve atau ditutup, lampiran tidak bisa diubah"})
+	case errors.Is(err, repository.ErrAttachmentInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "File masih dipakai di data instance, kosongkan kolomnya dulu"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// attachmentIDParam membaca :id lampiran dari URL; jika bukan angka langsung membalas 400
+func attachmentIDParam(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID File harus angka"})
+		return 0, false
+	}
+	return id, true
+}
+
+// cleanFilename membuang path dan karakter kontrol dari nama file kiriman client
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		return "file"
+	}
+	if len(name) > 255 {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:255-len(ext)], "") + ext
+	}
+	return name
+}
+
+// thumbnailExt mengembalikan ekstensi file thumbnail sesuai tipenya
+func thumbnailExt(mimeType string) string {
+	if mimeType == "image/jpeg" {
+		return ".jpg"
+	}
+	return ".png"
+}
+
+// randomName membuat nama file acak dengan ekstensi huruf kecil
+func randomName(ext string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf) + strings.ToLower(ext), nil
+}
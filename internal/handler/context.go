@@ -0,0 +1,19 @@
+package handler
+
+import "github.com/gin-gonic/gin"
+
+// currentUserID membaca user_id yang diset AuthMiddleware.
+// Claim JWT ter-decode sebagai float64, jadi keduanya ditangani. Return 0 jika tidak ada.
+func currentUserID(c *gin.Context) int {
+	val, exists := c.Get("user_id")
+	if !exists {
+		return 0
+	}
+	switch v := val.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
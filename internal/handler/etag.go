@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setETag mengirim revision resource sebagai ETag, misalnya "7"
+func setETag(c *gin.Context, revision int) {
+	c.Header("ETag", strconv.Quote(strconv.Itoa(revision)))
+}
+
+// ifMatchRevision membaca revision dari header If-Match yang wajib dikirim saat update.
+// Menerima "7", W/"7" atau 7. Jika header kosong atau tidak valid, response sudah dikirim
+// (428/400) dan hasilnya false.
+func ifMatchRevision(c *gin.Context) (int, bool) {
+	raw := strings.TrimSpace(c.GetHeader("If-Match"))
+	if raw == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "Header If-Match wajib diisi dengan ETag dari GET terakhir"})
+		return 0, false
+	}
+	tag := strings.Trim(strings.TrimPrefix(raw, "W/"), `"`)
+	revision, err := strconv.Atoi(tag)
+	if err != nil || revision <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "If-Match tidak valid, gunakan ETag dari GET terakhir"})
+		return 0, false
+	}
+	return revision, true
+}
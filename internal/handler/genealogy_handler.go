@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"pt-besq-core/internal/repository"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultGenealogyDepth dipakai jika ?depth tidak diisi
+const defaultGenealogyDepth = 5
+
+// GetGenealogy menampilkan graph batch asal dan/atau turunan sebuah instance.
+// Query: direction=up|down|both (default both), depth=N (default 5, maksimal 20).
+// Endpoint: GET /api/instances/:id/genealogy
+func (h *InstanceHandler) GetGenealogy(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+
+	direction := c.DefaultQuery("direction", repository.TraceBoth)
+	switch direction {
+	case repository.TraceUp, repository.TraceDown, repository.TraceBoth:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "direction harus up, down atau both"})
+		return
+	}
+	depth := defaultGenealogyDepth
+	if raw := c.Query("depth"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > repository.MaxGenealogyDepth {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "depth harus angka 1 sampai " + strconv.Itoa(repository.MaxGenealogyDepth)})
+			return
+		}
+		depth = n
+	}
+
+	graph, err := h.Details.GetGenealogy(id, direction, depth)
+	if errors.Is(err, repository.ErrInstanceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instance tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menelusuri genealogy: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": graph})
+}
+
+// GetRecallReport menampilkan semua batch hilir yang terdampak jika instance ini bermasalah,
+// lengkap dengan jalur penelusurannya.
+// Query: via=outputs (default, hilir dari instance ini) atau via=inputs (bahan asal instance
+// ditelusuri dulu, lalu semua hilir dari bahan itu termasuk batch saudara).
+// Endpoint: GET /api/instances/:id/recall
+func (h *InstanceHandler) GetRecallReport(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+
+	via := c.DefaultQuery("via", repository.RecallViaOutputs)
+	if via != repository.RecallViaOutputs && via != repository.RecallViaInputs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "via harus outputs atau inputs"})
+		return
+	}
+
+	report, err := h.Details.GetRecallReport(id, via)
+	if errors.Is(err, repository.ErrInstanceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instance tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat recall report: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": report, "total": len(report.Affected)})
+}
+
+// AddParent mencatat bahwa instance ini memakai material dari instance lain (batch/lot asal).
+// Body: {"parent_id": 12, "quantity": 25.5, "unit": "kg"}
+// Endpoint: POST /api/instances/:id/parents
+func (h *InstanceHandler) AddParent(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+
+	var input repository.InstanceLink
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.ChildID = id
+
+	err := h.Details.AddParentLink(input, currentUserID(c))
+	if err != nil {
+		respondLinkError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Instance linked", "data": input})
+}
+
+// RemoveParent menghapus hubungan material yang salah input.
+// Body (opsional): {"reason": "salah pilih lot"}
+// Endpoint: DELETE /api/instances/:id/parents/:parentId
+func (h *InstanceHandler) RemoveParent(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+	parentID, err := strconv.ParseInt(c.Param("parentId"), 10, 64)
+	if err != nil || parentID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID parent harus angka"})
+		return
+	}
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.ShouldBindJSON(&input)
+
+	if err := h.Details.RemoveParentLink(id, parentID, currentUserID(c), input.Reason); err != nil {
+		respondLinkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Instance unlinked"})
+}
+
+// respondLinkError memetakan error hubungan genealogy ke HTTP status
+func respondLinkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrInstanceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instance tidak ditemukan: " + err.Error()})
+	case errors.Is(err, repository.ErrLinkNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hubungan tidak ditemukan: " + err.Error()})
+	case errors.Is(err, repository.ErrLinkExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Hubungan ini sudah tercatat"})
+	case errors.Is(err, repository.ErrLinkCycle), errors.Is(err, repository.ErrLinkUnchecked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrInvalidQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan hubungan: " + err.Error()})
+	}
+}
@@ -2,11 +2,17 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"pt-besq-core/internal/entity"
 	"pt-besq-core/internal/repository"
+	"pt-besq-core/internal/validation"
 	"pt-besq-core/internal/websocket"
+	"pt-besq-core/internal/workflow"
+	"pt-besq-core/pkg/auth"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,14 +20,18 @@ import (
 )
 
 type InstanceHandler struct {
-	Repo *repository.InstanceRepository
-	Hub  *websocket.Hub
+	Repo    *repository.InstanceRepository
+	Details *repository.EnhancedInstanceRepository
+	Users   *repository.AuthRepository
+	Hub     *websocket.Hub
 }
 
 func NewInstanceHandler(hub *websocket.Hub) *InstanceHandler {
 	return &InstanceHandler{
-		Repo: repository.NewInstanceRepository(),
-		Hub:  hub,
+		Repo:    repository.NewInstanceRepository(),
+		Details: repository.NewEnhancedInstanceRepository(),
+		Users:   repository.NewAuthRepository(),
+		Hub:     hub,
 	}
 }
 
@@ -30,7 +40,10 @@ func (h *InstanceHandler) CreateInstance(c *gin.Context) {
 	var req struct {
 		TemplateID int                    `json:"template_id"`
 		WorkflowID int                    `json:"workflow_id"`
+		NodeID     string                 `json:"node_id"`
 		Data       map[string]interface{} `json:"data"`
+		Quantity   *float64               `json:"quantity"` // ukuran batch, dipakai saat split/merge
+		Unit       string                 `json:"unit" binding:"max=20"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -38,24 +51,76 @@ func (h *InstanceHandler) CreateInstance(c *gin.Context) {
 		return
 	}
 
-	// Get field definitions
-	fields, err := repository.GetFieldDefs(req.TemplateID)
+	if req.Quantity != nil && *req.Quantity <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantity harus lebih dari 0"})
+		return
+	}
+
+	// Instance baru hanya boleh dimulai di entry node workflow
+	nodeID, workflowVersion, err := repository.ResolveEntryNode(req.WorkflowID, req.TemplateID, req.NodeID)
+	if errors.Is(err, repository.ErrWorkflowNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Workflow tidak valid"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidEntryNode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repository.ErrWorkflowUnpublished) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Workflow belum dipublish: " + err.Error()})
+		return
+	}
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membaca workflow: " + err.Error()})
+		return
+	}
+
+	// Template harus ada dan aktif; kolomnya dipakai untuk validasi
+	tmpl, err := repository.GetTemplateByID(req.TemplateID)
+	if errors.Is(err, repository.ErrTemplateNotFound) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Template tidak valid"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membaca template: " + err.Error()})
+		return
+	}
+	fields := tmpl.Fields
 
 	// Validate input
-	if err := h.Repo.ValidateInput(req.Data, fields); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	userID := currentUserID(c)
+	if err := h.Repo.ValidateInput(req.Data, fields, 0, userID); err != nil {
+		respondValidationError(c, err)
 		return
 	}
 
 	// Convert data to JSON
 	jsonBytes, _ := json.Marshal(req.Data)
-	
+
 	// Save instance
-	id, err := h.Repo.SaveInstance(req.WorkflowID, req.TemplateID, jsonBytes)
+	id, batchNumber, err := h.Repo.SaveInstance(repository.NewInstance{
+		WorkflowID:      req.WorkflowID,
+		WorkflowVersion: workflowVersion,
+		TemplateID:      req.TemplateID,
+		Data:            jsonBytes,
+		CreatedBy:       userID,
+		AttachmentIDs:   validation.FileRefs(req.Data, fields),
+		NodeID:          nodeID,
+		Quantity:        req.Quantity,
+		Unit:            req.Unit,
+	})
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template tidak valid"})
+		return
+	}
+	if errors.Is(err, repository.ErrAttachmentUnavailable) {
+		c.JSON(http.StatusConflict, gin.H{"error": "File lampiran sudah dipakai data lain"})
+		return
+	}
+	if errors.Is(err, repository.ErrBatchNumberExhausted) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Nomor batch tidak tersedia: " + err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan data"})
 		return
@@ -65,19 +130,22 @@ func (h *InstanceHandler) CreateInstance(c *gin.Context) {
 	msg := websocket.Message{
 		Event: "new_instance",
 		Data: map[string]interface{}{
-			"instance_id": id,
-			"workflow_id": req.WorkflowID,
-			"template_id": req.TemplateID,
-			"status":      "draft",
+			"instance_id":  id,
+			"workflow_id":  req.WorkflowID,
+			"template_id":  req.TemplateID,
+			"node_id":      nodeID,
+			"batch_number": batchNumber,
+			"status":       "draft",
 		},
 		Timestamp: time.Now(),
 	}
 	h.Hub.Broadcast <- msg
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message":   "Data valid, saved & broadcasted",
-		"id":        id,
-		"timestamp": time.Now(),
+		"message":      "Data valid, saved & broadcasted",
+		"id":           id,
+		"batch_number": batchNumber,
+		"timestamp":    time.Now(),
 	})
 }
 
@@ -115,6 +183,466 @@ func (h *InstanceHandler) GetList(c *gin.Context) {
 	})
 }
 
+// GetByID menampilkan detail satu instance: data dengan label kolom sesuai versi template
+// yang dipakai saat input, file lampiran, dan riwayat perubahannya.
+// Endpoint: GET /api/instances/:id
+func (h *InstanceHandler) GetByID(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+
+	instance, err := h.Details.GetWithDetails(id)
+	if errors.Is(err, repository.ErrInstanceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instance tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal ambil data: " + err.Error()})
+		return
+	}
+
+	fields, err := repository.GetFieldDefsForVersion(instance.TemplateID, instance.TemplateVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal ambil definisi kolom: " + err.Error()})
+		return
+	}
+	rendered, err := repository.RenderPayload(fields, instance.DataPayload)
+	if err != nil {
+		// Payload rusak tetap ditampilkan mentah di data.data_payload
+		rendered = []entity.FieldValue{}
+	}
+
+	attachments, err := h.Details.GetAttachments(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal ambil lampiran: " + err.Error()})
+		return
+	}
+	history, err := h.Details.GetHistory(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal ambil riwayat: " + err.Error()})
+		return
+	}
+	approvals, err := h.Details.GetApprovalProgress(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal ambil status approval: " + err.Error()})
+		return
+	}
+
+	setETag(c, instance.Revision)
+	c.JSON(http.StatusOK, gin.H{
+		"data":        instance,
+		"fields":      rendered,
+		"attachments": attachments,
+		"approvals":   approvals,
+		"history":     history,
+	})
+}
+
+// GetHistory menampilkan timeline perubahan instance (terbaru dulu) beserta nama user
+// Endpoint: GET /api/instances/:id/history
+func (h *InstanceHandler) GetHistory(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+
+	history, err := h.Details.GetHistory(id)
+	if errors.Is(err, repository.ErrInstanceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instance tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal ambil riwayat: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"instance_id": id, "data": history})
+}
+
+// UpdateInstance mengoreksi data_payload instance yang belum di-approve.
+// Body: {"data": {"oven_temp": 182}, "reason": "salah baca termometer"}.
+// Hanya key yang dikirim yang diganti (null menghapus key); hasil gabungannya divalidasi ulang
+// terhadap versi template instance. Header If-Match wajib berisi ETag dari GET /api/instances/:id;
+// jika instance sudah diubah orang lain, hasilnya 409 beserta data terbaru.
+// Endpoint: PUT /api/instances/:id
+func (h *InstanceHandler) UpdateInstance(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+	revision, ok := ifMatchRevision(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Data   map[string]interface{} `json:"data" binding:"required"`
+		Reason string                 `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alasan perubahan (reason) wajib diisi"})
+		return
+	}
+
+	instance, err := h.Details.GetWithDetails(id)
+	if errors.Is(err, repository.ErrInstanceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instance tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal ambil data: " + err.Error()})
+		return
+	}
+	if instance.Revision != revision {
+		h.respondRevisionConflict(c, instance)
+		return
+	}
+	if instance.ApprovedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Instance sudah di-approve dan tidak bisa diedit"})
+		return
+	}
+
+	merged := map[string]interface{}{}
+	if len(instance.DataPayload) > 0 {
+		if err := json.Unmarshal(instance.DataPayload, &merged); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "data_payload lama tidak valid"})
+			return
+		}
+	}
+	for key, val := range req.Data {
+		if val == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = val
+	}
+
+	fields, err := repository.GetFieldDefsForVersion(instance.TemplateID, instance.TemplateVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal ambil definisi kolom: " + err.Error()})
+		return
+	}
+	userID := currentUserID(c)
+	if err := h.Repo.ValidateInput(merged, fields, id, userID); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	changes, newRevision, err := h.Details.UpdatePayload(id, repository.PayloadEdit{
+		Data:          merged,
+		Fields:        fields,
+		Reason:        req.Reason,
+		EditedBy:      userID,
+		AttachmentIDs: validation.FileRefs(merged, fields),
+		Revision:      revision,
+	})
+	switch {
+	case errors.Is(err, repository.ErrInstanceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instance tidak ditemukan"})
+		return
+	case errors.Is(err, repository.ErrRevisionConflict):
+		// Diubah request lain di antara validasi dan penyimpanan
+		current, err := h.Details.GetWithDetails(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal ambil data: " + err.Error()})
+			return
+		}
+		h.respondRevisionConflict(c, current)
+		return
+	case errors.Is(err, repository.ErrInstanceLocked):
+		c.JSON(http.StatusConflict, gin.H{"error": "Instance sudah di-approve, sedang diproses approval, atau sudah ditutup; data tidak bisa diedit"})
+		return
+	case errors.Is(err, repository.ErrAttachmentUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": "File lampiran sudah dipakai data lain"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan perubahan: " + err.Error()})
+		return
+	}
+
+	if len(changes) > 0 {
+		h.Hub.Broadcast <- websocket.Message{
+			Event: "instance_updated",
+			Data: map[string]interface{}{
+				"instance_id": id,
+				"changes":     changes,
+			},
+			Timestamp: time.Now(),
+		}
+	}
+	setETag(c, newRevision)
+	c.JSON(http.StatusOK, gin.H{"message": "Data diperbarui", "id": id, "revision": newRevision, "changes": changes})
+}
+
+// respondRevisionConflict membalas 409 beserta data instance terbaru dan ETag-nya
+// supaya client bisa menggabungkan perubahannya lalu mengirim ulang
+func (h *InstanceHandler) respondRevisionConflict(c *gin.Context, current *repository.InstanceWithDetails) {
+	setETag(c, current.Revision)
+	c.JSON(http.StatusConflict, gin.H{
+		"error":   "Instance sudah diubah user lain, muat ulang lalu ulangi perubahan",
+		"current": current,
+	})
+}
+
+// UpdateStatus memindahkan status instance sesuai tabel transisi dan role user.
+// Header If-Match wajib diisi ETag dari GET terakhir, sama seperti edit data: status
+// tidak boleh berubah berdasarkan tampilan yang sudah usang.
+// Body: {"status": "in_progress", "comment": "..."}
+// Endpoint: PUT /api/instances/:id/status
+func (h *InstanceHandler) UpdateStatus(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+	revision, ok := ifMatchRevision(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Status  string `json:"status" binding:"required"`
+		Comment string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := c.GetString("role")
+	newRevision, err := h.Details.UpdateStatus(id, req.Status, role, currentUserID(c), req.Comment, revision)
+	if err != nil {
+		h.respondStatusError(c, id, err)
+		return
+	}
+
+	h.Hub.Broadcast <- websocket.Message{
+		Event: "instance_status_changed",
+		Data: map[string]interface{}{
+			"instance_id": id,
+			"status":      req.Status,
+		},
+		Timestamp: time.Now(),
+	}
+	setETag(c, newRevision)
+	c.JSON(http.StatusOK, gin.H{"message": "Status diperbarui", "id": id, "status": req.Status, "revision": newRevision})
+}
+
+// Approve menandatangani langkah approval yang menjadi giliran user (diambil dari JWT).
+// Tanda tangan elektronik wajib: password dimasukkan ulang dan arti tanda tangan dipilih
+// ("reviewed" atau "approved", default "approved").
+// Instance baru completed setelah semua langkah di rantai approval template menyetujui.
+// Header If-Match wajib diisi ETag dari data yang dibaca penandatangan.
+// Body: {"password": "...", "meaning": "approved", "comment": "..."}. Endpoint: PUT /api/instances/:id/approve
+func (h *InstanceHandler) Approve(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+	revision, ok := ifMatchRevision(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Password string `json:"password"`
+		Meaning  string `json:"meaning"`
+		Comment  string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password wajib diisi untuk tanda tangan elektronik"})
+		return
+	}
+	if !h.verifySigner(c, req.Password) {
+		return
+	}
+	if req.Meaning == "" {
+		req.Meaning = repository.MeaningApproved
+	}
+
+	review, err := h.Details.ApproveInstance(id, c.GetString("role"), currentUserID(c), req.Meaning, req.Comment, revision)
+	if err != nil {
+		h.respondStatusError(c, id, err)
+		return
+	}
+	setETag(c, review.Revision)
+	if review.Status != repository.StatusCompleted {
+		h.publishReview("instance_approval_progress", review)
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("Langkah '%s' disetujui, menunggu %d langkah lagi", review.Step, review.RemainingSteps),
+			"data":    review,
+		})
+		return
+	}
+	h.publishReview("instance_approved", review)
+	c.JSON(http.StatusOK, gin.H{"message": "Instance disetujui", "data": review})
+}
+
+// Reject menolak instance atas nama langkah approval yang menjadi giliran user; alasan wajib diisi.
+// Penolakan juga ditandatangani elektronik (arti "rejected") dengan memasukkan ulang password.
+// Header If-Match wajib diisi ETag dari data yang dibaca penandatangan.
+// Body: {"password": "...", "reason": "..."}. Endpoint: PUT /api/instances/:id/reject
+func (h *InstanceHandler) Reject(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+	revision, ok := ifMatchRevision(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Password string `json:"password"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alasan penolakan (reason) wajib diisi"})
+		return
+	}
+	if !h.verifySigner(c, req.Password) {
+		return
+	}
+
+	review, err := h.Details.RejectInstance(id, c.GetString("role"), currentUserID(c), req.Reason, revision)
+	if err != nil {
+		h.respondStatusError(c, id, err)
+		return
+	}
+	setETag(c, review.Revision)
+	h.publishReview("instance_rejected", review)
+	c.JSON(http.StatusOK, gin.H{"message": "Instance ditolak", "data": review})
+}
+
+// verifySigner memeriksa ulang password user yang sedang login sebelum tanda tangan elektronik.
+// Jika gagal, response sudah dikirim dan hasilnya false.
+func (h *InstanceHandler) verifySigner(c *gin.Context, password string) bool {
+	if password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password wajib diisi untuk tanda tangan elektronik"})
+		return false
+	}
+	user, err := h.Users.GetUserByID(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if user.ID == 0 || !auth.CheckPasswordHash(password, user.PasswordHash) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password salah, tanda tangan ditolak"})
+		return false
+	}
+	return true
+}
+
+// VerifySignatures memeriksa tanda tangan elektronik instance: record tidak diubah, rantai utuh,
+// dan data_payload sekarang masih sama dengan yang ditandatangani.
+// Endpoint: GET /api/instances/:id/signatures/verify
+func (h *InstanceHandler) VerifySignatures(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+	result, err := h.Details.VerifySignatures(id)
+	if errors.Is(err, repository.ErrInstanceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instance tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memverifikasi tanda tangan: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// publishReview mengirim event approve/reject ke pembuat instance dan
+// perubahan status ke semua client yang terhubung
+func (h *InstanceHandler) publishReview(event string, review *repository.InstanceReview) {
+	if review.CreatedBy > 0 {
+		data := map[string]interface{}{
+			"instance_id":     review.InstanceID,
+			"status":          review.Status,
+			"step":            review.Step,
+			"remaining_steps": review.RemainingSteps,
+		}
+		if review.Notification.ID > 0 {
+			data["notification"] = review.Notification
+		}
+		h.Hub.BroadcastToUser <- websocket.UserMessage{
+			UserID: review.CreatedBy,
+			Message: websocket.Message{
+				Event:     event,
+				Data:      data,
+				Timestamp: time.Now(),
+			},
+		}
+	}
+	if review.Status == review.PreviousStatus {
+		return
+	}
+	h.Hub.Broadcast <- websocket.Message{
+		Event: "instance_status_changed",
+		Data: map[string]interface{}{
+			"instance_id": review.InstanceID,
+			"status":      review.Status,
+		},
+		Timestamp: time.Now(),
+	}
+}
+
+// respondStatusError memetakan error perpindahan status ke HTTP status yang sesuai.
+// Untuk transisi yang tidak sah, status yang boleh dipilih ikut dikirim; untuk If-Match
+// yang usang, data instance terbaru ikut dikirim.
+func (h *InstanceHandler) respondStatusError(c *gin.Context, id int64, err error) {
+	var terr *repository.TransitionError
+	switch {
+	case errors.Is(err, repository.ErrInstanceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instance tidak ditemukan"})
+	case errors.Is(err, repository.ErrRevisionConflict):
+		current, err := h.Details.GetWithDetails(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal ambil data: " + err.Error()})
+			return
+		}
+		h.respondRevisionConflict(c, current)
+	case errors.Is(err, repository.ErrInvalidStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.As(err, &terr):
+		code := http.StatusConflict
+		if errors.Is(err, repository.ErrTransitionForbidden) {
+			code = http.StatusForbidden
+		}
+		c.JSON(code, gin.H{
+			"error":          err.Error(),
+			"current_status": terr.From,
+			"allowed":        terr.Allowed(),
+		})
+	case errors.Is(err, repository.ErrNotApprover):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrAlreadySigned):
+		c.JSON(http.StatusConflict, gin.H{"error": "Anda sudah menandatangani langkah lain untuk instance ini"})
+	case errors.Is(err, repository.ErrInvalidSignatureMeaning):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrApprovalRequired):
+		c.JSON(http.StatusConflict, gin.H{"error": "Template ini memakai rantai approval; selesaikan lewat endpoint approve"})
+	case errors.Is(err, repository.ErrWorkflowUnpublished):
+		c.JSON(http.StatusConflict, gin.H{"error": "Workflow belum dipublish: " + err.Error()})
+	case errors.Is(err, workflow.ErrNoMatchingBranch):
+		c.JSON(http.StatusConflict, gin.H{"error": "Tahap berikutnya tidak bisa ditentukan: " + err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengubah status: " + err.Error()})
+	}
+}
+
+// instanceIDParam membaca :id dari URL; jika bukan angka langsung membalas 400
+func instanceIDParam(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Instance harus angka"})
+		return 0, false
+	}
+	return id, true
+}
+
 // ExportExcel (Download .xlsx)
 func (h *InstanceHandler) ExportExcel(c *gin.Context) {
 	templateID, _ := strconv.Atoi(c.Query("template_id"))
@@ -133,20 +661,31 @@ func (h *InstanceHandler) ExportExcel(c *gin.Context) {
 	f.SetActiveSheet(index)
 	f.DeleteSheet("Sheet1")
 
-	headers := []string{"ID", "Waktu", "Proses", "Workflow", "Status", "Data JSON"}
+	headers := []string{"ID", "Waktu", "Proses", "Versi", "Workflow", "Status", "Data"}
 	for i, header := range headers {
 		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
 		f.SetCellValue(sheet, cell, header)
 	}
 
+	// Cache definisi kolom per (template, versi) supaya tiap baris dibaca dengan labelnya sendiri
+	fieldCache := map[[2]int][]entity.FieldDef{}
+
 	for i, log := range logs {
 		rowNum := i + 2
 		f.SetCellValue(sheet, fmt.Sprintf("A%d", rowNum), log.ID)
 		f.SetCellValue(sheet, fmt.Sprintf("B%d", rowNum), log.CreatedAt.Format("2006-01-02 15:04:05"))
 		f.SetCellValue(sheet, fmt.Sprintf("C%d", rowNum), log.TemplateName)
-		f.SetCellValue(sheet, fmt.Sprintf("D%d", rowNum), log.WorkflowName)
-		f.SetCellValue(sheet, fmt.Sprintf("E%d", rowNum), log.Status)
-		f.SetCellValue(sheet, fmt.Sprintf("F%d", rowNum), string(log.DataPayload))
+		f.SetCellValue(sheet, fmt.Sprintf("D%d", rowNum), log.TemplateVersion)
+		f.SetCellValue(sheet, fmt.Sprintf("E%d", rowNum), log.WorkflowName)
+		f.SetCellValue(sheet, fmt.Sprintf("F%d", rowNum), log.Status)
+
+		cacheKey := [2]int{log.TemplateID, log.TemplateVersion}
+		fields, ok := fieldCache[cacheKey]
+		if !ok {
+			fields, _ = repository.GetFieldDefsForVersion(log.TemplateID, log.TemplateVersion)
+			fieldCache[cacheKey] = fields
+		}
+		f.SetCellValue(sheet, fmt.Sprintf("G%d", rowNum), formatPayload(fields, log.DataPayload))
 	}
 
 	filename := fmt.Sprintf("Laporan_%s.xlsx", time.Now().Format("20060102"))
@@ -156,4 +695,32 @@ func (h *InstanceHandler) ExportExcel(c *gin.Context) {
 	if _, err := f.WriteTo(c.Writer); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal generate file"})
 	}
-}
\ No newline at end of file
+}
+
+// formatPayload menampilkan payload sebagai "Label: nilai" per baris.
+// Kalau payload tidak bisa dibaca, JSON mentahnya yang ditampilkan.
+func formatPayload(fields []entity.FieldDef, payload json.RawMessage) string {
+	rendered, err := repository.RenderPayload(fields, payload)
+	if err != nil {
+		return string(payload)
+	}
+	lines := make([]string, 0, len(rendered))
+	for _, fv := range rendered {
+		lines = append(lines, fmt.Sprintf("%s: %v", fv.Label, fv.Value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// respondValidationError mengirim 400 dengan daftar pelanggaran per kolom.
+// Field "error" tetap berisi ringkasan teks agar client lama tidak rusak.
+func respondValidationError(c *gin.Context, err error) {
+	var verrs validation.Errors
+	if errors.As(err, &verrs) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  verrs.Error(),
+			"errors": verrs,
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"pt-besq-core/internal/repository"
+	"pt-besq-core/internal/websocket"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Split membagi sisa quantity batch ke beberapa instance baru.
+// Body: {"parts": [{"quantity": 30}, {"quantity": 20}], "reason": "dibagi ke oven 1 dan 2"}
+// Endpoint: POST /api/instances/:id/split
+func (h *InstanceHandler) Split(c *gin.Context) {
+	id, ok := instanceIDParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Parts  []repository.SplitPart `json:"parts" binding:"required,dive"`
+		Reason string                 `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	op, err := h.Details.SplitInstance(id, input.Parts, currentUserID(c), input.Reason)
+	if err != nil {
+		respondBatchOperationError(c, err)
+		return
+	}
+	h.publishBatchOperation(op)
+	c.JSON(http.StatusCreated, gin.H{"message": "Batch split", "data": op})
+}
+
+// Merge menggabungkan beberapa batch menjadi satu instance baru.
+// quantity per sumber boleh dikosongkan untuk mengambil seluruh sisanya.
+// Body: {"sources": [{"instance_id": 12}, {"instance_id": 15, "quantity": 4.5}], "reason": "sisa shift malam"}
+// Endpoint: POST /api/instances/merge
+func (h *InstanceHandler) Merge(c *gin.Context) {
+	var input struct {
+		Sources []repository.MergeSource `json:"sources" binding:"required,dive"`
+		Reason  string                   `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	op, err := h.Details.MergeInstances(input.Sources, currentUserID(c), input.Reason)
+	if err != nil {
+		respondBatchOperationError(c, err)
+		return
+	}
+	h.publishBatchOperation(op)
+	c.JSON(http.StatusCreated, gin.H{"message": "Batches merged", "data": op})
+}
+
+// publishBatchOperation mengumumkan instance hasil split/merge seperti instance baru biasa,
+// dan sumber yang ditutup karena habis seperti perubahan status biasa
+func (h *InstanceHandler) publishBatchOperation(op *repository.BatchOperation) {
+	for _, created := range op.Created {
+		h.Hub.Broadcast <- websocket.Message{
+			Event: "new_instance",
+			Data: map[string]interface{}{
+				"instance_id":  created.InstanceID,
+				"batch_number": created.BatchNumber,
+				"operation":    op.Operation,
+				"status":       "draft",
+			},
+			Timestamp: time.Now(),
+		}
+	}
+	for _, id := range op.Closed {
+		h.Hub.Broadcast <- websocket.Message{
+			Event: "instance_status_changed",
+			Data: map[string]interface{}{
+				"instance_id": id,
+				"status":      repository.StatusCancelled,
+			},
+			Timestamp: time.Now(),
+		}
+	}
+}
+
+// respondBatchOperationError memetakan error split/merge ke HTTP status
+func respondBatchOperationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrInstanceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instance tidak ditemukan: " + err.Error()})
+	case errors.Is(err, repository.ErrQuantityMismatch),
+		errors.Is(err, repository.ErrInvalidQuantity),
+		errors.Is(err, repository.ErrIncompatibleBatches):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrBatchUnavailable),
+		errors.Is(err, repository.ErrBatchNumberExhausted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memproses batch: " + err.Error()})
+	}
+}
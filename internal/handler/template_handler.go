@@ -1,9 +1,14 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"pt-besq-core/internal/batchno"
+	"pt-besq-core/internal/entity"
 	"pt-besq-core/internal/repository"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -24,6 +29,27 @@ func (h *TemplateHandler) GetAll(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": data})
 }
 
+// GetByID mengambil satu template beserta semua kolomnya
+// Endpoint: GET /api/templates/:id
+func (h *TemplateHandler) GetByID(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Template harus angka"})
+		return
+	}
+
+	tmpl, err := repository.GetTemplateByID(id)
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": tmpl})
+}
+
 // GetFields mengambil "Resep Form" (kolom apa saja yang dibutuhkan)
 // Endpoint: GET /api/templates/:id/fields
 func (h *TemplateHandler) GetFields(c *gin.Context) {
@@ -48,4 +74,376 @@ func (h *TemplateHandler) GetFields(c *gin.Context) {
 		"template_id": id,
 		"fields":      fields,
 	})
-}
\ No newline at end of file
+}
+
+// GetVersions menampilkan riwayat versi skema sebuah template
+// Endpoint: GET /api/templates/:id/versions
+func (h *TemplateHandler) GetVersions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Template harus angka"})
+		return
+	}
+
+	versions, err := repository.GetTemplateVersions(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil versi template: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"template_id": id,
+		"data":        versions,
+	})
+}
+
+// GetFieldOptions mengambil daftar pilihan sebuah kolom select untuk dropdown di form
+// Endpoint: GET /api/templates/:id/fields/:key/options
+func (h *TemplateHandler) GetFieldOptions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Template harus angka"})
+		return
+	}
+
+	options, err := repository.GetFieldOptions(id, c.Param("key"))
+	if errors.Is(err, repository.ErrFieldNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kolom tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil pilihan: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"template_id": id,
+		"field_key":   c.Param("key"),
+		"options":     options,
+	})
+}
+
+// Create membuat template baru beserta definisi kolomnya
+// Endpoint: POST /api/templates
+func (h *TemplateHandler) Create(c *gin.Context) {
+	var input entity.ProcessTemplate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validTemplateInput(c, input) {
+		return
+	}
+
+	id, err := repository.CreateTemplate(input, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan template: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Template created", "id": id})
+}
+
+// Update mengganti data template dan urutan kolomnya.
+// Jika "fields" tidak dikirim, kolom template dibiarkan apa adanya.
+// Endpoint: PUT /api/templates/:id
+func (h *TemplateHandler) Update(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Template harus angka"})
+		return
+	}
+
+	var input entity.ProcessTemplate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validTemplateInput(c, input) {
+		return
+	}
+	input.ID = id
+
+	err = repository.UpdateTemplate(input, currentUserID(c))
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal update template: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template updated", "id": id})
+}
+
+// GetApprovalPolicy menampilkan rantai approval template.
+// Steps kosong berarti cukup satu approval supervisor.
+// Endpoint: GET /api/templates/:id/approval-policy
+func (h *TemplateHandler) GetApprovalPolicy(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Template harus angka"})
+		return
+	}
+
+	policy, err := repository.GetApprovalPolicy(id)
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": policy})
+}
+
+// UpdateApprovalPolicy mengganti rantai approval template.
+// Body: {"mode": "ordered", "steps": [{"name": "Shift Supervisor", "role": "supervisor"}, {"name": "QA", "user_ids": [7, 9]}]}
+// Endpoint: PUT /api/templates/:id/approval-policy
+func (h *TemplateHandler) UpdateApprovalPolicy(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Template harus angka"})
+		return
+	}
+
+	var input entity.ApprovalPolicy
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Mode == "" {
+		input.Mode = repository.ApprovalOrdered
+	}
+	input.TemplateID = id
+
+	err = repository.SaveApprovalPolicy(input)
+	if errors.Is(err, repository.ErrInvalidApprovalPolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan rantai approval: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Approval policy updated", "id": id})
+}
+
+// batchPreviewCount adalah jumlah nomor batch berikutnya yang ditampilkan di preview
+const batchPreviewCount = 5
+
+// GetBatchPattern menampilkan pola nomor batch template beserta beberapa nomor berikutnya.
+// Pattern kosong berarti instance dibuat tanpa nomor batch.
+// Endpoint: GET /api/templates/:id/batch-pattern
+func (h *TemplateHandler) GetBatchPattern(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Template harus angka"})
+		return
+	}
+
+	pattern, err := repository.GetBatchPattern(id)
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	next := []string{}
+	if pattern.Pattern != "" {
+		next, err = repository.PreviewBatchNumbers(id, pattern.Pattern, pattern.ResetPeriod, batchPreviewCount)
+		if err != nil {
+			// Pola tersimpan yang sudah tidak valid tetap ditampilkan supaya admin bisa memperbaikinya
+			c.JSON(http.StatusOK, gin.H{"data": pattern, "next": []string{}, "warning": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": pattern, "next": next})
+}
+
+// UpdateBatchPattern mengganti pola nomor batch template. Pattern kosong mematikan penomoran otomatis.
+// Body: {"pattern": "MIX-{YYYY}{MM}{DD}-{SEQ:4}", "reset_period": "daily"}
+// Endpoint: PUT /api/templates/:id/batch-pattern
+func (h *TemplateHandler) UpdateBatchPattern(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Template harus angka"})
+		return
+	}
+
+	var input entity.BatchNumberPattern
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.ResetPeriod == "" {
+		input.ResetPeriod = batchno.ResetDaily
+	}
+	input.TemplateID = id
+	if userID := currentUserID(c); userID != 0 {
+		input.UpdatedBy = &userID
+	}
+
+	err = repository.SaveBatchPattern(input)
+	if errors.Is(err, batchno.ErrInvalidPattern) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repository.ErrBatchPatternConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan pola nomor batch: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Batch number pattern updated", "id": id})
+}
+
+// PreviewBatchPattern menampilkan nomor batch berikutnya untuk pola yang belum disimpan,
+// melanjutkan nomor urut template di periode saat ini. Tidak ada nomor yang terpakai.
+// Body: {"pattern": "MIX-{YY}{MM}-{SEQ:3}", "reset_period": "monthly"}
+// Endpoint: POST /api/templates/:id/batch-pattern/preview
+func (h *TemplateHandler) PreviewBatchPattern(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Template harus angka"})
+		return
+	}
+
+	var input entity.BatchNumberPattern
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.ResetPeriod == "" {
+		input.ResetPeriod = batchno.ResetDaily
+	}
+
+	next, err := repository.PreviewBatchNumbers(id, input.Pattern, input.ResetPeriod, batchPreviewCount)
+	if errors.Is(err, batchno.ErrInvalidPattern) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pattern": input.Pattern, "reset_period": input.ResetPeriod, "next": next})
+}
+
+// Delete menonaktifkan template (soft delete)
+// Endpoint: DELETE /api/templates/:id
+func (h *TemplateHandler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Template harus angka"})
+		return
+	}
+
+	err = repository.DeleteTemplate(id)
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted", "id": id})
+}
+
+// Export mengunduh template beserta kolomnya sebagai bundle JSON
+// Endpoint: GET /api/templates/:id/export
+func (h *TemplateHandler) Export(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Template harus angka"})
+		return
+	}
+
+	bundle, err := repository.ExportTemplate(id)
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal export template: " + err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("template_%d_v%d.json", id, bundle.Source.Version)
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.JSON(http.StatusOK, bundle)
+}
+
+// Import membuat template dari bundle JSON hasil Export.
+// Query on_conflict menentukan perlakuan jika nama atau key template sudah ada: fail (default), skip, replace, rename.
+// Endpoint: POST /api/templates/import
+func (h *TemplateHandler) Import(c *gin.Context) {
+	var bundle entity.TemplateBundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := repository.ImportTemplate(bundle, c.Query("on_conflict"), currentUserID(c))
+	var conflict *repository.TemplateConflictError
+	switch {
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       conflict.Error(),
+			"existing_id": conflict.ExistingID,
+			"hint":        "gunakan ?on_conflict=skip, replace atau rename",
+		})
+		return
+	case errors.Is(err, repository.ErrUnsupportedBundle),
+		errors.Is(err, repository.ErrInvalidImportMode),
+		errors.Is(err, repository.ErrUnresolvedTemplate),
+		errors.Is(err, repository.ErrDuplicateFieldKey):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gagal import template: " + err.Error()})
+		return
+	}
+
+	status := http.StatusCreated
+	if result.Action != "created" {
+		status = http.StatusOK
+	}
+	c.JSON(status, gin.H{"message": "Template " + result.Action, "data": result})
+}
+
+// validTemplateInput mengecek nama dan daftar kolom, lalu menulis 400 jika tidak valid
+func validTemplateInput(c *gin.Context, input entity.ProcessTemplate) bool {
+	if strings.TrimSpace(input.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nama template wajib diisi"})
+		return false
+	}
+	if err := repository.CheckFieldDefs(input.Fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
@@ -1,9 +1,11 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"pt-besq-core/internal/entity"
 	"pt-besq-core/internal/repository"
+	"pt-besq-core/internal/workflow"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -35,6 +37,10 @@ func (h *WorkflowHandler) Create(c *gin.Context) {
 		return
 	}
 
+	if !h.validCanvas(c, input.CanvasConfig) {
+		return
+	}
+
 	id, err := h.Repo.Create(input)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -43,9 +49,42 @@ func (h *WorkflowHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "Workflow created", "id": id})
 }
 
+// GetByID menampilkan satu workflow beserta draft canvas-nya; revision dikirim sebagai ETag
+// Endpoint: GET /api/workflows/:id
+func (h *WorkflowHandler) GetByID(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Workflow harus angka"})
+		return
+	}
+
+	wf, err := h.Repo.GetByID(id)
+	if errors.Is(err, repository.ErrWorkflowNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workflow tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setETag(c, wf.Revision)
+	c.JSON(http.StatusOK, gin.H{"data": wf})
+}
+
+// UpdateLayout menyimpan draft canvas. Header If-Match wajib berisi ETag dari GET /api/workflows/:id;
+// jika canvas sudah disimpan admin lain, hasilnya 409 beserta workflow terbaru.
+// Endpoint: PUT /api/workflows/:id
 func (h *WorkflowHandler) UpdateLayout(c *gin.Context) {
 	idStr := c.Param("id")
-	id, _ := strconv.Atoi(idStr)
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Workflow harus angka"})
+		return
+	}
+	revision, ok := ifMatchRevision(c)
+	if !ok {
+		return
+	}
 
 	// Kita baca raw body sebagai string JSON
 	bodyBytes, err := c.GetRawData()
@@ -53,12 +92,152 @@ func (h *WorkflowHandler) UpdateLayout(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body"})
 		return
 	}
-	
-	err = h.Repo.UpdateLayout(id, string(bodyBytes))
+
+	if !h.validCanvas(c, bodyBytes) {
+		return
+	}
+
+	newRevision, err := h.Repo.UpdateLayout(id, string(bodyBytes), revision)
+	if errors.Is(err, repository.ErrWorkflowNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workflow tidak ditemukan"})
+		return
+	}
+	if errors.Is(err, repository.ErrRevisionConflict) {
+		current, err := h.Repo.GetByID(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		setETag(c, current.Revision)
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Workflow sudah diubah admin lain, muat ulang lalu ulangi perubahan",
+			"current": current,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setETag(c, newRevision)
+	c.JSON(http.StatusOK, gin.H{"message": "Layout updated", "revision": newRevision})
+}
+
+// Publish menyimpan draft canvas sebagai versi baru yang dipakai instance berikutnya
+// Endpoint: POST /api/workflows/:id/publish
+func (h *WorkflowHandler) Publish(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Workflow harus angka"})
+		return
+	}
+
+	version, err := h.Repo.PublishWorkflow(id, currentUserID(c))
+	var problems workflow.Problems
+	switch {
+	case errors.As(err, &problems):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Workflow tidak valid", "problems": problems})
+		return
+	case errors.Is(err, repository.ErrWorkflowNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workflow tidak ditemukan"})
+		return
+	case errors.Is(err, repository.ErrNothingToPublish):
+		c.JSON(http.StatusConflict, gin.H{"error": "Tidak ada perubahan sejak versi terakhir", "version": version})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Workflow published", "id": id, "version": version})
+}
+
+// GetVersions menampilkan riwayat versi workflow beserta perubahannya.
+// Dengan query ?from=1&to=2 yang dikembalikan hanya perbandingan dua versi (0 = draft).
+// Endpoint: GET /api/workflows/:id/versions
+func (h *WorkflowHandler) GetVersions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Workflow harus angka"})
+		return
+	}
+
+	if c.Query("from") != "" || c.Query("to") != "" {
+		from, errFrom := strconv.Atoi(c.DefaultQuery("from", "0"))
+		to, errTo := strconv.Atoi(c.DefaultQuery("to", "0"))
+		if errFrom != nil || errTo != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from dan to harus angka versi (0 = draft)"})
+			return
+		}
+		diff, err := h.Repo.DiffWorkflowVersions(id, from, to)
+		if errors.Is(err, repository.ErrWorkflowNotFound) || errors.Is(err, repository.ErrWorkflowVersionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"workflow_id": id, "from": from, "to": to, "diff": diff})
+		return
+	}
+
+	versions, err := h.Repo.GetWorkflowVersions(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"workflow_id": id, "data": versions})
+}
+
+// Simulate menjalankan dry-run workflow tanpa membuat process_instances.
+// Body (opsional): {"version": 0, "start_node": "mix", "payloads": {"mix": {"qc_result": "fail"}}}; version 0 = draft.
+// Endpoint: POST /api/workflows/:id/simulate
+func (h *WorkflowHandler) Simulate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID Workflow harus angka"})
+		return
+	}
+
+	var req struct {
+		Version int `json:"version"`
+		workflow.SimulationInput
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Layout updated"})
-}
\ No newline at end of file
+	result, err := h.Repo.SimulateWorkflow(id, req.Version, req.SimulationInput)
+	if errors.Is(err, repository.ErrWorkflowNotFound) || errors.Is(err, repository.ErrWorkflowVersionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Simulasi gagal: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"workflow_id": id, "version": req.Version, "data": result})
+}
+
+// validCanvas memeriksa canvas_config dan menulis 400/422 beserta daftar masalahnya jika tidak valid
+func (h *WorkflowHandler) validCanvas(c *gin.Context, raw []byte) bool {
+	problems, err := h.Repo.CheckCanvas(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    "Workflow tidak valid",
+			"problems": problems,
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package imaging
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// iconColors memberi warna label ikon per jenis file
+var iconColors = map[string]string{
+	"PDF":  "#d93025",
+	"XLSX": "#188038",
+	"CSV":  "#188038",
+	"DOCX": "#1a73e8",
+	"PPTX": "#e8710a",
+	"IMG":  "#9334e6",
+}
+
+// Icon membuat ikon SVG generik untuk file yang tidak punya thumbnail (PDF, dokumen, atau gambar
+// yang tidak bisa di-decode). Label diambil dari jenis file, misalnya "PDF" atau "XLSX".
+func Icon(mimeType, filename string) []byte {
+	// Label hanya huruf/angka dari ekstensi supaya aman disisipkan ke SVG
+	label := strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, strings.ToUpper(filepath.Ext(filename)))
+	switch {
+	case mimeType == "application/pdf":
+		label = "PDF"
+	case strings.HasPrefix(mimeType, "image/"):
+		label = "IMG"
+	case label == "" || len(label) > 4:
+		label = "FILE"
+	}
+	color, ok := iconColors[label]
+	if !ok {
+		color = "#5f6368"
+	}
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="200" height="200" viewBox="0 0 200 200">`+
+		`<path d="M50 20h70l40 40v120H50z" fill="#f1f3f4" stroke="#9aa0a6" stroke-width="4"/>`+
+		`<path d="M120 20v40h40" fill="none" stroke="#9aa0a6" stroke-width="4"/>`+
+		`<rect x="30" y="110" width="110" height="44" rx="6" fill="%s"/>`+
+		`<text x="85" y="140" font-family="sans-serif" font-size="24" font-weight="bold" fill="#fff" text-anchor="middle">%s</text>`+
+		`</svg>`, color, label))
+}
@@ -0,0 +1,371 @@
+// Package imaging membersihkan metadata lokasi foto lampiran (JPEG, PNG, GIF, WebP)
+// dan membuat thumbnail-nya.
+// Thumbnail hanya memakai decoder standar Go (JPEG, PNG, GIF); tipe lain tidak dibuatkan thumbnail.
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	ErrCorrupt     = errors.New("corrupt image file")
+	ErrCannotClean = errors.New("image type cannot be cleaned of location data")
+)
+
+// StripLocation menghapus data lokasi dari file gambar: GPS di EXIF dan blok XMP
+// (yang juga bisa berisi koordinat). Data EXIF lain (kamera, waktu, orientasi) dibiarkan,
+// kecuali di WebP yang chunk EXIF-nya dibuang utuh. Tipe gambar lain ditolak dengan
+// ErrCannotClean supaya tidak ada gambar yang tersimpan tanpa dibersihkan.
+// orientation adalah nilai EXIF Orientation (1-8) untuk JPEG, 1 jika tidak ada.
+func StripLocation(data []byte, mimeType string) (clean []byte, orientation int, err error) {
+	switch mimeType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		clean, err := stripPNG(data)
+		return clean, 1, err
+	case "image/gif":
+		clean, err := stripGIF(data)
+		return clean, 1, err
+	case "image/webp":
+		clean, err := stripWebP(data)
+		return clean, 1, err
+	}
+	return nil, 1, ErrCannotClean
+}
+
+var (
+	exifHeader    = []byte("Exif\x00\x00")
+	xmpHeader     = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtHeader  = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	pngXMPKeyword = []byte("XML:com.adobe.xmp\x00")
+)
+
+// gifKeptApplications adalah application extension GIF yang disimpan (pengaturan animasi
+// dan profil warna); application extension lain (misal "XMP DataXMP") dibuang
+var gifKeptApplications = map[string]bool{
+	"NETSCAPE2.0": true,
+	"ANIMEXTS1.0": true,
+	"ICCRGBG1012": true,
+}
+
+// stripJPEG menyalin segmen JPEG satu per satu: segmen EXIF dibersihkan dari GPS,
+// segmen XMP dibuang, sisanya (termasuk data gambar setelah SOS) disalin apa adanya
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 1, ErrCorrupt
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	orientation := 1
+
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xFF {
+			return nil, 1, ErrCorrupt
+		}
+		for i < len(data) && data[i] == 0xFF { // byte pengisi sebelum marker
+			i++
+		}
+		if i >= len(data) {
+			return nil, 1, ErrCorrupt
+		}
+		marker := data[i]
+		i++
+
+		// Marker tanpa panjang
+		if marker == 0xD9 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, 0xFF, marker)
+			if marker == 0xD9 {
+				return out, orientation, nil
+			}
+			continue
+		}
+
+		if i+2 > len(data) {
+			return nil, 1, ErrCorrupt
+		}
+		segLen := int(binary.BigEndian.Uint16(data[i:]))
+		if segLen < 2 || i+segLen > len(data) {
+			return nil, 1, ErrCorrupt
+		}
+		seg := data[i+2 : i+segLen]
+		i += segLen
+
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(seg, exifHeader):
+			tiff := append([]byte(nil), seg[len(exifHeader):]...)
+			o, ok := scrubEXIF(tiff)
+			if !ok {
+				// EXIF yang tidak bisa dibaca dibuang seluruhnya supaya GPS pasti ikut hilang
+				continue
+			}
+			orientation = o
+			out = appendSegment(out, marker, append(append([]byte(nil), exifHeader...), tiff...))
+		case marker == 0xE1 && (bytes.HasPrefix(seg, xmpHeader) || bytes.HasPrefix(seg, xmpExtHeader)):
+			continue
+		default:
+			out = appendSegment(out, marker, seg)
+		}
+
+		if marker == 0xDA {
+			// Setelah SOS adalah data gambar sampai akhir file
+			out = append(out, data[i:]...)
+			return out, orientation, nil
+		}
+	}
+	return nil, 1, ErrCorrupt
+}
+
+func appendSegment(out []byte, marker byte, payload []byte) []byte {
+	out = append(out, 0xFF, marker)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(payload)+2))
+	return append(out, payload...)
+}
+
+// Tag EXIF yang dipakai
+const (
+	tagOrientation = 0x0112
+	tagGPSPointer  = 0x8825
+)
+
+// exifTypeSizes adalah ukuran byte per nilai untuk setiap tipe data TIFF
+var exifTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// scrubEXIF mengosongkan GPS IFD (entry dan nilainya ditimpa nol) langsung di dalam tiff.
+// Offset lain tidak berubah sehingga sisa EXIF tetap valid. ok false jika struktur EXIF rusak.
+func scrubEXIF(tiff []byte) (orientation int, ok bool) {
+	if len(tiff) < 8 {
+		return 1, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 1, false
+	}
+
+	orientation = 1
+	ifd0 := order.Uint32(tiff[4:])
+	entries, ok := ifdEntries(tiff, order, ifd0)
+	if !ok {
+		return 1, false
+	}
+	for _, e := range entries {
+		switch order.Uint16(tiff[e:]) {
+		case tagOrientation:
+			if v := int(order.Uint16(tiff[e+8:])); v >= 1 && v <= 8 {
+				orientation = v
+			}
+		case tagGPSPointer:
+			if !zeroIFD(tiff, order, order.Uint32(tiff[e+8:])) {
+				return 1, false
+			}
+		}
+	}
+	return orientation, true
+}
+
+// ifdEntries mengembalikan offset setiap entry (12 byte) di IFD pada offset off
+func ifdEntries(tiff []byte, order binary.ByteOrder, off uint32) ([]uint32, bool) {
+	if uint64(off)+2 > uint64(len(tiff)) {
+		return nil, false
+	}
+	n := uint32(order.Uint16(tiff[off:]))
+	if uint64(off)+2+uint64(n)*12 > uint64(len(tiff)) {
+		return nil, false
+	}
+	entries := make([]uint32, n)
+	for k := uint32(0); k < n; k++ {
+		entries[k] = off + 2 + k*12
+	}
+	return entries, true
+}
+
+// zeroIFD menimpa nilai di luar entry, lalu semua entry dan jumlahnya dengan nol
+// (IFD kosong masih valid bagi pembaca EXIF)
+func zeroIFD(tiff []byte, order binary.ByteOrder, off uint32) bool {
+	entries, ok := ifdEntries(tiff, order, off)
+	if !ok {
+		return false
+	}
+	for _, e := range entries {
+		size := uint64(exifTypeSizes[order.Uint16(tiff[e+2:])]) * uint64(order.Uint32(tiff[e+4:]))
+		if size <= 4 {
+			continue
+		}
+		valOff := uint64(order.Uint32(tiff[e+8:]))
+		if valOff+size > uint64(len(tiff)) {
+			return false
+		}
+		clear(tiff[valOff : valOff+size])
+	}
+	end := off + 2 + uint32(len(entries))*12
+	if uint64(end)+4 <= uint64(len(tiff)) {
+		end += 4 // offset IFD berikutnya
+	}
+	clear(tiff[off:end])
+	return true
+}
+
+// stripPNG membuang chunk eXIf dan XMP (iTXt "XML:com.adobe.xmp"); chunk lain disalin apa adanya
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrCorrupt
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	i := len(pngSignature)
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, ErrCorrupt
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		chunkType := string(data[i+4 : i+8])
+		end := i + 12 + length // panjang + tipe + data + CRC
+		if length < 0 || end > len(data) {
+			return nil, ErrCorrupt
+		}
+		body := data[i+8 : i+8+length]
+		drop := chunkType == "eXIf" || (chunkType == "iTXt" && bytes.HasPrefix(body, pngXMPKeyword))
+		if !drop {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+		if chunkType == "IEND" {
+			return out, nil
+		}
+	}
+	return nil, ErrCorrupt
+}
+
+// stripGIF membuang comment extension dan application extension selain gifKeptApplications;
+// blok lain (palet, frame, graphic control) disalin apa adanya
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, ErrCorrupt
+	}
+	i := 13 // header + logical screen descriptor
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1) // global color table
+	}
+	if i > len(data) {
+		return nil, ErrCorrupt
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:i]...)
+
+	for i < len(data) {
+		start := i
+		switch data[i] {
+		case 0x3B: // trailer
+			return append(out, 0x3B), nil
+		case 0x21: // extension: label lalu sub-block
+			if i+2 > len(data) {
+				return nil, ErrCorrupt
+			}
+			label := data[i+1]
+			end, ok := skipSubBlocks(data, i+2)
+			if !ok {
+				return nil, ErrCorrupt
+			}
+			i = end
+			if label == 0xFE {
+				continue
+			}
+			if label == 0xFF {
+				if start+3+11 > end || data[start+2] != 11 || !gifKeptApplications[string(data[start+3:start+14])] {
+					continue
+				}
+			}
+			out = append(out, data[start:end]...)
+		case 0x2C: // image descriptor, local color table, ukuran kode LZW, data gambar
+			if i+10 > len(data) {
+				return nil, ErrCorrupt
+			}
+			i += 10
+			if data[start+9]&0x80 != 0 {
+				i += 3 << (data[start+9]&0x07 + 1)
+			}
+			end, ok := skipSubBlocks(data, i+1)
+			if !ok {
+				return nil, ErrCorrupt
+			}
+			i = end
+			out = append(out, data[start:end]...)
+		default:
+			return nil, ErrCorrupt
+		}
+	}
+	return nil, ErrCorrupt
+}
+
+// skipSubBlocks melewati rangkaian sub-block GIF (panjang 1 byte + isi) sampai block terminator
+// dan mengembalikan posisi setelah terminator
+func skipSubBlocks(data []byte, i int) (int, bool) {
+	for i < len(data) {
+		n := int(data[i])
+		i++
+		if n == 0 {
+			return i, true
+		}
+		i += n
+	}
+	return 0, false
+}
+
+// WebP extended format: flag EXIF dan XMP di byte pertama payload chunk VP8X
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// stripWebP membuang chunk RIFF "EXIF" dan "XMP " lalu mematikan flag-nya di VP8X dan
+// memperbarui ukuran RIFF; chunk lain (gambar, alpha, animasi, ICC) disalin apa adanya
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrCorrupt
+	}
+	riffEnd := 8 + uint64(binary.LittleEndian.Uint32(data[4:]))
+	if riffEnd > uint64(len(data)) {
+		return nil, ErrCorrupt
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+
+	vp8x := -1
+	for i := uint64(12); i < riffEnd; {
+		if i+8 > riffEnd {
+			return nil, ErrCorrupt
+		}
+		fourCC := string(data[i : i+4])
+		size := uint64(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2 // chunk berukuran ganjil diberi 1 byte padding
+		if end > riffEnd {
+			return nil, ErrCorrupt
+		}
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			if size < 10 {
+				return nil, ErrCorrupt
+			}
+			vp8x = len(out) + 8
+			out = append(out, data[i:end]...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	if vp8x >= 0 {
+		out[vp8x] &^= webpFlagEXIF | webpFlagXMP
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
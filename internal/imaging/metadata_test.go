@@ -0,0 +1,356 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// gpsRational adalah GPSLatitude contoh (6° 12' 34.56") yang tidak boleh tersisa setelah dibersihkan
+var gpsRational = []uint32{6, 1, 12, 1, 3456, 100}
+
+// testEXIF menyusun TIFF little-endian: IFD0 berisi Orientation dan pointer ke GPS IFD,
+// GPS IFD berisi GPSLatitudeRef dan GPSLatitude (nilainya di luar entry).
+// keepLen adalah panjang bagian yang harus tetap utuh (header + IFD0).
+func testEXIF(orientation uint16, gpsOffset uint32) (tiff []byte, keepLen int) {
+	le := binary.LittleEndian
+	tiff = []byte("II*\x00")
+	tiff = le.AppendUint32(tiff, 8)
+
+	// IFD0 di offset 8
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = appendEntry(tiff, tagOrientation, 3, 1, uint32(orientation))
+	tiff = appendEntry(tiff, tagGPSPointer, 4, 1, gpsOffset)
+	tiff = le.AppendUint32(tiff, 0)
+	keepLen = len(tiff) // 38
+
+	// GPS IFD di offset 38, nilai GPSLatitude di offset 68
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = appendEntry(tiff, 1, 2, 2, uint32('S'))
+	tiff = appendEntry(tiff, 2, 5, 3, 68)
+	tiff = le.AppendUint32(tiff, 0)
+	for _, v := range gpsRational {
+		tiff = le.AppendUint32(tiff, v)
+	}
+	return tiff, keepLen
+}
+
+func appendEntry(b []byte, tag, typ uint16, count, value uint32) []byte {
+	le := binary.LittleEndian
+	b = le.AppendUint16(b, tag)
+	b = le.AppendUint16(b, typ)
+	b = le.AppendUint32(b, count)
+	return le.AppendUint32(b, value)
+}
+
+func testImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 30), uint8(y * 40), 200, 255})
+		}
+	}
+	return img
+}
+
+// withSegments menyisipkan segmen APPn tepat setelah SOI
+func withSegments(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+	out := append([]byte(nil), plain[:2]...)
+	for _, seg := range segments {
+		out = appendSegment(out, 0xE1, seg)
+	}
+	return append(out, plain[2:]...)
+}
+
+// exifSegment mengembalikan isi TIFF dari segmen EXIF pertama di JPEG (nil jika tidak ada)
+func exifSegment(data []byte) []byte {
+	i := bytes.Index(data, exifHeader)
+	if i < 0 {
+		return nil
+	}
+	segLen := int(binary.BigEndian.Uint16(data[i-2:]))
+	return data[i+len(exifHeader) : i-2+segLen]
+}
+
+func TestStripJPEG(t *testing.T) {
+	tiff, keepLen := testEXIF(6, 38)
+	exif := append(append([]byte(nil), exifHeader...), tiff...)
+	xmp := append(append([]byte(nil), xmpHeader...), []byte(`<x:xmpmeta><exif:GPSLatitude>6,12.576S</exif:GPSLatitude></x:xmpmeta>`)...)
+	brokenTIFF, _ := testEXIF(3, 5000) // pointer GPS di luar data
+	broken := append(append([]byte(nil), exifHeader...), brokenTIFF...)
+
+	tests := []struct {
+		name            string
+		data            []byte
+		wantOrientation int
+		wantEXIF        bool
+	}{
+		{"tanpa metadata", withSegments(t), 1, false},
+		{"EXIF dengan GPS dan orientasi", withSegments(t, exif), 6, true},
+		{"EXIF dan XMP", withSegments(t, exif, xmp), 6, true},
+		{"EXIF rusak dibuang utuh", withSegments(t, broken, xmp), 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clean, orientation, err := StripLocation(tt.data, "image/jpeg")
+			if err != nil {
+				t.Fatalf("StripLocation: %v", err)
+			}
+			if orientation != tt.wantOrientation {
+				t.Errorf("orientation = %d, want %d", orientation, tt.wantOrientation)
+			}
+			if bytes.Contains(clean, xmpHeader) {
+				t.Error("segmen XMP masih ada")
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(clean)); err != nil {
+				t.Fatalf("hasil tidak bisa di-decode: %v", err)
+			}
+
+			got := exifSegment(clean)
+			if !tt.wantEXIF {
+				if got != nil {
+					t.Fatal("segmen EXIF seharusnya dibuang")
+				}
+				return
+			}
+			if len(got) != len(tiff) {
+				t.Fatalf("panjang EXIF berubah: %d, want %d", len(got), len(tiff))
+			}
+			if !bytes.Equal(got[:keepLen], tiff[:keepLen]) {
+				t.Error("IFD0 ikut berubah")
+			}
+			if !bytes.Equal(got[keepLen:], make([]byte, len(tiff)-keepLen)) {
+				t.Errorf("GPS IFD belum bersih: % x", got[keepLen:])
+			}
+		})
+	}
+}
+
+func TestStripJPEGCorrupt(t *testing.T) {
+	valid := withSegments(t)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"bukan JPEG", []byte("GIF89a....")},
+		{"terpotong di tengah segmen", valid[:30]},
+		{"panjang segmen tidak valid", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := StripLocation(tt.data, "image/jpeg"); !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("err = %v, want ErrCorrupt", err)
+			}
+		})
+	}
+}
+
+func pngChunk(chunkType string, body []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(body)))
+	b = append(b, chunkType...)
+	b = append(b, body...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[4:]))
+}
+
+// pngChunkTypes mengembalikan urutan tipe chunk di file PNG
+func pngChunkTypes(data []byte) []string {
+	var types []string
+	for i := len(pngSignature); i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		types = append(types, string(data[i+4:i+8]))
+		i += 12 + length
+	}
+	return types
+}
+
+func TestStripPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+	ihdrEnd := len(pngSignature) + 12 + 13
+
+	tiff, _ := testEXIF(1, 38)
+	var data []byte
+	data = append(data, plain[:ihdrEnd]...)
+	data = append(data, pngChunk("eXIf", tiff)...)
+	data = append(data, pngChunk("iTXt", append(append([]byte(nil), pngXMPKeyword...), "\x00\x00\x00\x00<x:xmpmeta/>"...))...)
+	data = append(data, pngChunk("tEXt", []byte("Comment\x00oven 2"))...)
+	data = append(data, plain[ihdrEnd:]...)
+
+	clean, orientation, err := StripLocation(data, "image/png")
+	if err != nil {
+		t.Fatalf("StripLocation: %v", err)
+	}
+	if orientation != 1 {
+		t.Errorf("orientation = %d, want 1", orientation)
+	}
+	got := pngChunkTypes(clean)
+	want := append([]string{"IHDR", "tEXt"}, pngChunkTypes(plain)[1:]...)
+	if len(got) != len(want) {
+		t.Fatalf("chunk = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("chunk = %v, want %v", got, want)
+		}
+	}
+	if _, err := png.Decode(bytes.NewReader(clean)); err != nil {
+		t.Fatalf("hasil tidak bisa di-decode: %v", err)
+	}
+
+	if _, _, err := StripLocation(data[:len(data)-20], "image/png"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("PNG terpotong: err = %v, want ErrCorrupt", err)
+	}
+}
+
+// gifExtension menyusun extension GIF dengan isi yang dipecah per sub-block 255 byte
+func gifExtension(label byte, blocks ...[]byte) []byte {
+	b := []byte{0x21, label}
+	for _, block := range blocks {
+		b = append(b, byte(len(block)))
+		b = append(b, block...)
+	}
+	return append(b, 0)
+}
+
+func TestStripGIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+	headerEnd := 13
+	if plain[10]&0x80 != 0 {
+		headerEnd += 3 << (plain[10]&0x07 + 1)
+	}
+
+	netscape := gifExtension(0xFF, []byte("NETSCAPE2.0"), []byte{1, 0, 0})
+	xmp := gifExtension(0xFF, []byte("XMP DataXMP"), []byte("<x:xmpmeta><exif:GPSLatitude>6,12.576S</exif:GPSLatitude>"))
+	comment := gifExtension(0xFE, []byte("lokasi: -6.2088,106.8456"))
+
+	var data []byte
+	data = append(data, plain[:headerEnd]...)
+	data = append(data, netscape...)
+	data = append(data, xmp...)
+	data = append(data, comment...)
+	data = append(data, plain[headerEnd:]...)
+
+	clean, _, err := StripLocation(data, "image/gif")
+	if err != nil {
+		t.Fatalf("StripLocation: %v", err)
+	}
+	want := append(append(append([]byte(nil), plain[:headerEnd]...), netscape...), plain[headerEnd:]...)
+	if !bytes.Equal(clean, want) {
+		t.Fatalf("hasil tidak sama dengan GIF asli + NETSCAPE2.0 (%d byte, want %d)", len(clean), len(want))
+	}
+	if _, err := gif.Decode(bytes.NewReader(clean)); err != nil {
+		t.Fatalf("hasil tidak bisa di-decode: %v", err)
+	}
+
+	if _, _, err := StripLocation(data[:len(data)-1], "image/gif"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("GIF tanpa trailer: err = %v, want ErrCorrupt", err)
+	}
+}
+
+func riffChunk(fourCC string, body []byte) []byte {
+	b := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	b = append(b, body...)
+	if len(body)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func webpFile(chunks ...[]byte) []byte {
+	var body []byte
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	out := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(4+len(body)))...)
+	out = append(out, "WEBP"...)
+	return append(out, body...)
+}
+
+func TestStripWebP(t *testing.T) {
+	tiff, _ := testEXIF(6, 38)
+	vp8x := func(flags byte) []byte {
+		return riffChunk("VP8X", []byte{flags, 0, 0, 0, 7, 0, 0, 5, 0, 0})
+	}
+	image := riffChunk("VP8L", []byte{0x2F, 7, 0x40, 1, 0}) // ukuran ganjil, ada padding
+	alpha := riffChunk("ALPH", []byte{0, 1, 2, 3})
+	exif := riffChunk("EXIF", tiff)
+	xmp := riffChunk("XMP ", []byte("<x:xmpmeta>GPS</x:xmpmeta>"))
+
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte
+	}{
+		{"format extended dengan EXIF dan XMP", webpFile(vp8x(0x1C), alpha, image, exif, xmp), webpFile(vp8x(0x10), alpha, image)},
+		{"hanya XMP", webpFile(vp8x(0x04), image, xmp), webpFile(vp8x(0x00), image)},
+		{"tanpa metadata tidak berubah", webpFile(vp8x(0x10), alpha, image), webpFile(vp8x(0x10), alpha, image)},
+		{"format sederhana", webpFile(image), webpFile(image)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clean, orientation, err := StripLocation(tt.in, "image/webp")
+			if err != nil {
+				t.Fatalf("StripLocation: %v", err)
+			}
+			if orientation != 1 {
+				t.Errorf("orientation = %d, want 1", orientation)
+			}
+			if !bytes.Equal(clean, tt.want) {
+				t.Fatalf("hasil:\n% x\nwant:\n% x", clean, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripWebPCorrupt(t *testing.T) {
+	valid := webpFile(riffChunk("VP8L", []byte{0x2F, 7, 0x40, 1, 0}))
+	oversized := append([]byte(nil), valid...)
+	binary.LittleEndian.PutUint32(oversized[16:], 1000) // ukuran chunk melebihi file
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"bukan RIFF", []byte("GIF89a.........")},
+		{"RIFF bukan WEBP", append([]byte("RIFF\x04\x00\x00\x00WAVE"), 0)},
+		{"ukuran RIFF melebihi file", valid[:len(valid)-2]},
+		{"ukuran chunk melebihi RIFF", oversized},
+		{"VP8X terlalu pendek", webpFile(riffChunk("VP8X", []byte{0x08, 0}))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := StripLocation(tt.data, "image/webp"); !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("err = %v, want ErrCorrupt", err)
+			}
+		})
+	}
+}
+
+func TestStripLocationUnknownImageFailsClosed(t *testing.T) {
+	for _, mimeType := range []string{"image/bmp", "image/tiff", "image/heic", "image/svg+xml"} {
+		clean, _, err := StripLocation([]byte("data"), mimeType)
+		if !errors.Is(err, ErrCannotClean) || clean != nil {
+			t.Errorf("%s: clean = %v, err = %v, want ErrCannotClean", mimeType, clean, err)
+		}
+	}
+}
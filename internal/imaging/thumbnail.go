@@ -0,0 +1,174 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+var ErrUnsupported = errors.New("image type not supported for thumbnails")
+
+// maxPixels membatasi ukuran gambar yang mau di-decode (mencegah decompression bomb)
+const maxPixels = 50_000_000
+
+// Size adalah ukuran thumbnail: sisi terpanjang maksimal MaxSide piksel
+type Size struct {
+	Name    string
+	MaxSide int
+}
+
+// Sizes adalah thumbnail yang dibuat untuk setiap gambar: sm untuk daftar, md untuk preview
+var Sizes = []Size{
+	{Name: "sm", MaxSide: 200},
+	{Name: "md", MaxSide: 800},
+}
+
+// Thumbnail adalah hasil resize yang siap disimpan
+type Thumbnail struct {
+	Size     string
+	Data     []byte
+	MimeType string
+	Width    int
+	Height   int
+}
+
+// CanThumbnail mengecek apakah tipe file bisa dibuatkan thumbnail
+func CanThumbnail(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Thumbnails men-decode gambar sekali lalu membuat semua ukuran di Sizes.
+// orientation (EXIF 1-8) diterapkan supaya foto dari ponsel tidak tampil miring.
+// Gambar yang lebih kecil dari ukuran thumbnail tidak diperbesar.
+// JPEG menghasilkan thumbnail JPEG, tipe lain PNG (supaya transparansi tetap ada).
+func Thumbnails(data []byte, mimeType string, orientation int) ([]Thumbnail, error) {
+	if !CanThumbnail(mimeType) {
+		return nil, ErrUnsupported
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrUnsupported
+	}
+
+	var src image.Image
+	switch mimeType {
+	case "image/jpeg":
+		src, err = jpeg.Decode(bytes.NewReader(data))
+	case "image/png":
+		src, err = png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		src, err = gif.Decode(bytes.NewReader(data)) // frame pertama
+	}
+	if err != nil {
+		return nil, err
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	thumbs := make([]Thumbnail, 0, len(Sizes))
+	for _, size := range Sizes {
+		img := orient(downscale(rgba, size.MaxSide), orientation)
+		var buf bytes.Buffer
+		outType := "image/png"
+		if mimeType == "image/jpeg" {
+			outType = "image/jpeg"
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80})
+		} else {
+			err = png.Encode(&buf, img)
+		}
+		if err != nil {
+			return nil, err
+		}
+		thumbs = append(thumbs, Thumbnail{
+			Size:     size.Name,
+			Data:     buf.Bytes(),
+			MimeType: outType,
+			Width:    img.Bounds().Dx(),
+			Height:   img.Bounds().Dy(),
+		})
+	}
+	return thumbs, nil
+}
+
+// downscale mengecilkan gambar dengan rata-rata area (box filter) sampai sisi terpanjangnya maxSide
+func downscale(src *image.RGBA, maxSide int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= maxSide && sh <= maxSide {
+		return src
+	}
+	dw, dh := maxSide, sh*maxSide/sw
+	if sh > sw {
+		dw, dh = sw*maxSide/sh, maxSide
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// orient memutar/membalik gambar sesuai nilai EXIF Orientation
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 { // 5-8 menukar lebar dan tinggi
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // cermin horizontal
+				dx, dy = w-1-x, y
+			case 3: // putar 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // cermin vertikal
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // putar 90 searah jarum jam
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // putar 90 berlawanan jarum jam
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[y*src.Stride+x*4:y*src.Stride+x*4+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,53 @@
+package imaging
+
+import (
+	"image"
+	"testing"
+)
+
+func TestOrient(t *testing.T) {
+	// Gambar 3x2 dengan label per piksel:
+	//   a b c
+	//   d e f
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i, label := range "abcdef" {
+		src.Pix[i*4] = byte(label)
+	}
+
+	tests := []struct {
+		orientation int
+		want        []string // baris hasil, dibaca dari atas
+	}{
+		{0, []string{"abc", "def"}},
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}},
+		{3, []string{"fed", "cba"}},
+		{4, []string{"def", "abc"}},
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"da", "eb", "fc"}},
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"cf", "be", "ad"}},
+		{9, []string{"abc", "def"}},
+	}
+	for _, tt := range tests {
+		dst := orient(src, tt.orientation)
+		var rows []string
+		for y := 0; y < dst.Bounds().Dy(); y++ {
+			row := make([]byte, dst.Bounds().Dx())
+			for x := range row {
+				row[x] = dst.Pix[y*dst.Stride+x*4]
+			}
+			rows = append(rows, string(row))
+		}
+		if len(rows) != len(tt.want) {
+			t.Errorf("orientation %d: %v, want %v", tt.orientation, rows, tt.want)
+			continue
+		}
+		for i := range rows {
+			if rows[i] != tt.want[i] {
+				t.Errorf("orientation %d: %v, want %v", tt.orientation, rows, tt.want)
+				break
+			}
+		}
+	}
+}
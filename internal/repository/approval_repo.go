@@ -0,0 +1,345 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pt-besq-core/internal/database"
+	"pt-besq-core/internal/entity"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrInvalidApprovalPolicy = errors.New("invalid approval policy")
+	ErrNotApprover           = errors.New("user cannot sign any pending approval step")
+	ErrAlreadySigned         = errors.New("user already signed another approval step")
+	ErrApprovalRequired      = errors.New("instance must be completed through its approval chain")
+)
+
+// Mode penandatanganan rantai approval
+const (
+	ApprovalOrdered  = "ordered"
+	ApprovalParallel = "parallel"
+)
+
+// defaultApprovalStep dipakai template yang belum punya rantai approval: cukup satu supervisor
+// (atau admin, lihat canSign)
+var defaultApprovalStep = entity.ApprovalStep{ID: 0, StepOrder: 1, Name: "Supervisor", Role: "supervisor"}
+
+// ApprovalStepStatus adalah satu langkah approval beserta keputusan di putaran saat ini
+type ApprovalStepStatus struct {
+	entity.ApprovalStep
+	Decision      string     `json:"decision"` // pending, approved, rejected
+	DecidedBy     *int       `json:"decided_by,omitempty"`
+	DecidedByName string     `json:"decided_by_name,omitempty"`
+	Comment       string     `json:"comment,omitempty"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+}
+
+type approvalStepRow struct {
+	entity.ApprovalStep
+	UserIDsRaw sql.NullString `db:"user_ids"`
+}
+
+// GetApprovalPolicy mengambil rantai approval sebuah template.
+// Template tanpa langkah approval mengembalikan policy dengan Steps kosong.
+func GetApprovalPolicy(templateID int) (*entity.ApprovalPolicy, error) {
+	return loadApprovalPolicy(database.DB, templateID)
+}
+
+func loadApprovalPolicy(q sqlx.Queryer, templateID int) (*entity.ApprovalPolicy, error) {
+	policy := &entity.ApprovalPolicy{TemplateID: templateID, Steps: []entity.ApprovalStep{}}
+	err := sqlx.Get(q, &policy.Mode, "SELECT COALESCE(approval_mode, 'ordered') FROM process_templates WHERE id = ? AND is_active = 1", templateID)
+	if err == sql.ErrNoRows {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []approvalStepRow
+	err = sqlx.Select(q, &rows, `
+		SELECT id, step_order, name, COALESCE(role, '') as role, user_ids
+		FROM template_approval_steps
+		WHERE template_id = ?
+		ORDER BY step_order ASC
+	`, templateID)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		step := row.ApprovalStep
+		if row.UserIDsRaw.Valid && row.UserIDsRaw.String != "" {
+			if err := json.Unmarshal([]byte(row.UserIDsRaw.String), &step.UserIDs); err != nil {
+				return nil, fmt.Errorf("user_ids langkah approval '%s' rusak: %w", step.Name, err)
+			}
+		}
+		policy.Steps = append(policy.Steps, step)
+	}
+	return policy, nil
+}
+
+// CheckApprovalPolicy memeriksa isi policy sebelum disimpan
+func CheckApprovalPolicy(policy entity.ApprovalPolicy) error {
+	if policy.Mode != ApprovalOrdered && policy.Mode != ApprovalParallel {
+		return fmt.Errorf("%w: mode harus '%s' atau '%s'", ErrInvalidApprovalPolicy, ApprovalOrdered, ApprovalParallel)
+	}
+	names := map[string]bool{}
+	for i, step := range policy.Steps {
+		name := strings.TrimSpace(step.Name)
+		if name == "" {
+			return fmt.Errorf("%w: langkah #%d belum diberi nama", ErrInvalidApprovalPolicy, i+1)
+		}
+		if names[strings.ToLower(name)] {
+			return fmt.Errorf("%w: nama langkah '%s' dipakai lebih dari sekali", ErrInvalidApprovalPolicy, name)
+		}
+		names[strings.ToLower(name)] = true
+		if step.Role == "" && len(step.UserIDs) == 0 {
+			return fmt.Errorf("%w: langkah '%s' harus diikat ke role atau user", ErrInvalidApprovalPolicy, name)
+		}
+		switch step.Role {
+		case "", "admin", "operator", "supervisor":
+		default:
+			return fmt.Errorf("%w: role '%s' di langkah '%s' tidak bisa menandatangani", ErrInvalidApprovalPolicy, step.Role, name)
+		}
+	}
+	return nil
+}
+
+// SaveApprovalPolicy mengganti rantai approval sebuah template. Langkah disimpan sesuai urutan
+// di policy. Instance yang sedang menunggu approval langsung mengikuti langkah baru;
+// tanda tangan untuk langkah lama tidak dihitung lagi.
+func SaveApprovalPolicy(policy entity.ApprovalPolicy) error {
+	if err := CheckApprovalPolicy(policy); err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE process_templates SET approval_mode = ? WHERE id = ? AND is_active = 1", policy.Mode, policy.TemplateID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// RowsAffected 0 juga terjadi jika mode tidak berubah, jadi pastikan templatenya memang ada
+		var exists int
+		if err := tx.Get(&exists, "SELECT COUNT(*) FROM process_templates WHERE id = ? AND is_active = 1", policy.TemplateID); err != nil {
+			return err
+		}
+		if exists == 0 {
+			return ErrTemplateNotFound
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM template_approval_steps WHERE template_id = ?", policy.TemplateID); err != nil {
+		return err
+	}
+	for i, step := range policy.Steps {
+		var userIDs interface{}
+		if len(step.UserIDs) > 0 {
+			raw, _ := json.Marshal(step.UserIDs)
+			userIDs = string(raw)
+		}
+		_, err := tx.Exec(`
+			INSERT INTO template_approval_steps (template_id, step_order, name, role, user_ids, created_at)
+			VALUES (?, ?, ?, ?, ?, NOW())
+		`, policy.TemplateID, i+1, strings.TrimSpace(step.Name), nullableString(step.Role), userIDs)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetApprovalProgress menampilkan status setiap langkah approval instance di putaran saat ini
+func (r *EnhancedInstanceRepository) GetApprovalProgress(instanceID int64) ([]ApprovalStepStatus, error) {
+	var templateID int
+	err := database.DB.Get(&templateID, "SELECT template_id FROM process_instances WHERE id = ?", instanceID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInstanceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	steps, err := approvalSteps(database.DB, templateID)
+	if err != nil {
+		return nil, err
+	}
+	decisions, err := loadDecisions(database.DB, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := make([]ApprovalStepStatus, 0, len(steps))
+	for _, step := range steps {
+		st := ApprovalStepStatus{ApprovalStep: step, Decision: "pending"}
+		if d, ok := decisions[step.ID]; ok {
+			st.Decision = d.Decision
+			st.DecidedBy = d.DecidedBy
+			st.DecidedByName = d.DecidedByName
+			st.Comment = d.Comment
+			st.DecidedAt = &d.DecidedAt
+		}
+		progress = append(progress, st)
+	}
+	return progress, nil
+}
+
+type approvalDecision struct {
+	StepID        int       `db:"step_id"`
+	Decision      string    `db:"decision"`
+	DecidedBy     *int      `db:"decided_by"`
+	DecidedByName string    `db:"decided_by_name"`
+	Comment       string    `db:"comment"`
+	DecidedAt     time.Time `db:"decided_at"`
+}
+
+func loadDecisions(q sqlx.Queryer, instanceID int64) (map[int]approvalDecision, error) {
+	var rows []approvalDecision
+	err := sqlx.Select(q, &rows, `
+		SELECT a.step_id, a.decision, a.decided_by, COALESCE(u.full_name, 'System') as decided_by_name,
+		       COALESCE(a.comment, '') as comment, a.decided_at
+		FROM instance_approvals a
+		LEFT JOIN users u ON a.decided_by = u.id
+		WHERE a.instance_id = ?
+	`, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	decisions := make(map[int]approvalDecision, len(rows))
+	for _, row := range rows {
+		decisions[row.StepID] = row
+	}
+	return decisions, nil
+}
+
+// approvalSteps mengembalikan langkah approval template, atau satu langkah supervisor jika belum diatur
+func approvalSteps(q sqlx.Queryer, templateID int) ([]entity.ApprovalStep, error) {
+	policy, err := loadApprovalPolicy(q, templateID)
+	if err == ErrTemplateNotFound {
+		// Template yang sudah dinonaktifkan tetap bisa menyelesaikan instance lamanya
+		return []entity.ApprovalStep{defaultApprovalStep}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(policy.Steps) == 0 {
+		return []entity.ApprovalStep{defaultApprovalStep}, nil
+	}
+	return policy.Steps, nil
+}
+
+// hasApprovalChain bernilai true jika template punya rantai approval sendiri,
+// sehingga instance-nya hanya bisa completed lewat approval
+func hasApprovalChain(q sqlx.Queryer, instanceID int64) (bool, error) {
+	var count int
+	err := sqlx.Get(q, &count, `
+		SELECT COUNT(*) FROM template_approval_steps s
+		JOIN process_instances i ON i.template_id = s.template_id
+		WHERE i.id = ?
+	`, instanceID)
+	return count > 0, err
+}
+
+// canSign mengecek apakah user boleh menandatangani sebuah langkah. Langkah yang terikat ke role
+// atau ke user tertentu hanya menerima role/user tersebut, termasuk untuk admin. Pengecualiannya
+// defaultApprovalStep: template tanpa rantai approval tetap bisa disetujui admin seperti sebelumnya.
+func canSign(step entity.ApprovalStep, role string, userID int) bool {
+	if step.Role != "" && step.Role == role {
+		return true
+	}
+	if step.ID == defaultApprovalStep.ID && role == "admin" {
+		return true
+	}
+	for _, id := range step.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// approvalTurn adalah langkah yang akan ditandatangani user beserta sisa langkah sesudahnya
+type approvalTurn struct {
+	Step      entity.ApprovalStep
+	Remaining int // langkah yang masih pending setelah langkah ini diputuskan
+	Total     int
+}
+
+// nextApprovalTurn mencari langkah pending yang boleh ditandatangani user.
+// Mode ordered hanya membuka langkah pending pertama; mode parallel membuka semuanya.
+// Satu user (apa pun role-nya) tidak boleh menandatangani dua langkah dalam putaran yang sama.
+func nextApprovalTurn(tx *sqlx.Tx, instanceID int64, role string, userID int) (*approvalTurn, error) {
+	var inst struct {
+		TemplateID int    `db:"template_id"`
+		Mode       string `db:"approval_mode"`
+	}
+	err := tx.Get(&inst, `
+		SELECT i.template_id, COALESCE(t.approval_mode, 'ordered') as approval_mode
+		FROM process_instances i
+		JOIN process_templates t ON i.template_id = t.id
+		WHERE i.id = ?
+	`, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := approvalSteps(tx, inst.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+	decisions, err := loadDecisions(tx, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []entity.ApprovalStep
+	for _, step := range steps {
+		d, decided := decisions[step.ID]
+		if !decided {
+			pending = append(pending, step)
+			continue
+		}
+		if d.DecidedBy != nil && *d.DecidedBy == userID {
+			return nil, fmt.Errorf("%w: '%s'", ErrAlreadySigned, step.Name)
+		}
+	}
+
+	candidates := pending
+	if inst.Mode == ApprovalOrdered && len(pending) > 0 {
+		candidates = pending[:1]
+	}
+	for _, step := range candidates {
+		if canSign(step, role, userID) {
+			return &approvalTurn{Step: step, Remaining: len(pending) - 1, Total: len(steps)}, nil
+		}
+	}
+	if len(candidates) > 0 {
+		names := make([]string, 0, len(candidates))
+		for _, step := range candidates {
+			names = append(names, step.Name)
+		}
+		return nil, fmt.Errorf("%w: menunggu %s", ErrNotApprover, strings.Join(names, ", "))
+	}
+	return nil, ErrNotApprover
+}
+
+// recordDecision menyimpan keputusan satu langkah approval dan menaikkan revision instance,
+// supaya ETag yang dibaca sebelum tanda tangan ini tidak bisa dipakai lagi
+func recordDecision(tx *sqlx.Tx, instanceID int64, step entity.ApprovalStep, decision string, userID int, comment string) error {
+	if _, err := tx.Exec("UPDATE process_instances SET revision = revision + 1, updated_at = NOW() WHERE id = ?", instanceID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		INSERT INTO instance_approvals (instance_id, step_id, step_order, step_name, decision, decided_by, comment, decided_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NOW())
+	`, instanceID, step.ID, step.StepOrder, step.Name, decision, nullableID(userID), comment)
+	return err
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"pt-besq-core/internal/entity"
+	"testing"
+)
+
+func TestCanSign(t *testing.T) {
+	qa := entity.ApprovalStep{ID: 11, StepOrder: 1, Name: "QA", Role: "supervisor"}
+	manager := entity.ApprovalStep{ID: 12, StepOrder: 2, Name: "Manager", UserIDs: []int{5, 6}}
+	tests := []struct {
+		name   string
+		step   entity.ApprovalStep
+		role   string
+		userID int
+		want   bool
+	}{
+		{"langkah default oleh supervisor", defaultApprovalStep, "supervisor", 3, true},
+		{"langkah default oleh admin", defaultApprovalStep, "admin", 1, true},
+		{"langkah default oleh operator", defaultApprovalStep, "operator", 4, false},
+		{"langkah role oleh role yang sama", qa, "supervisor", 3, true},
+		{"langkah role tidak terbuka untuk admin", qa, "admin", 1, false},
+		{"langkah user oleh user terdaftar", manager, "operator", 6, true},
+		{"langkah user tidak terbuka untuk admin", manager, "admin", 1, false},
+		{"langkah user oleh user lain", manager, "supervisor", 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canSign(tt.step, tt.role, tt.userID); got != tt.want {
+				t.Fatalf("canSign = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
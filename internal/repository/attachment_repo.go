@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pt-besq-core/internal/database"
+	"pt-besq-core/internal/entity"
+	"pt-besq-core/internal/validation"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrAttachmentForbidden = errors.New("not allowed to access this attachment")
+	ErrAttachmentInUse     = errors.New("attachment is referenced by instance data")
+)
+
+// defaultMaxUploadSize dipakai jika system_settings.max_file_upload_size kosong atau tidak valid
+const defaultMaxUploadSize int64 = 10 << 20
+
+// AttachmentRepository mengelola metadata file lampiran (isi file ada di storage)
+type AttachmentRepository struct{}
+
+func NewAttachmentRepository() *AttachmentRepository {
+	return &AttachmentRepository{}
+}
+
+// MaxUploadSize membaca batas ukuran upload (byte) dari system_settings
+func (r *AttachmentRepository) MaxUploadSize() (int64, error) {
+	var raw string
+	err := database.DB.Get(&raw, "SELECT COALESCE(setting_value, '') FROM system_settings WHERE setting_key = 'max_file_upload_size'")
+	if err == sql.ErrNoRows {
+		return defaultMaxUploadSize, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || size <= 0 {
+		return defaultMaxUploadSize, nil
+	}
+	return size, nil
+}
+
+// Create menyimpan metadata file yang sudah ditulis ke storage. ID dan CreatedAt diisi dari database.
+// Untuk file milik instance, instance diperiksa ulang (terkunci) supaya tidak ada lampiran baru
+// yang masuk setelah instance di-approve.
+func (r *AttachmentRepository) Create(att *entity.Attachment) error {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if att.InstanceID != nil {
+		if err := checkAttachmentTarget(tx, *att.InstanceID, " FOR UPDATE"); err != nil {
+			return err
+		}
+	}
+	res, err := tx.Exec(`
+		INSERT INTO file_attachments (instance_id, filename, original_filename, file_path, file_size, mime_type, uploaded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, att.InstanceID, att.Filename, att.OriginalFilename, att.FilePath, att.FileSize, att.MimeType, att.UploadedBy)
+	if err != nil {
+		return err
+	}
+	att.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for i := range att.Thumbnails {
+		th := &att.Thumbnails[i]
+		th.AttachmentID = att.ID
+		_, err := tx.Exec(`
+			INSERT INTO attachment_thumbnails (attachment_id, size, file_path, mime_type, width, height)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, th.AttachmentID, th.Size, th.FilePath, th.MimeType, th.Width, th.Height)
+		if err != nil {
+			return err
+		}
+	}
+	if att.Thumbnails == nil {
+		att.Thumbnails = []entity.AttachmentThumbnail{}
+	}
+	if err := tx.Get(&att.CreatedAt, "SELECT created_at FROM file_attachments WHERE id = ?", att.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetByID mengambil metadata satu file lampiran
+func (r *AttachmentRepository) GetByID(id int64) (*entity.Attachment, error) {
+	return getAttachment(database.DB, id, "")
+}
+
+func getAttachment(q sqlx.Queryer, id int64, lock string) (*entity.Attachment, error) {
+	var att entity.Attachment
+	err := sqlx.Get(q, &att, `
+		SELECT
+			f.id, f.instance_id, f.filename, COALESCE(f.original_filename, f.filename) as original_filename,
+			COALESCE(f.file_path, '') as file_path, COALESCE(f.file_size, 0) as file_size,
+			COALESCE(f.mime_type, '') as mime_type, f.uploaded_by,
+			COALESCE(u.full_name, 'System') as uploaded_by_name, f.created_at
+		FROM file_attachments f
+		LEFT JOIN users u ON f.uploaded_by = u.id
+		WHERE f.id = ?
+	`+lock, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	attachments := []entity.Attachment{att}
+	if err := loadThumbnails(q, attachments); err != nil {
+		return nil, err
+	}
+	return &attachments[0], nil
+}
+
+// loadThumbnails mengisi Thumbnails setiap lampiran dengan satu query
+func loadThumbnails(q sqlx.Queryer, attachments []entity.Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(attachments))
+	index := make(map[int64]int, len(attachments))
+	for i := range attachments {
+		ids[i] = attachments[i].ID
+		index[attachments[i].ID] = i
+		attachments[i].Thumbnails = []entity.AttachmentThumbnail{}
+	}
+	query, args, err := sqlx.In(`
+		SELECT attachment_id, size, file_path, mime_type, width, height
+		FROM attachment_thumbnails
+		WHERE attachment_id IN (?)
+		ORDER BY attachment_id, width
+	`, ids)
+	if err != nil {
+		return err
+	}
+	var thumbs []entity.AttachmentThumbnail
+	if err := sqlx.Select(q, &thumbs, query, args...); err != nil {
+		return err
+	}
+	for _, th := range thumbs {
+		att := &attachments[index[th.AttachmentID]]
+		att.Thumbnails = append(att.Thumbnails, th)
+	}
+	return nil
+}
+
+// CheckUploadTarget memastikan instance ada dan masih boleh diberi lampiran baru:
+// belum di-approve dan belum selesai/dibatalkan
+func (r *AttachmentRepository) CheckUploadTarget(instanceID int64) error {
+	return checkAttachmentTarget(database.DB, instanceID, "")
+}
+
+func checkAttachmentTarget(q sqlx.Queryer, instanceID int64, lock string) error {
+	var inst struct {
+		Status     string       `db:"status"`
+		ApprovedAt sql.NullTime `db:"approved_at"`
+	}
+	err := sqlx.Get(q, &inst, "SELECT status, approved_at FROM process_instances WHERE id = ?"+lock, instanceID)
+	if err == sql.ErrNoRows {
+		return ErrInstanceNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if inst.ApprovedAt.Valid || inst.Status == StatusCompleted || inst.Status == StatusCancelled {
+		return ErrInstanceLocked
+	}
+	return nil
+}
+
+// CanRead memeriksa hak membaca file. File yang sudah terikat ke instance mengikuti aturan baca
+// instance tersebut (lihat canReadInstance); upload yang belum terikat hanya oleh pengunggahnya dan admin.
+func (r *AttachmentRepository) CanRead(att *entity.Attachment, userID int, role string) error {
+	if att.InstanceID == nil {
+		if role == "admin" || isUploader(att, userID) {
+			return nil
+		}
+		return ErrAttachmentForbidden
+	}
+	err := canReadInstance(database.DB, *att.InstanceID)
+	if err == ErrInstanceNotFound {
+		return ErrAttachmentForbidden
+	}
+	return err
+}
+
+// Delete menghapus metadata file (thumbnail ikut terhapus) dan mengembalikannya supaya pemanggil
+// bisa menghapus isinya dan thumbnail-nya di storage.
+// Hanya pengunggah, supervisor dan admin yang boleh menghapus. File milik instance hanya bisa dihapus
+// selama instance masih terbuka dan file tidak dirujuk kolom bertipe file di data_payload.
+func (r *AttachmentRepository) Delete(id int64, userID int, role string) (*entity.Attachment, error) {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	att, err := getAttachment(tx, id, " FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	if !isUploader(att, userID) && role != "admin" && (role != "supervisor" || att.InstanceID == nil) {
+		return nil, ErrAttachmentForbidden
+	}
+
+	if att.InstanceID != nil {
+		// Instance dikunci supaya tidak ada edit payload yang merujuk file ini di tengah penghapusan
+		if err := checkAttachmentTarget(tx, *att.InstanceID, " FOR UPDATE"); err != nil {
+			return nil, err
+		}
+		used, err := attachmentReferenced(tx, *att.InstanceID, att.ID)
+		if err != nil {
+			return nil, err
+		}
+		if used {
+			return nil, ErrAttachmentInUse
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM file_attachments WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return att, tx.Commit()
+}
+
+// attachmentReferenced mengecek apakah kolom bertipe file di data_payload instance merujuk file tersebut
+func attachmentReferenced(tx *sqlx.Tx, instanceID, attachmentID int64) (bool, error) {
+	var inst struct {
+		TemplateID      int            `db:"template_id"`
+		TemplateVersion int            `db:"template_version"`
+		Payload         sql.NullString `db:"data_payload"`
+	}
+	err := tx.Get(&inst, `
+		SELECT template_id, COALESCE(template_version, 0) as template_version, data_payload
+		FROM process_instances WHERE id = ?
+	`, instanceID)
+	if err != nil {
+		return false, err
+	}
+	if !inst.Payload.Valid || inst.Payload.String == "" {
+		return false, nil
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(inst.Payload.String), &data); err != nil {
+		return false, fmt.Errorf("data_payload tidak valid: %w", err)
+	}
+	fields, err := GetFieldDefsForVersion(inst.TemplateID, inst.TemplateVersion)
+	if err != nil {
+		return false, err
+	}
+	for _, ref := range validation.FileRefs(data, fields) {
+		if ref == attachmentID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func isUploader(att *entity.Attachment, userID int) bool {
+	return att.UploadedBy != nil && *att.UploadedBy == userID && userID != 0
+}
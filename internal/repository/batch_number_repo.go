@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"pt-besq-core/internal/batchno"
+	"pt-besq-core/internal/database"
+	"pt-besq-core/internal/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrBatchNumberExhausted berarti nomor urut periode ini sudah habis atau terus bentrok
+	// dengan batch_number yang sudah ada
+	ErrBatchNumberExhausted = errors.New("no free batch number")
+	ErrBatchPatternConflict = errors.New("batch number pattern overlaps another template")
+)
+
+// maxBatchNumberAttempts membatasi berapa nomor yang dilewati saat nomor hasil pola sudah dipakai
+// (misalnya setelah pola diganti atau nomor lama diisi manual)
+const maxBatchNumberAttempts = 100
+
+// GetBatchPattern mengambil pola nomor batch template. Template tanpa pola
+// mengembalikan Pattern kosong (instance dibuat tanpa nomor batch).
+func GetBatchPattern(templateID int) (*entity.BatchNumberPattern, error) {
+	if err := checkTemplateExists(database.DB, templateID); err != nil {
+		return nil, err
+	}
+	pattern, err := loadBatchPattern(database.DB, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if pattern == nil {
+		return &entity.BatchNumberPattern{TemplateID: templateID, ResetPeriod: batchno.ResetNever}, nil
+	}
+	return pattern, nil
+}
+
+// loadBatchPattern mengembalikan nil jika template belum punya pola
+func loadBatchPattern(q sqlx.Queryer, templateID int) (*entity.BatchNumberPattern, error) {
+	var pattern entity.BatchNumberPattern
+	err := sqlx.Get(q, &pattern, `
+		SELECT template_id, pattern, reset_period, updated_by, updated_at
+		FROM batch_number_patterns WHERE template_id = ?
+	`, templateID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pattern, nil
+}
+
+func checkTemplateExists(q sqlx.Queryer, templateID int) error {
+	var exists int
+	if err := sqlx.Get(q, &exists, "SELECT COUNT(*) FROM process_templates WHERE id = ? AND is_active = 1", templateID); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// SaveBatchPattern menyimpan pola nomor batch template. Pattern kosong mematikan penomoran otomatis.
+// Nomor urut yang sudah berjalan tidak direset; pola baru melanjutkan dari nomor terakhir di periode yang sama.
+// Pola yang bisa menghasilkan nomor yang sama dengan pola template aktif lain ditolak
+// (ErrBatchPatternConflict), karena batch_number unik di seluruh instance.
+func SaveBatchPattern(pattern entity.BatchNumberPattern) error {
+	if err := checkTemplateExists(database.DB, pattern.TemplateID); err != nil {
+		return err
+	}
+	if pattern.Pattern == "" {
+		_, err := database.DB.Exec("DELETE FROM batch_number_patterns WHERE template_id = ?", pattern.TemplateID)
+		return err
+	}
+	p, err := batchno.Parse(pattern.Pattern, pattern.ResetPeriod)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Pola lain dikunci supaya dua admin tidak bisa menyimpan pola yang saling bentrok bersamaan
+	var others []struct {
+		TemplateID   int    `db:"template_id"`
+		TemplateName string `db:"template_name"`
+		Pattern      string `db:"pattern"`
+		ResetPeriod  string `db:"reset_period"`
+	}
+	err = tx.Select(&others, `
+		SELECT p.template_id, t.name as template_name, p.pattern, p.reset_period
+		FROM batch_number_patterns p
+		JOIN process_templates t ON p.template_id = t.id
+		WHERE p.template_id <> ? AND t.is_active = 1
+		ORDER BY p.template_id
+		FOR UPDATE
+	`, pattern.TemplateID)
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		op, err := batchno.Parse(other.Pattern, other.ResetPeriod)
+		if err != nil {
+			// Pola lama yang sudah tidak valid tidak dipakai untuk membuat nomor
+			continue
+		}
+		if p.Overlaps(op) {
+			return fmt.Errorf("%w: '%s' bisa menghasilkan nomor yang sama dengan pola '%s' milik template '%s'",
+				ErrBatchPatternConflict, pattern.Pattern, other.Pattern, other.TemplateName)
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO batch_number_patterns (template_id, pattern, reset_period, updated_by)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE pattern = VALUES(pattern), reset_period = VALUES(reset_period), updated_by = VALUES(updated_by)
+	`, pattern.TemplateID, pattern.Pattern, pattern.ResetPeriod, pattern.UpdatedBy)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// factoryLocation membaca zona waktu pabrik dari system_settings.timezone. Tanggal di nomor batch
+// dan pergantian periode nomor urut mengikuti zona ini, bukan zona waktu server atau container.
+func factoryLocation(q sqlx.Queryer) (*time.Location, error) {
+	var name string
+	err := sqlx.Get(q, &name, "SELECT COALESCE(setting_value, '') FROM system_settings WHERE setting_key = 'timezone'")
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return batchno.LoadLocation(name)
+}
+
+// PreviewBatchNumbers menampilkan count nomor batch berikutnya untuk pola (boleh belum disimpan)
+// tanpa memakai nomor urutnya. Hasilnya bisa berbeda dengan nomor yang nanti benar-benar dipakai
+// jika ada instance lain yang dibuat lebih dulu.
+func PreviewBatchNumbers(templateID int, pattern, reset string, count int) ([]string, error) {
+	if err := checkTemplateExists(database.DB, templateID); err != nil {
+		return nil, err
+	}
+	p, err := batchno.Parse(pattern, reset)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := factoryLocation(database.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().In(loc)
+	var last int64
+	err = database.DB.Get(&last, `
+		SELECT COALESCE(MAX(last_value), 0) FROM batch_number_sequences WHERE template_id = ? AND period_key = ?
+	`, templateID, p.PeriodKey(now))
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := make([]string, 0, count)
+	for seq := last + 1; seq <= last+int64(count) && seq <= p.MaxSequence(); seq++ {
+		numbers = append(numbers, p.Format(now, seq))
+	}
+	return numbers, nil
+}
+
+// nextBatchNumber mengambil nomor batch berikutnya di dalam transaksi insert instance.
+// Baris nomor urut terkunci sampai transaksi selesai, jadi dua instance tidak bisa mendapat
+// nomor yang sama, dan nomor kembali ke nilai semula jika insert dibatalkan (tidak ada nomor yang bolong).
+// now dikonversi ke zona waktu pabrik sebelum dipakai. Mengembalikan "" jika template tidak punya pola.
+func nextBatchNumber(tx *sqlx.Tx, templateID int, now time.Time) (string, error) {
+	config, err := loadBatchPattern(tx, templateID)
+	if err != nil || config == nil {
+		return "", err
+	}
+	p, err := batchno.Parse(config.Pattern, config.ResetPeriod)
+	if err != nil {
+		return "", fmt.Errorf("pola nomor batch template %d tidak valid: %w", templateID, err)
+	}
+	loc, err := factoryLocation(tx)
+	if err != nil {
+		return "", err
+	}
+	now = now.In(loc)
+	period := p.PeriodKey(now)
+
+	for attempt := 0; attempt < maxBatchNumberAttempts; attempt++ {
+		_, err := tx.Exec(`
+			INSERT INTO batch_number_sequences (template_id, period_key, last_value) VALUES (?, ?, 1)
+			ON DUPLICATE KEY UPDATE last_value = last_value + 1
+		`, templateID, period)
+		if err != nil {
+			return "", err
+		}
+		var seq int64
+		if err := tx.Get(&seq, "SELECT last_value FROM batch_number_sequences WHERE template_id = ? AND period_key = ?", templateID, period); err != nil {
+			return "", err
+		}
+		if seq > p.MaxSequence() {
+			return "", fmt.Errorf("%w: nomor urut template %d periode %s sudah mencapai %d", ErrBatchNumberExhausted, templateID, period, p.MaxSequence())
+		}
+
+		number := p.Format(now, seq)
+		var taken int
+		if err := tx.Get(&taken, "SELECT COUNT(*) FROM process_instances WHERE batch_number = ?", number); err != nil {
+			return "", err
+		}
+		if taken == 0 {
+			return number, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %d nomor berturut-turut untuk template %d sudah dipakai", ErrBatchNumberExhausted, maxBatchNumberAttempts, templateID)
+}
@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"pt-besq-core/internal/database"
+	"pt-besq-core/internal/entity"
 	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
 // InstanceWithDetails represents a process instance with all related data
@@ -13,9 +16,16 @@ type InstanceWithDetails struct {
 	ID               int64           `db:"id" json:"id"`
 	TemplateID       int             `db:"template_id" json:"template_id"`
 	TemplateName     string          `db:"template_name" json:"template_name"`
+	TemplateVersion  int             `db:"template_version" json:"template_version"`
 	WorkflowID       int             `db:"workflow_id" json:"workflow_id"`
 	WorkflowName     string          `db:"workflow_name" json:"workflow_name"`
+	WorkflowVersion  int             `db:"workflow_version" json:"workflow_version"`
+	NodeID           string          `db:"node_id" json:"node_id,omitempty"`
+	SourceInstanceID *int64          `db:"source_instance_id" json:"source_instance_id,omitempty"`
+	RootInstanceID   *int64          `db:"root_instance_id" json:"root_instance_id,omitempty"`
 	BatchNumber      string          `db:"batch_number" json:"batch_number"`
+	Quantity         *float64        `db:"quantity" json:"quantity,omitempty"`
+	Unit             string          `db:"unit" json:"unit,omitempty"`
 	Status           string          `db:"status" json:"status"`
 	Priority         string          `db:"priority" json:"priority"`
 	DataPayload      json.RawMessage `db:"data_payload" json:"data_payload"`
@@ -28,6 +38,7 @@ type InstanceWithDetails struct {
 	ApprovedBy       *int            `db:"approved_by" json:"approved_by,omitempty"`
 	ApprovedByName   *string         `db:"approved_by_name" json:"approved_by_name,omitempty"`
 	ApprovedAt       *time.Time      `db:"approved_at" json:"approved_at,omitempty"`
+	Revision         int             `db:"revision" json:"revision"`
 	CreatedAt        time.Time       `db:"created_at" json:"created_at"`
 	UpdatedAt        time.Time       `db:"updated_at" json:"updated_at"`
 }
@@ -87,12 +98,14 @@ func (r *EnhancedInstanceRepository) GetWithDetails(instanceID int64) (*Instance
 	var instance InstanceWithDetails
 	query := `
 		SELECT 
-			i.id, i.template_id, t.name as template_name,
-			i.workflow_id, w.name as workflow_name,
-			i.batch_number, i.status, i.priority, i.data_payload,
-			i.start_time, i.end_time, i.duration_minutes, i.notes,
-			i.created_by, u1.full_name as created_by_name,
-			i.approved_by, u2.full_name as approved_by_name, i.approved_at,
+			i.id, i.template_id, t.name as template_name, COALESCE(i.template_version, 0) as template_version,
+			i.workflow_id, w.name as workflow_name, COALESCE(i.workflow_version, 0) as workflow_version,
+			COALESCE(i.node_id, '') as node_id, i.source_instance_id, i.root_instance_id,
+			COALESCE(i.batch_number, '') as batch_number, i.quantity, COALESCE(i.unit, '') as unit,
+			i.status, COALESCE(i.priority, 'normal') as priority, i.data_payload,
+			i.start_time, i.end_time, i.duration_minutes, COALESCE(i.notes, '') as notes,
+			COALESCE(i.created_by, 0) as created_by, COALESCE(u1.full_name, 'System') as created_by_name,
+			i.approved_by, u2.full_name as approved_by_name, i.approved_at, i.revision,
 			i.created_at, i.updated_at
 		FROM process_instances i
 		JOIN process_templates t ON i.template_id = t.id
@@ -103,34 +116,81 @@ func (r *EnhancedInstanceRepository) GetWithDetails(instanceID int64) (*Instance
 	`
 	err := database.DB.Get(&instance, query, instanceID)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("instance not found")
+		return nil, ErrInstanceNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
-	return &instance, err
+	return &instance, nil
 }
 
-// UpdateStatus changes the status of an instance and logs the change
-func (r *EnhancedInstanceRepository) UpdateStatus(instanceID int64, newStatus string, changedBy int, comment string) error {
-	tx, err := database.DB.Beginx()
+// canReadInstance applies the read rule of GetWithDetails without loading the instance:
+// every authenticated user may read an instance whose template and workflow still exist.
+// Anything tied to an instance (e.g. its attachments) must be checked with this rule.
+func canReadInstance(q sqlx.Queryer, instanceID int64) error {
+	var count int
+	err := sqlx.Get(q, &count, `
+		SELECT COUNT(*)
+		FROM process_instances i
+		JOIN process_templates t ON i.template_id = t.id
+		JOIN workflows w ON i.workflow_id = w.id
+		WHERE i.id = ?
+	`, instanceID)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
+	if count == 0 {
+		return ErrInstanceNotFound
+	}
+	return nil
+}
+
+// GetAttachments retrieves the files attached to an instance
+func (r *EnhancedInstanceRepository) GetAttachments(instanceID int64) ([]entity.Attachment, error) {
+	attachments := []entity.Attachment{}
+	query := `
+		SELECT
+			f.id, f.instance_id, f.filename, COALESCE(f.original_filename, f.filename) as original_filename,
+			COALESCE(f.file_path, '') as file_path, COALESCE(f.file_size, 0) as file_size,
+			COALESCE(f.mime_type, '') as mime_type, f.uploaded_by,
+			COALESCE(u.full_name, 'System') as uploaded_by_name, f.created_at
+		FROM file_attachments f
+		LEFT JOIN users u ON f.uploaded_by = u.id
+		WHERE f.instance_id = ?
+		ORDER BY f.created_at ASC, f.id ASC
+	`
+	if err := database.DB.Select(&attachments, query, instanceID); err != nil {
+		return nil, err
+	}
+	return attachments, loadThumbnails(database.DB, attachments)
+}
 
-	// Get current status
-	var oldStatus string
-	err = tx.Get(&oldStatus, "SELECT status FROM process_instances WHERE id = ?", instanceID)
+// UpdateStatus changes the status of an instance and logs the change.
+// The change must follow the status transition table for the user's role, and revision
+// must still be the instance's current revision (ErrRevisionConflict otherwise).
+// Returns the instance's revision after the change.
+func (r *EnhancedInstanceRepository) UpdateStatus(instanceID int64, newStatus, role string, changedBy int, comment string, revision int) (int, error) {
+	tx, err := database.DB.Beginx()
 	if err != nil {
-		return err
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	// Update status
-	_, err = tx.Exec(`
-		UPDATE process_instances 
-		SET status = ?, updated_at = NOW() 
-		WHERE id = ?
-	`, newStatus, instanceID)
+	oldStatus, err := transitionStatus(tx, instanceID, newStatus, role, revision)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	// Template dengan rantai approval hanya bisa completed lewat ApproveInstance.
+	// Dicek sesudah baris instance dikunci; perubahan status di atas ikut di-rollback.
+	if newStatus == StatusCompleted {
+		chained, err := hasApprovalChain(tx, instanceID)
+		if err != nil {
+			return 0, err
+		}
+		if chained {
+			return 0, ErrApprovalRequired
+		}
 	}
 
 	// Log the change
@@ -142,93 +202,286 @@ func (r *EnhancedInstanceRepository) UpdateStatus(instanceID int64, newStatus st
 		VALUES (?, 'status_changed', ?, ?, ?, ?, NOW())
 	`, instanceID, oldVal, newVal, changedBy, comment)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	// Stage selesai: buat instance draft untuk tahap berikutnya di workflow
+	if newStatus == StatusCompleted {
+		if _, err := advanceWorkflow(tx, instanceID, changedBy); err != nil {
+			return 0, err
+		}
+	}
+
+	newRevision, err := instanceRevision(tx, instanceID)
+	if err != nil {
+		return 0, err
 	}
+	return newRevision, tx.Commit()
+}
 
-	return tx.Commit()
+// InstanceReview is the outcome of approving or rejecting an instance
+type InstanceReview struct {
+	InstanceID     int64                `json:"instance_id"`
+	Status         string               `json:"status"`
+	PreviousStatus string               `json:"previous_status"`
+	Step           string               `json:"step"`
+	RemainingSteps int                  `json:"remaining_steps"`
+	CreatedBy      int                  `json:"created_by"`
+	Revision       int                  `json:"revision"`
+	Notification   Notification         `json:"notification"`
+	NextInstances  []int64              `json:"next_instances,omitempty"`
+	Signature      *ElectronicSignature `json:"signature,omitempty"`
 }
 
-// ApproveInstance approves an instance
-func (r *EnhancedInstanceRepository) ApproveInstance(instanceID int64, approvedBy int, comment string) error {
+// ApproveInstance signs the approval step the user is allowed to sign and records an
+// electronic signature with the given meaning (reviewed or approved).
+// The instance becomes completed (and the creator is notified) once every step has approved.
+// The caller must have re-verified the user's password and pass the revision the signer saw.
+func (r *EnhancedInstanceRepository) ApproveInstance(instanceID int64, role string, approvedBy int, meaning, comment string, revision int) (*InstanceReview, error) {
+	if meaning != MeaningReviewed && meaning != MeaningApproved {
+		return nil, fmt.Errorf("%w: '%s' (gunakan %s atau %s)", ErrInvalidSignatureMeaning, meaning, MeaningReviewed, MeaningApproved)
+	}
+
 	tx, err := database.DB.Beginx()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
 
-	// Update instance
-	_, err = tx.Exec(`
-		UPDATE process_instances 
-		SET status = 'completed', approved_by = ?, approved_at = NOW(), updated_at = NOW()
-		WHERE id = ?
-	`, approvedBy, instanceID)
+	oldStatus, err := lockStatus(tx, instanceID, revision)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if oldStatus != StatusInProgress {
+		return nil, &TransitionError{From: oldStatus, To: StatusCompleted, Role: role, err: ErrInvalidTransition}
+	}
+	turn, err := nextApprovalTurn(tx, instanceID, role, approvedBy)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordDecision(tx, instanceID, turn.Step, "approved", approvedBy, comment); err != nil {
+		return nil, err
+	}
+	sig, err := signInstance(tx, instanceID, approvedBy, meaning, "approved", turn.Step.Name, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	final := turn.Remaining == 0
+	status := StatusInProgress
+	if final {
+		status = StatusCompleted
+		if err := applyStatus(tx, instanceID, StatusCompleted); err != nil {
+			return nil, err
+		}
+		// approved_by adalah penandatangan terakhir; semua langkah ada di instance_approvals
+		_, err = tx.Exec(`
+			UPDATE process_instances 
+			SET approved_by = ?, approved_at = NOW()
+			WHERE id = ?
+		`, approvedBy, instanceID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Log the approval
+	// Log the approval step
+	oldVal, _ := json.Marshal(map[string]string{"status": oldStatus})
 	newVal, _ := json.Marshal(map[string]interface{}{
-		"status":      "completed",
-		"approved_by": approvedBy,
+		"status":          status,
+		"approved_by":     approvedBy,
+		"step":            turn.Step.Name,
+		"step_order":      turn.Step.StepOrder,
+		"remaining_steps": turn.Remaining,
 	})
 
 	_, err = tx.Exec(`
-		INSERT INTO instance_history (instance_id, action, new_value, changed_by, comment, created_at)
-		VALUES (?, 'approved', ?, ?, ?, NOW())
-	`, instanceID, newVal, approvedBy, comment)
+		INSERT INTO instance_history (instance_id, action, old_value, new_value, changed_by, comment, created_at)
+		VALUES (?, 'approved', ?, ?, ?, ?, NOW())
+	`, instanceID, oldVal, newVal, approvedBy, comment)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if !final {
+		var inst struct {
+			CreatedBy int `db:"created_by"`
+			Revision  int `db:"revision"`
+		}
+		if err := tx.Get(&inst, "SELECT COALESCE(created_by, 0) as created_by, revision FROM process_instances WHERE id = ?", instanceID); err != nil {
+			return nil, err
+		}
+		review := &InstanceReview{
+			InstanceID: instanceID, Status: status, PreviousStatus: oldStatus,
+			Step: turn.Step.Name, RemainingSteps: turn.Remaining, CreatedBy: inst.CreatedBy,
+			Revision: inst.Revision, Signature: sig,
+		}
+		return review, tx.Commit()
+	}
+
+	next, err := advanceWorkflow(tx, instanceID, approvedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	review, err := notifyReview(tx, instanceID, Notification{
+		Type:  "success",
+		Title: "Data disetujui",
+	}, comment)
+	if err != nil {
+		return nil, err
 	}
+	review.Status = StatusCompleted
+	review.PreviousStatus = oldStatus
+	review.Step = turn.Step.Name
+	review.NextInstances = next
+	review.Signature = sig
 
-	return tx.Commit()
+	return review, tx.Commit()
 }
 
-// RejectInstance rejects an instance
-func (r *EnhancedInstanceRepository) RejectInstance(instanceID int64, rejectedBy int, reason string) error {
+// RejectInstance rejects an instance on behalf of a pending approval step, records an
+// electronic signature with meaning "rejected" and notifies its creator.
+// The caller must have re-verified the user's password and pass the revision the signer saw.
+func (r *EnhancedInstanceRepository) RejectInstance(instanceID int64, role string, rejectedBy int, reason string, revision int) (*InstanceReview, error) {
 	tx, err := database.DB.Beginx()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
 
+	oldStatus, err := lockStatus(tx, instanceID, revision)
+	if err != nil {
+		return nil, err
+	}
+	if oldStatus != StatusInProgress {
+		return nil, &TransitionError{From: oldStatus, To: StatusRejected, Role: role, err: ErrInvalidTransition}
+	}
+	turn, err := nextApprovalTurn(tx, instanceID, role, rejectedBy)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordDecision(tx, instanceID, turn.Step, "rejected", rejectedBy, reason); err != nil {
+		return nil, err
+	}
+	sig, err := signInstance(tx, instanceID, rejectedBy, MeaningRejected, "rejected", turn.Step.Name, reason)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyStatus(tx, instanceID, StatusRejected); err != nil {
+		return nil, err
+	}
+
 	// Update instance
 	_, err = tx.Exec(`
 		UPDATE process_instances 
-		SET status = 'rejected', notes = ?, updated_at = NOW()
+		SET notes = ?
 		WHERE id = ?
 	`, reason, instanceID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Log the rejection
+	oldVal, _ := json.Marshal(map[string]string{"status": oldStatus})
 	newVal, _ := json.Marshal(map[string]interface{}{
-		"status": "rejected",
-		"reason": reason,
+		"status":      StatusRejected,
+		"rejected_by": rejectedBy,
+		"reason":      reason,
+		"step":        turn.Step.Name,
+		"step_order":  turn.Step.StepOrder,
 	})
 
 	_, err = tx.Exec(`
-		INSERT INTO instance_history (instance_id, action, new_value, changed_by, comment, created_at)
-		VALUES (?, 'rejected', ?, ?, ?, NOW())
-	`, instanceID, newVal, rejectedBy, reason)
+		INSERT INTO instance_history (instance_id, action, old_value, new_value, changed_by, comment, created_at)
+		VALUES (?, 'rejected', ?, ?, ?, ?, NOW())
+	`, instanceID, oldVal, newVal, rejectedBy, reason)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	review, err := notifyReview(tx, instanceID, Notification{
+		Type:  "warning",
+		Title: "Data ditolak",
+	}, reason)
+	if err != nil {
+		return nil, err
+	}
+	review.Status = StatusRejected
+	review.PreviousStatus = oldStatus
+	review.Step = turn.Step.Name
+	review.Signature = sig
+
+	return review, tx.Commit()
+}
+
+// notifyReview creates the approve/reject notification for the instance creator.
+// Instances without a creator (e.g. seeded data) get no notification.
+// The returned review carries the instance's current revision.
+func notifyReview(tx *sqlx.Tx, instanceID int64, notif Notification, comment string) (*InstanceReview, error) {
+	var inst struct {
+		CreatedBy    int    `db:"created_by"`
+		Revision     int    `db:"revision"`
+		BatchNumber  string `db:"batch_number"`
+		TemplateName string `db:"template_name"`
+	}
+	err := tx.Get(&inst, `
+		SELECT COALESCE(i.created_by, 0) as created_by, i.revision, COALESCE(i.batch_number, '') as batch_number, t.name as template_name
+		FROM process_instances i
+		JOIN process_templates t ON i.template_id = t.id
+		WHERE i.id = ?
+	`, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	review := &InstanceReview{InstanceID: instanceID, CreatedBy: inst.CreatedBy, Revision: inst.Revision}
+	if inst.CreatedBy == 0 {
+		return review, nil
+	}
+
+	subject := fmt.Sprintf("%s #%d", inst.TemplateName, instanceID)
+	if inst.BatchNumber != "" {
+		subject = fmt.Sprintf("%s (batch %s)", inst.TemplateName, inst.BatchNumber)
+	}
+	notif.UserID = inst.CreatedBy
+	notif.Message = fmt.Sprintf("%s: %s", notif.Title, subject)
+	if comment != "" {
+		notif.Message += " - " + comment
 	}
+	notif.RelatedEntityType = "instance"
+	notif.RelatedEntityID = &instanceID
 
-	return tx.Commit()
+	id, err := createNotification(tx, notif)
+	if err != nil {
+		return nil, err
+	}
+	notif.ID = int(id)
+	notif.CreatedAt = time.Now()
+	review.Notification = notif
+	return review, nil
 }
 
 // GetHistory retrieves the change history of an instance
 func (r *EnhancedInstanceRepository) GetHistory(instanceID int64) ([]InstanceHistoryEntry, error) {
-	var history []InstanceHistoryEntry
+	var exists int
+	if err := database.DB.Get(&exists, "SELECT COUNT(*) FROM process_instances WHERE id = ?", instanceID); err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrInstanceNotFound
+	}
+
+	history := []InstanceHistoryEntry{}
 	query := `
 		SELECT 
 			h.id, h.instance_id, h.action, h.old_value, h.new_value,
-			h.changed_by, COALESCE(u.full_name, 'System') as changed_by_name, h.comment, h.created_at
+			COALESCE(h.changed_by, 0) as changed_by, COALESCE(u.full_name, 'System') as changed_by_name,
+			COALESCE(h.comment, '') as comment, h.created_at
 		FROM instance_history h
 		LEFT JOIN users u ON h.changed_by = u.id
 		WHERE h.instance_id = ?
-		ORDER BY h.created_at DESC
+		ORDER BY h.created_at DESC, h.id DESC
 	`
 	err := database.DB.Select(&history, query, instanceID)
 	return history, err
@@ -340,12 +593,13 @@ func (r *EnhancedInstanceRepository) SearchInstances(filters map[string]interfac
 
 	query := `
 		SELECT 
-			i.id, i.template_id, t.name as template_name,
-			i.workflow_id, w.name as workflow_name,
-			i.batch_number, i.status, i.priority, i.data_payload,
+			i.id, i.template_id, t.name as template_name, COALESCE(i.template_version, 0) as template_version,
+			i.workflow_id, w.name as workflow_name, COALESCE(i.workflow_version, 0) as workflow_version,
+			COALESCE(i.node_id, '') as node_id, i.source_instance_id, i.root_instance_id,
+			i.batch_number, i.quantity, COALESCE(i.unit, '') as unit, i.status, i.priority, i.data_payload,
 			i.start_time, i.end_time, i.duration_minutes, i.notes,
 			i.created_by, COALESCE(u1.full_name, 'Unknown') as created_by_name,
-			i.approved_by, u2.full_name as approved_by_name, i.approved_at,
+			i.approved_by, u2.full_name as approved_by_name, i.approved_at, i.revision,
 			i.created_at, i.updated_at
 		FROM process_instances i
 		JOIN process_templates t ON i.template_id = t.id
@@ -410,4 +664,4 @@ func (r *EnhancedInstanceRepository) SearchInstances(filters map[string]interfac
 	// Execute query
 	err = database.DB.Select(&instances, query, args...)
 	return instances, total, err
-}
\ No newline at end of file
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"fmt"
+	"pt-besq-core/internal/database"
+	"pt-besq-core/internal/validation"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// maxDynamicOptions membatasi jumlah pilihan select yang diambil dari template lain
+const maxDynamicOptions = 1000
+
+// FieldResolver mengambil data pendukung validasi (pilihan select dinamis, file lampiran) dari database
+type FieldResolver struct{}
+
+// OptionValues mengambil nilai unik dari data_payload instance template lain (terbaru dulu)
+func (FieldResolver) OptionValues(src validation.OptionSource) ([]string, error) {
+	column := "i.batch_number"
+	args := []interface{}{}
+	if src.FieldKey != "" {
+		column = "JSON_VALUE(i.data_payload, ?)"
+		args = append(args, jsonPath(src.FieldKey))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT v FROM (
+			SELECT %s as v, MAX(i.id) as last_id
+			FROM process_instances i
+			WHERE i.template_id = ?
+	`, column)
+	args = append(args, src.TemplateID)
+
+	if len(src.Status) > 0 {
+		in, inArgs, err := sqlx.In(" AND i.status IN (?)", src.Status)
+		if err != nil {
+			return nil, err
+		}
+		query += in
+		args = append(args, inArgs...)
+	}
+	query += `
+			GROUP BY v
+		) opts
+		WHERE v IS NOT NULL AND v <> ''
+		ORDER BY last_id DESC
+		LIMIT ?
+	`
+	args = append(args, maxDynamicOptions)
+
+	var values []string
+	err := database.DB.Select(&values, query, args...)
+	return values, err
+}
+
+// AttachmentUsable memastikan file lampiran sudah terikat ke instance ini,
+// atau (untuk instance baru) masih berupa upload milik user yang belum dipakai instance lain.
+func (FieldResolver) AttachmentUsable(attachmentID int64, instanceID int64, userID int) (bool, error) {
+	var count int
+	query := `
+		SELECT COUNT(*) FROM file_attachments
+		WHERE id = ? AND (instance_id = ? OR (instance_id IS NULL AND uploaded_by = ?))
+	`
+	if err := database.DB.Get(&count, query, attachmentID, instanceID, userID); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetFieldOptions mengambil daftar pilihan sebuah kolom select (statis dan dari template lain)
+func GetFieldOptions(templateID int, fieldKey string) ([]string, error) {
+	fields, err := GetFieldDefs(templateID)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		if f.Key != fieldKey {
+			continue
+		}
+		rule, err := validation.ParseRule(f.ValidationRule)
+		if err != nil {
+			return nil, err
+		}
+		options := append([]string{}, rule.Options...)
+		if rule.OptionsFrom != nil {
+			dynamic, err := FieldResolver{}.OptionValues(*rule.OptionsFrom)
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, dynamic...)
+		}
+		return options, nil
+	}
+	return nil, ErrFieldNotFound
+}
+
+// jsonPath membuat path JSON '$."key"' yang aman untuk key berisi titik atau spasi
+func jsonPath(key string) string {
+	key = strings.ReplaceAll(key, `\`, `\\`)
+	key = strings.ReplaceAll(key, `"`, `\"`)
+	return `$."` + key + `"`
+}
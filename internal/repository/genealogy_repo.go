@@ -0,0 +1,485 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pt-besq-core/internal/database"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrLinkNotFound    = errors.New("instance link not found")
+	ErrLinkExists      = errors.New("instance link already exists")
+	ErrLinkCycle       = errors.New("instance link would create a cycle")
+	ErrLinkUnchecked   = errors.New("instance link cannot be checked for cycles")
+	ErrInvalidQuantity = errors.New("invalid quantity")
+)
+
+// Jenis hubungan antar instance di genealogy
+const (
+	LinkConsumed = "consumed" // child dibuat dari (memakai) material parent
+	LinkStage    = "stage"    // child adalah tahap workflow berikutnya dari parent (source_instance_id)
+)
+
+// Arah penelusuran genealogy
+const (
+	TraceUp   = "up"   // ke bahan baku / batch asal
+	TraceDown = "down" // ke batch yang dibuat dari instance ini
+	TraceBoth = "both"
+)
+
+// Cara recall report memilih batch sumber
+const (
+	RecallViaOutputs = "outputs" // hanya hilir dari instance yang bermasalah
+	RecallViaInputs  = "inputs"  // telusuri bahan asalnya dulu, lalu semua hilir dari bahan itu
+)
+
+// Batas penelusuran supaya satu request tidak membaca seluruh tabel
+const (
+	MaxGenealogyDepth = 20
+	maxGenealogyNodes = 500
+	maxRecallNodes    = 5000
+)
+
+// InstanceLink adalah hubungan "child memakai material dari parent"
+type InstanceLink struct {
+	ParentID int64    `json:"parent_id" binding:"required"`
+	ChildID  int64    `json:"child_id"`
+	Quantity *float64 `json:"quantity,omitempty"`
+	Unit     string   `json:"unit,omitempty" binding:"max=20"`
+}
+
+// GenealogyNode adalah satu batch di graph genealogy. Level negatif berarti hulu
+// (bahan/batch asal), positif hilir (batch turunan), 0 instance yang ditelusuri.
+type GenealogyNode struct {
+	ID           int64     `db:"id" json:"id"`
+	BatchNumber  string    `db:"batch_number" json:"batch_number"`
+	TemplateID   int       `db:"template_id" json:"template_id"`
+	TemplateName string    `db:"template_name" json:"template_name"`
+	Status       string    `db:"status" json:"status"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	Level        int       `db:"-" json:"level"`
+}
+
+// GenealogyEdge adalah satu hubungan parent -> child
+type GenealogyEdge struct {
+	ParentID int64    `db:"parent_id" json:"parent_id"`
+	ChildID  int64    `db:"child_id" json:"child_id"`
+	LinkType string   `db:"link_type" json:"link_type"`
+	Quantity *float64 `db:"quantity" json:"quantity,omitempty"`
+	Unit     string   `db:"unit" json:"unit,omitempty"`
+}
+
+// Genealogy adalah graph batch di sekitar satu instance
+type Genealogy struct {
+	InstanceID int64           `json:"instance_id"`
+	Direction  string          `json:"direction"`
+	Depth      int             `json:"depth"`
+	Nodes      []GenealogyNode `json:"nodes"`
+	Edges      []GenealogyEdge `json:"edges"`
+	Truncated  bool            `json:"truncated"` // ada batch yang tidak ikut karena batas jumlah node
+}
+
+// RecallItem adalah satu batch yang terdampak recall beserta jalur dari batch sumber
+type RecallItem struct {
+	GenealogyNode
+	Path []string `json:"path"` // nomor batch (atau #id) dari sumber sampai batch ini
+}
+
+// RecallReport adalah daftar semua batch hilir dari batch yang bermasalah
+type RecallReport struct {
+	Source      GenealogyNode   `json:"source"`
+	Via         string          `json:"via"`
+	Inputs      []GenealogyNode `json:"inputs,omitempty"` // bahan asal yang ikut ditelusuri ke hilir (via=inputs)
+	Affected    []RecallItem    `json:"affected"`
+	ByStatus    map[string]int  `json:"by_status"`
+	Truncated   bool            `json:"truncated"`
+	GeneratedAt time.Time       `json:"generated_at"`
+}
+
+// AddParentLink mencatat bahwa child memakai material dari parent. Hubungan yang membuat
+// lingkaran (parent ternyata turunan child) ditolak. Kedua instance mendapat riwayat 'linked'.
+func (r *EnhancedInstanceRepository) AddParentLink(link InstanceLink, userID int) error {
+	if link.ParentID == link.ChildID {
+		return fmt.Errorf("%w: instance tidak bisa memakai dirinya sendiri", ErrLinkCycle)
+	}
+	if link.Quantity != nil && *link.Quantity <= 0 {
+		return fmt.Errorf("%w: quantity harus lebih dari 0", ErrInvalidQuantity)
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockInstances(tx, link.ParentID, link.ChildID); err != nil {
+		return err
+	}
+	if err := insertLink(tx, link, LinkConsumed, userID); err != nil {
+		return err
+	}
+	if err := logLinkHistory(tx, link, "linked", userID, ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockInstances mengunci baris instance (urut ID supaya tidak deadlock) dan memastikan semuanya ada
+func lockInstances(tx *sqlx.Tx, ids ...int64) error {
+	sorted := append([]int64(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	query, args, err := sqlx.In("SELECT id FROM process_instances WHERE id IN (?) ORDER BY id FOR UPDATE", sorted)
+	if err != nil {
+		return err
+	}
+	var found []int64
+	if err := tx.Select(&found, query, args...); err != nil {
+		return err
+	}
+	exists := make(map[int64]bool, len(found))
+	for _, id := range found {
+		exists[id] = true
+	}
+	for _, id := range ids {
+		if !exists[id] {
+			return fmt.Errorf("%w: #%d", ErrInstanceNotFound, id)
+		}
+	}
+	return nil
+}
+
+// insertLink menulis hubungan parent -> child setelah memastikan tidak ada duplikat atau lingkaran
+func insertLink(tx *sqlx.Tx, link InstanceLink, linkType string, userID int) error {
+	var exists int
+	if err := tx.Get(&exists, "SELECT COUNT(*) FROM instance_links WHERE parent_instance_id = ? AND child_instance_id = ?", link.ParentID, link.ChildID); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return ErrLinkExists
+	}
+
+	// Parent tidak boleh berada di hilir child
+	levels, _, truncated, err := traceGenealogy(tx, link.ChildID, false, maxRecallNodes, maxRecallNodes)
+	if err != nil {
+		return err
+	}
+	if truncated {
+		return fmt.Errorf("%w: turunan #%d lebih dari %d batch", ErrLinkUnchecked, link.ChildID, maxRecallNodes)
+	}
+	if _, ok := levels[link.ParentID]; ok {
+		return fmt.Errorf("%w: #%d adalah turunan dari #%d", ErrLinkCycle, link.ParentID, link.ChildID)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO instance_links (parent_instance_id, child_instance_id, link_type, quantity, unit, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, link.ParentID, link.ChildID, linkType, link.Quantity, nullableString(link.Unit), nullableID(userID))
+	return err
+}
+
+// logLinkHistory mencatat perubahan hubungan di riwayat kedua instance
+func logLinkHistory(tx *sqlx.Tx, link InstanceLink, action string, userID int, comment string) error {
+	value, _ := json.Marshal(link)
+	oldVal, newVal := []byte(nil), value
+	if action == "unlinked" {
+		oldVal, newVal = value, nil
+	}
+	for _, id := range []int64{link.ParentID, link.ChildID} {
+		_, err := tx.Exec(`
+			INSERT INTO instance_history (instance_id, action, old_value, new_value, changed_by, comment, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, NOW())
+		`, id, action, oldVal, newVal, nullableID(userID), comment)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveParentLink menghapus hubungan consumed yang salah input.
+// Hubungan tahap workflow tidak bisa dihapus lewat sini.
+func (r *EnhancedInstanceRepository) RemoveParentLink(childID, parentID int64, userID int, reason string) error {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var link struct {
+		Quantity *float64 `db:"quantity"`
+		Unit     string   `db:"unit"`
+		LinkType string   `db:"link_type"`
+	}
+	err = tx.Get(&link, `
+		SELECT quantity, COALESCE(unit, '') as unit, link_type FROM instance_links
+		WHERE parent_instance_id = ? AND child_instance_id = ? FOR UPDATE
+	`, parentID, childID)
+	if err == sql.ErrNoRows {
+		return ErrLinkNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if link.LinkType != LinkConsumed {
+		return fmt.Errorf("%w: hubungan %s tidak bisa dihapus", ErrLinkNotFound, link.LinkType)
+	}
+
+	if _, err := tx.Exec("DELETE FROM instance_links WHERE parent_instance_id = ? AND child_instance_id = ?", parentID, childID); err != nil {
+		return err
+	}
+	removed := InstanceLink{ParentID: parentID, ChildID: childID, Quantity: link.Quantity, Unit: link.Unit}
+	if err := logLinkHistory(tx, removed, "unlinked", userID, reason); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetGenealogy menelusuri batch asal (up), batch turunan (down) atau keduanya sampai depth langkah.
+// Tahap workflow (source_instance_id) ikut dihitung sebagai hubungan dengan link_type "stage".
+// Direction both hanya berisi garis lurus ke atas dan ke bawah; batch lain yang memakai bahan
+// yang sama (saudara) tidak ikut. Untuk itu gunakan GetRecallReport dengan via=inputs.
+func (r *EnhancedInstanceRepository) GetGenealogy(instanceID int64, direction string, depth int) (*Genealogy, error) {
+	if err := instanceExists(database.DB, instanceID); err != nil {
+		return nil, err
+	}
+
+	g := &Genealogy{InstanceID: instanceID, Direction: direction, Depth: depth, Edges: []GenealogyEdge{}}
+	levels := map[int64]int{instanceID: 0}
+	for _, up := range []bool{true, false} {
+		if (up && direction == TraceDown) || (!up && direction == TraceUp) {
+			continue
+		}
+		found, edges, truncated, err := traceGenealogy(database.DB, instanceID, up, depth, maxGenealogyNodes)
+		if err != nil {
+			return nil, err
+		}
+		for id, level := range found {
+			if up {
+				level = -level
+			}
+			if _, seen := levels[id]; !seen {
+				levels[id] = level
+			}
+		}
+		g.Edges = append(g.Edges, edges...)
+		g.Truncated = g.Truncated || truncated
+	}
+
+	nodes, err := loadGenealogyNodes(database.DB, levels)
+	if err != nil {
+		return nil, err
+	}
+	g.Nodes = nodes
+	return g, nil
+}
+
+// GetRecallReport mengumpulkan semua batch hilir (tanpa batas kedalaman) beserta jalurnya.
+// Dengan via=outputs sumbernya hanya instance ini. Dengan via=inputs bahan asal instance ditelusuri
+// dulu ke hulu, lalu semua hilir dari bahan-bahan itu ikut dilaporkan, termasuk batch saudara
+// yang memakai lot bahan yang sama. Bahan asal yang dipakai dilaporkan di Inputs.
+func (r *EnhancedInstanceRepository) GetRecallReport(instanceID int64, via string) (*RecallReport, error) {
+	if err := instanceExists(database.DB, instanceID); err != nil {
+		return nil, err
+	}
+
+	sources := []int64{instanceID}
+	var inputs map[int64]int
+	upTruncated := false
+	if via == RecallViaInputs {
+		var err error
+		inputs, _, upTruncated, err = traceGenealogy(database.DB, instanceID, true, maxRecallNodes, maxRecallNodes)
+		if err != nil {
+			return nil, err
+		}
+		for id := range inputs {
+			sources = append(sources, id)
+		}
+	}
+
+	levels, edges, truncated, err := traceGenealogyFrom(database.DB, sources, false, maxRecallNodes, maxRecallNodes)
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[int64]int, len(levels)+len(sources))
+	for id, level := range levels {
+		all[id] = level
+	}
+	all[instanceID] = 0
+	for id, level := range inputs {
+		all[id] = -level
+	}
+	nodes, err := loadGenealogyNodes(database.DB, all)
+	if err != nil {
+		return nil, err
+	}
+
+	// Jalur terpendek ke setiap batch: parent pertama yang levelnya satu di atas.
+	// Semua sumber berada di level 0 penelusuran hilir.
+	byID := make(map[int64]GenealogyNode, len(nodes))
+	for _, n := range nodes {
+		byID[n.ID] = n
+	}
+	parentOf := map[int64]int64{}
+	for _, e := range edges {
+		if _, ok := levels[e.ChildID]; !ok {
+			continue
+		}
+		if _, ok := parentOf[e.ChildID]; !ok && levels[e.ParentID] == levels[e.ChildID]-1 {
+			parentOf[e.ChildID] = e.ParentID
+		}
+	}
+	label := func(id int64) string {
+		if n := byID[id]; n.BatchNumber != "" {
+			return n.BatchNumber
+		}
+		return fmt.Sprintf("#%d", id)
+	}
+
+	report := &RecallReport{
+		Source:      byID[instanceID],
+		Via:         via,
+		Affected:    []RecallItem{},
+		ByStatus:    map[string]int{},
+		Truncated:   truncated || upTruncated,
+		GeneratedAt: time.Now(),
+	}
+	if via == RecallViaInputs {
+		report.Inputs = []GenealogyNode{}
+	}
+	for _, n := range nodes {
+		if n.ID == instanceID {
+			continue
+		}
+		if _, ok := inputs[n.ID]; ok {
+			report.Inputs = append(report.Inputs, n)
+			continue
+		}
+		path := []string{label(n.ID)}
+		for id := parentOf[n.ID]; id != 0; id = parentOf[id] {
+			path = append([]string{label(id)}, path...)
+		}
+		report.Affected = append(report.Affected, RecallItem{GenealogyNode: n, Path: path})
+		report.ByStatus[n.Status]++
+	}
+	return report, nil
+}
+
+func instanceExists(q sqlx.Queryer, instanceID int64) error {
+	var exists int
+	if err := sqlx.Get(q, &exists, "SELECT COUNT(*) FROM process_instances WHERE id = ?", instanceID); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrInstanceNotFound
+	}
+	return nil
+}
+
+// traceGenealogy menelusuri graph per level (breadth-first) mulai dari start. levels berisi
+// jarak setiap instance yang ditemukan (tanpa start). truncated true jika berhenti karena maxNodes.
+func traceGenealogy(q sqlx.Queryer, start int64, up bool, maxDepth, maxNodes int) (levels map[int64]int, edges []GenealogyEdge, truncated bool, err error) {
+	return traceGenealogyFrom(q, []int64{start}, up, maxDepth, maxNodes)
+}
+
+// traceGenealogyFrom sama dengan traceGenealogy tetapi mulai dari beberapa instance sekaligus
+// (semuanya level 0, tidak ikut di levels)
+func traceGenealogyFrom(q sqlx.Queryer, starts []int64, up bool, maxDepth, maxNodes int) (levels map[int64]int, edges []GenealogyEdge, truncated bool, err error) {
+	levels = map[int64]int{}
+	edges = []GenealogyEdge{}
+	seen := make(map[int64]bool, len(starts))
+	for _, id := range starts {
+		seen[id] = true
+	}
+	frontier := starts
+	for depth := 1; depth <= maxDepth && len(frontier) > 0; depth++ {
+		found, err := adjacentEdges(q, frontier, up)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		var next []int64
+		for _, e := range found {
+			id := e.ChildID
+			if up {
+				id = e.ParentID
+			}
+			if !seen[id] {
+				if len(seen) > maxNodes {
+					truncated = true
+					continue
+				}
+				seen[id] = true
+				levels[id] = depth
+				next = append(next, id)
+			}
+			edges = append(edges, e)
+		}
+		frontier = next
+	}
+	return levels, edges, truncated, nil
+}
+
+// adjacentEdges mengambil hubungan ke atas (parent dari ids) atau ke bawah (child dari ids),
+// gabungan instance_links dan tahap workflow
+func adjacentEdges(q sqlx.Queryer, ids []int64, up bool) ([]GenealogyEdge, error) {
+	query := `
+		SELECT parent_instance_id as parent_id, child_instance_id as child_id, link_type, quantity, COALESCE(unit, '') as unit
+		FROM instance_links WHERE child_instance_id IN (?)
+		UNION ALL
+		SELECT source_instance_id, id, 'stage', NULL, ''
+		FROM process_instances WHERE id IN (?) AND source_instance_id IS NOT NULL
+	`
+	if !up {
+		query = `
+			SELECT parent_instance_id as parent_id, child_instance_id as child_id, link_type, quantity, COALESCE(unit, '') as unit
+			FROM instance_links WHERE parent_instance_id IN (?)
+			UNION ALL
+			SELECT source_instance_id, id, 'stage', NULL, ''
+			FROM process_instances WHERE source_instance_id IN (?)
+		`
+	}
+	query, args, err := sqlx.In(query, ids, ids)
+	if err != nil {
+		return nil, err
+	}
+	edges := []GenealogyEdge{}
+	err = sqlx.Select(q, &edges, query, args...)
+	return edges, err
+}
+
+// loadGenealogyNodes mengambil detail instance di levels, urut level lalu ID
+func loadGenealogyNodes(q sqlx.Queryer, levels map[int64]int) ([]GenealogyNode, error) {
+	ids := make([]int64, 0, len(levels))
+	for id := range levels {
+		ids = append(ids, id)
+	}
+	query, args, err := sqlx.In(`
+		SELECT i.id, COALESCE(i.batch_number, '') as batch_number, i.template_id, t.name as template_name,
+		       i.status, i.created_at
+		FROM process_instances i
+		JOIN process_templates t ON i.template_id = t.id
+		WHERE i.id IN (?)
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []GenealogyNode{}
+	if err := sqlx.Select(q, &nodes, query, args...); err != nil {
+		return nil, err
+	}
+	for i := range nodes {
+		nodes[i].Level = levels[nodes[i].ID]
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Level != nodes[j].Level {
+			return nodes[i].Level < nodes[j].Level
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+	return nodes, nil
+}
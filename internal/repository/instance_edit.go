@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pt-besq-core/internal/database"
+	"pt-besq-core/internal/entity"
+	"reflect"
+	"sort"
+)
+
+var ErrInstanceLocked = errors.New("instance is locked and can no longer be edited")
+
+// FieldChange adalah satu kolom payload yang berubah saat instance diedit
+type FieldChange struct {
+	Key   string      `json:"key"`
+	Label string      `json:"label"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// PayloadEdit adalah data_payload baru (sudah divalidasi) beserta alasan perubahannya
+type PayloadEdit struct {
+	Data          map[string]interface{}
+	Fields        []entity.FieldDef // dipakai untuk label di riwayat
+	Reason        string
+	EditedBy      int
+	AttachmentIDs []int64
+	Revision      int // revision yang dibaca client (If-Match)
+}
+
+// UpdatePayload mengganti data_payload instance dan mencatat kolom yang berubah (lama -> baru)
+// ke instance_history dengan action 'updated'. Instance yang sudah di-approve, completed, cancelled,
+// atau yang putaran approval-nya sudah punya keputusan tidak bisa diedit (ErrInstanceLocked),
+// supaya tanda tangan selalu berlaku untuk data yang dilihat penandatangan.
+// Jika revision instance sudah bukan edit.Revision, tidak ada yang ditulis dan hasilnya ErrRevisionConflict.
+// Jika tidak ada kolom yang berubah, tidak ada yang ditulis dan hasilnya kosong.
+// Mengembalikan revision instance setelah update.
+func (r *EnhancedInstanceRepository) UpdatePayload(instanceID int64, edit PayloadEdit) ([]FieldChange, int, error) {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	var current struct {
+		Payload    sql.NullString `db:"data_payload"`
+		Status     string         `db:"status"`
+		ApprovedAt sql.NullTime   `db:"approved_at"`
+		Revision   int            `db:"revision"`
+	}
+	err = tx.Get(&current, "SELECT data_payload, status, approved_at, revision FROM process_instances WHERE id = ? FOR UPDATE", instanceID)
+	if err == sql.ErrNoRows {
+		return nil, 0, ErrInstanceNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if current.Revision != edit.Revision {
+		return nil, current.Revision, ErrRevisionConflict
+	}
+	if current.ApprovedAt.Valid || current.Status == StatusCompleted || current.Status == StatusCancelled {
+		return nil, current.Revision, ErrInstanceLocked
+	}
+	var decided int
+	if err := tx.Get(&decided, "SELECT COUNT(*) FROM instance_approvals WHERE instance_id = ?", instanceID); err != nil {
+		return nil, 0, err
+	}
+	if decided > 0 {
+		return nil, current.Revision, fmt.Errorf("%w: putaran approval sudah berjalan", ErrInstanceLocked)
+	}
+
+	oldData := map[string]interface{}{}
+	if current.Payload.Valid && current.Payload.String != "" {
+		if err := json.Unmarshal([]byte(current.Payload.String), &oldData); err != nil {
+			return nil, 0, fmt.Errorf("data_payload lama tidak valid: %w", err)
+		}
+	}
+	newJSON, err := json.Marshal(edit.Data)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Dibaca ulang dari JSON supaya tipe angka sama dengan payload lama saat dibandingkan
+	newData := map[string]interface{}{}
+	if err := json.Unmarshal(newJSON, &newData); err != nil {
+		return nil, 0, err
+	}
+
+	changes := diffPayload(edit.Fields, oldData, newData)
+	if len(changes) == 0 {
+		return changes, current.Revision, nil
+	}
+
+	_, err = tx.Exec("UPDATE process_instances SET data_payload = ?, revision = revision + 1, updated_at = NOW() WHERE id = ?", newJSON, instanceID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := claimAttachments(tx, instanceID, edit.EditedBy, edit.AttachmentIDs); err != nil {
+		return nil, 0, err
+	}
+
+	oldVal := make(map[string]interface{}, len(changes))
+	newVal := make(map[string]interface{}, len(changes))
+	for _, ch := range changes {
+		oldVal[ch.Key] = ch.Old
+		newVal[ch.Key] = ch.New
+	}
+	oldBytes, _ := json.Marshal(oldVal)
+	newBytes, _ := json.Marshal(newVal)
+	_, err = tx.Exec(`
+		INSERT INTO instance_history (instance_id, action, old_value, new_value, changed_by, comment, created_at)
+		VALUES (?, 'updated', ?, ?, ?, ?, NOW())
+	`, instanceID, oldBytes, newBytes, nullableID(edit.EditedBy), edit.Reason)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return changes, current.Revision + 1, tx.Commit()
+}
+
+// diffPayload membandingkan dua payload per key. Kolom template mengikuti urutan template,
+// key lain menyusul urut abjad. Key yang dihapus tercatat dengan nilai baru null.
+func diffPayload(fields []entity.FieldDef, oldData, newData map[string]interface{}) []FieldChange {
+	changes := []FieldChange{}
+	seen := map[string]bool{}
+	compare := func(key, label string) {
+		seen[key] = true
+		oldVal, hadOld := oldData[key]
+		newVal, hasNew := newData[key]
+		if hadOld == hasNew && reflect.DeepEqual(oldVal, newVal) {
+			return
+		}
+		changes = append(changes, FieldChange{Key: key, Label: label, Old: oldVal, New: newVal})
+	}
+
+	for _, f := range fields {
+		compare(f.Key, f.Label)
+	}
+	var extra []string
+	for key := range oldData {
+		if !seen[key] {
+			extra = append(extra, key)
+		}
+	}
+	for key := range newData {
+		if _, inOld := oldData[key]; !seen[key] && !inOld {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	for _, key := range extra {
+		compare(key, key)
+	}
+	return changes
+}
@@ -2,12 +2,18 @@ package repository
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"pt-besq-core/internal/database"
 	"pt-besq-core/internal/entity" // Import Entity
+	"pt-besq-core/internal/validation"
 	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
+// ErrAttachmentUnavailable berarti file lampiran sudah dipakai instance lain atau bukan milik user
+var ErrAttachmentUnavailable = errors.New("attachment not available")
+
 type InstanceRepository struct{}
 
 func NewInstanceRepository() *InstanceRepository {
@@ -16,53 +22,133 @@ func NewInstanceRepository() *InstanceRepository {
 
 // --- BAGIAN 1: VALIDATION & SAVING ---
 
-// ValidateInput memvalidasi data JSON dari user
-// Perhatikan: parameter fields menggunakan []entity.FieldDef
-func (r *InstanceRepository) ValidateInput(input map[string]interface{}, fields []entity.FieldDef) error {
-	for _, field := range fields {
-		val, exists := input[field.Key]
+// ValidateInput memvalidasi data JSON dari user terhadap definisi kolom dan validation_rule-nya.
+// instanceID diisi 0 untuk instance baru; userID dipakai untuk mengecek kepemilikan file lampiran.
+// Jika ada pelanggaran, error yang dikembalikan bertipe validation.Errors (semua pelanggaran sekaligus).
+func (r *InstanceRepository) ValidateInput(input map[string]interface{}, fields []entity.FieldDef, instanceID int64, userID int) error {
+	v := validation.New(fields)
+	v.Resolver = FieldResolver{}
+	v.InstanceID = instanceID
+	v.UserID = userID
+	if errs := v.Validate(input); errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// NewInstance adalah data yang dibutuhkan untuk menyimpan instance baru
+type NewInstance struct {
+	WorkflowID       int
+	WorkflowVersion  int // versi workflow yang dijalankan (0 jika workflow belum pernah dipublish)
+	TemplateID       int
+	TemplateVersion  int // versi template yang dipakai (0 berarti versi terbaru)
+	Data             []byte
+	CreatedBy        int
+	AttachmentIDs    []int64  // file lampiran yang dirujuk kolom bertipe file
+	NodeID           string   // node stage di canvas workflow ("" untuk workflow tanpa stage)
+	SourceInstanceID int64    // instance tahap sebelumnya jika dibuat otomatis oleh workflow
+	RootInstanceID   int64    // instance pertama dari jalannya workflow ini (0 jika instance ini yang pertama)
+	Quantity         *float64 // ukuran batch (nil jika tidak dicatat)
+	Unit             string   // satuan quantity, misalnya "kg"
+}
 
-		if field.IsRequired && (!exists || val == nil || val == "") {
-			return fmt.Errorf("kolom '%s' wajib diisi", field.Label)
-		}
+// SaveInstance menyimpan data baru dan mengunci versi template yang dipakai saat itu.
+// File lampiran yang dirujuk ikut diikat ke instance baru dalam transaksi yang sama.
+// batchNumber kosong jika template tidak punya pola nomor batch.
+func (r *InstanceRepository) SaveInstance(in NewInstance) (id int64, batchNumber string, err error) {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	id, batchNumber, err = insertInstance(tx, in)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := claimAttachments(tx, id, in.CreatedBy, in.AttachmentIDs); err != nil {
+		return 0, "", err
+	}
+	return id, batchNumber, tx.Commit()
+}
 
-		if exists && val != nil && val != "" {
-			switch field.Type {
-			case "number":
-				if _, ok := val.(float64); !ok {
-					return fmt.Errorf("kolom '%s' harus berupa angka", field.Label)
-				}
-			case "text", "date":
-				if _, ok := val.(string); !ok {
-					return fmt.Errorf("kolom '%s' harus berupa teks", field.Label)
-				}
-			}
+// insertInstance menulis satu baris process_instances berstatus draft di dalam transaksi.
+// Tanpa TemplateVersion, instance memakai versi template terbaru.
+// Jika template punya pola nomor batch, nomornya diambil di transaksi yang sama.
+func insertInstance(tx *sqlx.Tx, in NewInstance) (int64, string, error) {
+	version := in.TemplateVersion
+	if version == 0 {
+		v, err := currentTemplateVersion(tx, in.TemplateID)
+		if err != nil {
+			return 0, "", err
 		}
+		version = v
 	}
-	return nil
+	batchNumber, err := nextBatchNumber(tx, in.TemplateID, time.Now())
+	if err != nil {
+		return 0, "", err
+	}
+
+	query := `INSERT INTO process_instances (workflow_id, workflow_version, template_id, template_version, node_id,
+	                                         source_instance_id, root_instance_id, batch_number, quantity, unit, status, data_payload, created_by, created_at) 
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'draft', ?, ?, NOW())`
+
+	res, err := tx.Exec(query, in.WorkflowID, nullableID(in.WorkflowVersion), in.TemplateID, version, nullableString(in.NodeID),
+		nullableInstanceID(in.SourceInstanceID), nullableInstanceID(in.RootInstanceID), nullableString(batchNumber),
+		in.Quantity, nullableString(in.Unit), in.Data, nullableID(in.CreatedBy))
+	if err != nil {
+		return 0, "", err
+	}
+	id, err := res.LastInsertId()
+	return id, batchNumber, err
+}
+
+// nullableInstanceID mengubah ID instance 0 menjadi NULL
+func nullableInstanceID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
 }
 
-// SaveInstance menyimpan data baru
-func (r *InstanceRepository) SaveInstance(workflowID, templateID int, dataJSON []byte) (int64, error) {
-	query := `INSERT INTO process_instances (workflow_id, template_id, status, data_payload, created_at) 
-	          VALUES (?, ?, 'draft', ?, NOW())`
-	
-	res, err := database.DB.Exec(query, workflowID, templateID, dataJSON)
+// claimAttachments mengikat upload yang belum terpakai milik user ke instance.
+// Jika ada file yang sudah diambil instance lain di antara validasi dan penyimpanan, simpan dibatalkan.
+func claimAttachments(tx *sqlx.Tx, instanceID int64, userID int, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In(`
+		UPDATE file_attachments SET instance_id = ?
+		WHERE id IN (?) AND (instance_id = ? OR (instance_id IS NULL AND uploaded_by = ?))
+	`, instanceID, ids, instanceID, userID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(query, args...)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	return res.LastInsertId()
+	unique := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	if n, _ := res.RowsAffected(); int(n) < len(unique) {
+		return ErrAttachmentUnavailable
+	}
+	return nil
 }
 
 // --- BAGIAN 2: STRUCTS & DATA RETRIEVAL ---
 
 type InstanceLog struct {
-	ID           int64           `db:"id" json:"id"`
-	WorkflowName string          `db:"workflow_name" json:"workflow_name"`
-	TemplateName string          `db:"template_name" json:"template_name"`
-	Status       string          `db:"status" json:"status"`
-	CreatedAt    time.Time       `db:"created_at" json:"created_at"`
-	DataPayload  json.RawMessage `db:"data_payload" json:"data_payload"`
+	ID              int64           `db:"id" json:"id"`
+	TemplateID      int             `db:"template_id" json:"template_id"`
+	TemplateVersion int             `db:"template_version" json:"template_version"`
+	WorkflowName    string          `db:"workflow_name" json:"workflow_name"`
+	TemplateName    string          `db:"template_name" json:"template_name"`
+	Status          string          `db:"status" json:"status"`
+	CreatedAt       time.Time       `db:"created_at" json:"created_at"`
+	DataPayload     json.RawMessage `db:"data_payload" json:"data_payload"`
 }
 
 type DailyStat struct {
@@ -74,7 +160,8 @@ type DailyStat struct {
 func (r *InstanceRepository) GetHistory(limit, offset int, templateID int, dateStr string) ([]InstanceLog, error) {
 	var logs []InstanceLog
 	query := `
-		SELECT i.id, w.name as workflow_name, t.name as template_name, 
+		SELECT i.id, i.template_id, COALESCE(i.template_version, 0) as template_version,
+		       w.name as workflow_name, t.name as template_name, 
 		       i.status, i.created_at, i.data_payload
 		FROM process_instances i
 		JOIN workflows w ON i.workflow_id = w.id
@@ -130,4 +217,4 @@ func (r *InstanceRepository) GetDailyStats() ([]DailyStat, error) {
 	`
 	err := database.DB.Select(&stats, query)
 	return stats, err
-}
\ No newline at end of file
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrInvalidStatus       = errors.New("unknown instance status")
+	ErrInvalidTransition   = errors.New("invalid status transition")
+	ErrTransitionForbidden = errors.New("status transition not allowed for this role")
+)
+
+// Status instance sesuai ENUM process_instances.status
+const (
+	StatusDraft      = "draft"
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	StatusRejected   = "rejected"
+	StatusCancelled  = "cancelled"
+)
+
+// statusTransitions adalah perpindahan status yang sah beserta role yang boleh melakukannya.
+// completed dan cancelled adalah status akhir.
+var statusTransitions = map[string]map[string][]string{
+	StatusDraft: {
+		StatusInProgress: {"admin", "supervisor", "operator"},
+		StatusCancelled:  {"admin", "supervisor"},
+	},
+	StatusInProgress: {
+		StatusCompleted: {"admin", "supervisor", "operator"},
+		StatusRejected:  {"admin", "supervisor"},
+		StatusCancelled: {"admin", "supervisor"},
+	},
+	StatusRejected: {
+		// Rework: batch yang ditolak dikerjakan ulang
+		StatusInProgress: {"admin", "supervisor"},
+		StatusCancelled:  {"admin", "supervisor"},
+	},
+}
+
+// TransitionError menjelaskan perpindahan status yang ditolak.
+// Membungkus ErrInvalidTransition atau ErrTransitionForbidden.
+type TransitionError struct {
+	From string
+	To   string
+	Role string
+	err  error
+}
+
+func (e *TransitionError) Error() string {
+	if e.err == ErrTransitionForbidden {
+		return fmt.Sprintf("%s: role '%s' tidak boleh mengubah status %s -> %s", e.err, e.Role, e.From, e.To)
+	}
+	return fmt.Sprintf("%s: %s -> %s", e.err, e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error { return e.err }
+
+// Allowed mengembalikan status tujuan yang boleh dipilih role tersebut dari status saat ini
+func (e *TransitionError) Allowed() []string {
+	return AllowedTransitions(e.From, e.Role)
+}
+
+// IsValidStatus mengecek apakah status dikenal
+func IsValidStatus(status string) bool {
+	switch status {
+	case StatusDraft, StatusInProgress, StatusCompleted, StatusRejected, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// AllowedTransitions mengembalikan status tujuan yang boleh dipilih role tertentu dari status saat ini
+func AllowedTransitions(from, role string) []string {
+	allowed := []string{}
+	for _, to := range []string{StatusDraft, StatusInProgress, StatusCompleted, StatusRejected, StatusCancelled} {
+		if checkTransition(from, to, role) == nil {
+			allowed = append(allowed, to)
+		}
+	}
+	return allowed
+}
+
+// checkTransition memeriksa perpindahan status terhadap tabel transisi dan role user
+func checkTransition(from, to, role string) error {
+	if !IsValidStatus(to) {
+		return fmt.Errorf("%w: '%s'", ErrInvalidStatus, to)
+	}
+	roles, ok := statusTransitions[from][to]
+	if !ok {
+		return &TransitionError{From: from, To: to, Role: role, err: ErrInvalidTransition}
+	}
+	for _, r := range roles {
+		if r == role {
+			return nil
+		}
+	}
+	return &TransitionError{From: from, To: to, Role: role, err: ErrTransitionForbidden}
+}
+
+// transitionStatus mengunci instance, memeriksa revision dan transisi untuk role user lalu
+// menyimpan status baru. Mengembalikan status lama.
+func transitionStatus(tx *sqlx.Tx, instanceID int64, to, role string, revision int) (string, error) {
+	from, err := lockStatus(tx, instanceID, revision)
+	if err != nil {
+		return "", err
+	}
+	if err := checkTransition(from, to, role); err != nil {
+		return from, err
+	}
+	return from, applyStatus(tx, instanceID, to)
+}
+
+// lockStatus membaca status instance sambil mengunci barisnya sampai transaksi selesai.
+// revision adalah nilai If-Match dari client; jika sudah usang hasilnya ErrRevisionConflict.
+func lockStatus(tx *sqlx.Tx, instanceID int64, revision int) (string, error) {
+	var current struct {
+		Status   string `db:"status"`
+		Revision int    `db:"revision"`
+	}
+	err := tx.Get(&current, "SELECT status, revision FROM process_instances WHERE id = ? FOR UPDATE", instanceID)
+	if err == sql.ErrNoRows {
+		return "", ErrInstanceNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if current.Revision != revision {
+		return current.Status, ErrRevisionConflict
+	}
+	return current.Status, nil
+}
+
+// instanceRevision membaca revision instance di dalam transaksi (setelah semua perubahan ditulis)
+func instanceRevision(tx *sqlx.Tx, instanceID int64) (int, error) {
+	var revision int
+	err := tx.Get(&revision, "SELECT revision FROM process_instances WHERE id = ?", instanceID)
+	return revision, err
+}
+
+// applyStatus menyimpan status baru tanpa memeriksa role (pemeriksaan dilakukan pemanggil).
+// start_time diisi saat instance pertama kali dikerjakan; end_time dan duration_minutes
+// diisi saat instance selesai, ditolak atau dibatalkan, dan dikosongkan lagi saat rework.
+// Rework juga memulai putaran approval baru. Setiap perubahan status menaikkan revision.
+func applyStatus(tx *sqlx.Tx, instanceID int64, to string) error {
+	query := "UPDATE process_instances SET status = ?, revision = revision + 1, updated_at = NOW() WHERE id = ?"
+	switch to {
+	case StatusInProgress:
+		query = `
+			UPDATE process_instances
+			SET status = ?, start_time = COALESCE(start_time, NOW()), end_time = NULL, duration_minutes = NULL,
+			    revision = revision + 1, updated_at = NOW()
+			WHERE id = ?
+		`
+		if _, err := tx.Exec("DELETE FROM instance_approvals WHERE instance_id = ?", instanceID); err != nil {
+			return err
+		}
+	case StatusCompleted, StatusRejected, StatusCancelled:
+		query = `
+			UPDATE process_instances
+			SET status = ?, end_time = NOW(),
+			    duration_minutes = IF(start_time IS NULL, NULL, TIMESTAMPDIFF(MINUTE, start_time, NOW())),
+			    revision = revision + 1, updated_at = NOW()
+			WHERE id = ?
+		`
+	}
+	_, err := tx.Exec(query, to, instanceID)
+	return err
+}
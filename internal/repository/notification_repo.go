@@ -3,6 +3,8 @@ package repository
 import (
 	"pt-besq-core/internal/database"
 	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
 // Notification represents a system notification
@@ -27,11 +29,16 @@ func NewNotificationRepository() *NotificationRepository {
 
 // Create creates a new notification
 func (r *NotificationRepository) Create(notif Notification) (int64, error) {
+	return createNotification(database.DB, notif)
+}
+
+// createNotification inserts a notification using db or an open transaction
+func createNotification(db sqlx.Execer, notif Notification) (int64, error) {
 	query := `
 		INSERT INTO notifications (user_id, type, title, message, related_entity_type, related_entity_id, created_at)
 		VALUES (?, ?, ?, ?, ?, ?, NOW())
 	`
-	result, err := database.DB.Exec(query,
+	result, err := db.Exec(query,
 		notif.UserID, notif.Type, notif.Title, notif.Message,
 		notif.RelatedEntityType, notif.RelatedEntityID,
 	)
@@ -0,0 +1,7 @@
+package repository
+
+import "errors"
+
+// ErrRevisionConflict dikembalikan saat update membawa revision (If-Match) yang sudah usang:
+// data sudah diubah request lain sejak client membacanya.
+var ErrRevisionConflict = errors.New("resource was modified by another request")
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pt-besq-core/internal/database"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrInvalidSignatureMeaning = errors.New("invalid signature meaning")
+
+// Arti tanda tangan elektronik yang dicatat bersama keputusan
+const (
+	MeaningReviewed = "reviewed"
+	MeaningApproved = "approved"
+	MeaningRejected = "rejected"
+)
+
+// genesisHash adalah prev_hash untuk tanda tangan pertama sebuah instance
+var genesisHash = strings.Repeat("0", 64)
+
+// ElectronicSignature adalah satu tanda tangan elektronik. Record tidak pernah diubah:
+// record_hash mengikat semua kolomnya, dan prev_hash merantai ke tanda tangan sebelumnya
+// sehingga perubahan atau penghapusan record ikut terdeteksi.
+type ElectronicSignature struct {
+	ID          int64     `db:"id" json:"id"`
+	InstanceID  int64     `db:"instance_id" json:"instance_id"`
+	UserID      int       `db:"user_id" json:"user_id"`
+	Username    string    `db:"username" json:"username"`
+	FullName    string    `db:"full_name" json:"full_name"`
+	Meaning     string    `db:"meaning" json:"meaning"`
+	Decision    string    `db:"decision" json:"decision"`
+	StepName    string    `db:"step_name" json:"step_name"`
+	Comment     string    `db:"comment" json:"comment,omitempty"`
+	PayloadHash string    `db:"payload_hash" json:"payload_hash"`
+	PrevHash    string    `db:"prev_hash" json:"prev_hash"`
+	RecordHash  string    `db:"record_hash" json:"record_hash"`
+	SignedAt    time.Time `db:"signed_at" json:"signed_at"`
+}
+
+// SignatureCheck adalah hasil verifikasi satu tanda tangan
+type SignatureCheck struct {
+	ElectronicSignature
+	RecordIntact   bool `json:"record_intact"`   // isi record sama dengan saat ditandatangani
+	ChainIntact    bool `json:"chain_intact"`    // tidak ada tanda tangan sebelumnya yang hilang/diubah
+	PayloadMatches bool `json:"payload_matches"` // data_payload sekarang sama dengan yang ditandatangani
+	Superseded     bool `json:"superseded"`      // ada penolakan sesudahnya, data boleh sudah dikerjakan ulang
+}
+
+// SignatureVerification adalah hasil verifikasi semua tanda tangan sebuah instance
+type SignatureVerification struct {
+	InstanceID  int64            `json:"instance_id"`
+	PayloadHash string           `json:"payload_hash"`
+	Valid       bool             `json:"valid"`
+	Signatures  []SignatureCheck `json:"signatures"`
+}
+
+// hashPayload menghitung SHA-256 dari data_payload dalam bentuk kanonik
+// (key terurut, tanpa spasi) supaya format penyimpanan tidak memengaruhi hasilnya
+func hashPayload(raw []byte) (string, error) {
+	var data interface{}
+	if len(strings.TrimSpace(string(raw))) > 0 {
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return "", fmt.Errorf("data_payload tidak valid: %w", err)
+		}
+	}
+	canonical, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// recordHash mengikat semua kolom tanda tangan menjadi satu hash
+func (s ElectronicSignature) recordHash() string {
+	fields := []string{
+		fmt.Sprint(s.InstanceID), fmt.Sprint(s.UserID), s.Username, s.FullName,
+		s.Meaning, s.Decision, s.StepName, s.Comment,
+		s.PayloadHash, s.PrevHash, s.SignedAt.UTC().Format(time.RFC3339),
+	}
+	// Setiap kolom diberi panjangnya supaya pemisah di dalam isi kolom tidak bisa menggeser batas
+	var b strings.Builder
+	for _, f := range fields {
+		fmt.Fprintf(&b, "%d:%s|", len(f), f)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// signInstance mencatat tanda tangan elektronik di dalam transaksi approve/reject.
+// Baris instance harus sudah dikunci pemanggil supaya rantai hash tidak bercabang.
+func signInstance(tx *sqlx.Tx, instanceID int64, userID int, meaning, decision, stepName, comment string) (*ElectronicSignature, error) {
+	var inst struct {
+		Payload sql.NullString `db:"data_payload"`
+	}
+	if err := tx.Get(&inst, "SELECT data_payload FROM process_instances WHERE id = ?", instanceID); err != nil {
+		return nil, err
+	}
+	payloadHash, err := hashPayload([]byte(inst.Payload.String))
+	if err != nil {
+		return nil, err
+	}
+
+	var signer struct {
+		Username string `db:"username"`
+		FullName string `db:"full_name"`
+	}
+	if err := tx.Get(&signer, "SELECT username, COALESCE(full_name, '') as full_name FROM users WHERE id = ?", userID); err != nil {
+		return nil, fmt.Errorf("penanda tangan tidak ditemukan: %w", err)
+	}
+
+	prev := genesisHash
+	err = tx.Get(&prev, "SELECT record_hash FROM electronic_signatures WHERE instance_id = ? ORDER BY id DESC LIMIT 1", instanceID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	sig := &ElectronicSignature{
+		InstanceID:  instanceID,
+		UserID:      userID,
+		Username:    signer.Username,
+		FullName:    signer.FullName,
+		Meaning:     meaning,
+		Decision:    decision,
+		StepName:    stepName,
+		Comment:     comment,
+		PayloadHash: payloadHash,
+		PrevHash:    prev,
+		SignedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	sig.RecordHash = sig.recordHash()
+
+	res, err := tx.Exec(`
+		INSERT INTO electronic_signatures (instance_id, user_id, username, full_name, meaning, decision, step_name, comment,
+		                                   payload_hash, prev_hash, record_hash, signed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, sig.InstanceID, sig.UserID, sig.Username, sig.FullName, sig.Meaning, sig.Decision, sig.StepName, sig.Comment,
+		sig.PayloadHash, sig.PrevHash, sig.RecordHash, sig.SignedAt)
+	if err != nil {
+		return nil, err
+	}
+	sig.ID, err = res.LastInsertId()
+	return sig, err
+}
+
+// VerifySignatures memeriksa ulang semua tanda tangan instance: isi record, rantai hash,
+// dan apakah data_payload sekarang masih sama dengan yang ditandatangani.
+// Instance tanpa tanda tangan dianggap valid dengan daftar kosong.
+func (r *EnhancedInstanceRepository) VerifySignatures(instanceID int64) (*SignatureVerification, error) {
+	var payload sql.NullString
+	err := database.DB.Get(&payload, "SELECT data_payload FROM process_instances WHERE id = ?", instanceID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInstanceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	current, err := hashPayload([]byte(payload.String))
+	if err != nil {
+		return nil, err
+	}
+
+	var sigs []ElectronicSignature
+	err = database.DB.Select(&sigs, `
+		SELECT id, instance_id, user_id, username, COALESCE(full_name, '') as full_name, meaning, decision,
+		       COALESCE(step_name, '') as step_name, COALESCE(comment, '') as comment,
+		       payload_hash, prev_hash, record_hash, signed_at
+		FROM electronic_signatures
+		WHERE instance_id = ?
+		ORDER BY id ASC
+	`, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return verifySignatureChain(instanceID, sigs, current), nil
+}
+
+// verifySignatureChain memeriksa rantai tanda tangan terhadap hash data_payload sekarang.
+// Setiap penolakan menutup putarannya: tanda tangan sampai penolakan terakhir (termasuk
+// penolakan itu sendiri) boleh tidak cocok lagi dengan data yang sudah dikerjakan ulang.
+func verifySignatureChain(instanceID int64, sigs []ElectronicSignature, current string) *SignatureVerification {
+	lastReject := -1
+	for i, sig := range sigs {
+		if sig.Decision == "rejected" {
+			lastReject = i
+		}
+	}
+
+	result := &SignatureVerification{InstanceID: instanceID, PayloadHash: current, Valid: true, Signatures: []SignatureCheck{}}
+	prev := genesisHash
+	for i, sig := range sigs {
+		check := SignatureCheck{
+			ElectronicSignature: sig,
+			RecordIntact:        sig.recordHash() == sig.RecordHash,
+			ChainIntact:         sig.PrevHash == prev,
+			PayloadMatches:      sig.PayloadHash == current,
+			Superseded:          i <= lastReject,
+		}
+		if !check.RecordIntact || !check.ChainIntact || (!check.PayloadMatches && !check.Superseded) {
+			result.Valid = false
+		}
+		result.Signatures = append(result.Signatures, check)
+		prev = sig.RecordHash
+	}
+	return result
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func mustHashPayload(t *testing.T, raw string) string {
+	t.Helper()
+	h, err := hashPayload([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// signChain membangun rantai tanda tangan seperti signInstance; decisions dipasangkan dengan payloads
+func signChain(decisions, payloads []string) []ElectronicSignature {
+	var sigs []ElectronicSignature
+	prev := genesisHash
+	signedAt := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	for i, decision := range decisions {
+		sig := ElectronicSignature{
+			ID: int64(i + 1), InstanceID: 42, UserID: 3, Username: "spv", FullName: "Supervisor",
+			Meaning: MeaningApproved, Decision: decision, StepName: "QC",
+			PayloadHash: payloads[i], PrevHash: prev, SignedAt: signedAt.Add(time.Duration(i) * time.Hour),
+		}
+		if decision == "rejected" {
+			sig.Meaning = MeaningRejected
+		}
+		sig.RecordHash = sig.recordHash()
+		prev = sig.RecordHash
+		sigs = append(sigs, sig)
+	}
+	return sigs
+}
+
+func TestHashPayloadCanonical(t *testing.T) {
+	if mustHashPayload(t, `{"b": 1, "a": [1, 2]}`) != mustHashPayload(t, `{"a":[1,2],"b":1}`) {
+		t.Fatal("urutan key dan spasi memengaruhi hash")
+	}
+	if mustHashPayload(t, "") != mustHashPayload(t, "null") {
+		t.Fatal("payload kosong seharusnya sama dengan null")
+	}
+	if _, err := hashPayload([]byte("{")); err == nil {
+		t.Fatal("payload rusak seharusnya error")
+	}
+}
+
+func TestVerifySignatureChain(t *testing.T) {
+	v1 := mustHashPayload(t, `{"berat": 10}`)
+	v2 := mustHashPayload(t, `{"berat": 12}`)
+	v3 := mustHashPayload(t, `{"berat": 13}`)
+
+	tests := []struct {
+		name       string
+		sigs       []ElectronicSignature
+		current    string
+		valid      bool
+		superseded []bool
+	}{
+		{"tanpa tanda tangan", nil, v1, true, nil},
+		{"disetujui dan data tidak berubah",
+			signChain([]string{"approved", "approved"}, []string{v1, v1}), v1, true, []bool{false, false}},
+		{"data diubah sesudah disetujui",
+			signChain([]string{"approved"}, []string{v1}), v2, false, []bool{false}},
+		// Penolakan terakhir juga menutup putarannya, jadi data boleh langsung dikerjakan ulang
+		{"ditolak lalu data dikerjakan ulang",
+			signChain([]string{"approved", "rejected"}, []string{v1, v1}), v2, true, []bool{true, true}},
+		{"ditolak, dikerjakan ulang, lalu disetujui",
+			signChain([]string{"approved", "rejected", "approved"}, []string{v1, v1, v2}), v2, true, []bool{true, true, false}},
+		{"diubah lagi sesudah persetujuan putaran baru",
+			signChain([]string{"rejected", "approved"}, []string{v1, v2}), v3, false, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := verifySignatureChain(42, tt.sigs, tt.current)
+			if res.Valid != tt.valid {
+				t.Errorf("valid = %v, want %v", res.Valid, tt.valid)
+			}
+			if len(res.Signatures) != len(tt.superseded) {
+				t.Fatalf("signatures = %d, want %d", len(res.Signatures), len(tt.superseded))
+			}
+			for i, check := range res.Signatures {
+				if check.Superseded != tt.superseded[i] {
+					t.Errorf("signatures[%d].superseded = %v, want %v", i, check.Superseded, tt.superseded[i])
+				}
+				if !check.RecordIntact || !check.ChainIntact {
+					t.Errorf("signatures[%d] rusak: record %v, chain %v", i, check.RecordIntact, check.ChainIntact)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifySignatureChainTampered(t *testing.T) {
+	v1 := mustHashPayload(t, `{"berat": 10}`)
+
+	// Isi record diubah sesudah ditandatangani
+	sigs := signChain([]string{"approved", "rejected"}, []string{v1, v1})
+	sigs[1].Comment = "diubah"
+	res := verifySignatureChain(42, sigs, v1)
+	if res.Valid || res.Signatures[1].RecordIntact {
+		t.Errorf("record yang diubah lolos: %+v", res.Signatures[1])
+	}
+
+	// Tanda tangan di tengah dihapus
+	sigs = signChain([]string{"approved", "rejected", "approved"}, []string{v1, v1, v1})
+	sigs = append(sigs[:1], sigs[2])
+	res = verifySignatureChain(42, sigs, v1)
+	if res.Valid || res.Signatures[1].ChainIntact {
+		t.Errorf("rantai yang terputus lolos: %+v", res.Signatures[1])
+	}
+}
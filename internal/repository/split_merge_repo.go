@@ -0,0 +1,434 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"pt-besq-core/internal/database"
+	"pt-besq-core/internal/entity"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrQuantityMismatch    = errors.New("quantities do not balance")
+	ErrBatchUnavailable    = errors.New("batch cannot be split or merged")
+	ErrIncompatibleBatches = errors.New("batches cannot be merged")
+)
+
+// Jenis hubungan genealogy dari operasi split/merge
+const (
+	LinkSplit  = "split"
+	LinkMerged = "merged"
+)
+
+// SplitPart adalah satu bagian hasil split
+type SplitPart struct {
+	Quantity float64 `json:"quantity" binding:"required"`
+}
+
+// MergeSource adalah satu batch yang digabung. Quantity nil berarti seluruh sisa batch.
+type MergeSource struct {
+	InstanceID int64    `json:"instance_id" binding:"required"`
+	Quantity   *float64 `json:"quantity,omitempty"`
+}
+
+// BatchAllocation adalah jumlah yang dipindahkan dari/ke satu instance
+type BatchAllocation struct {
+	InstanceID  int64   `json:"instance_id"`
+	BatchNumber string  `json:"batch_number,omitempty"`
+	Quantity    float64 `json:"quantity"`
+	Unit        string  `json:"unit,omitempty"`
+}
+
+// BatchOperation adalah hasil split atau merge
+type BatchOperation struct {
+	Operation string            `json:"operation"` // split atau merged
+	Sources   []BatchAllocation `json:"sources"`
+	Created   []BatchAllocation `json:"created"`
+	Closed    []int64           `json:"closed,omitempty"` // sumber yang habis dan ditutup (cancelled)
+}
+
+// batchStock adalah instance sumber beserta sisa quantity yang belum di-split/merge
+type batchStock struct {
+	ID              int64      `db:"id"`
+	TemplateID      int        `db:"template_id"`
+	TemplateVersion int        `db:"template_version"`
+	WorkflowID      int        `db:"workflow_id"`
+	WorkflowVersion int        `db:"workflow_version"`
+	NodeID          string     `db:"node_id"`
+	RootInstanceID  *int64     `db:"root_instance_id"`
+	BatchNumber     string     `db:"batch_number"`
+	Status          string     `db:"status"`
+	ApprovedAt      *time.Time `db:"approved_at"`
+	Quantity        *float64   `db:"quantity"`
+	Unit            string     `db:"unit"`
+	DataPayload     []byte     `db:"data_payload"`
+	Allocated       float64    `db:"allocated"`
+}
+
+// available adalah sisa quantity dalam satuan 0.001 (presisi kolom DECIMAL(14,3))
+func (s *batchStock) available() int64 {
+	return toMilli(*s.Quantity) - toMilli(s.Allocated)
+}
+
+func (s *batchStock) label() string {
+	if s.BatchNumber != "" {
+		return s.BatchNumber
+	}
+	return fmt.Sprintf("#%d", s.ID)
+}
+
+// toMilli membulatkan quantity ke 0.001 supaya penjumlahan float tidak membuat selisih palsu
+func toMilli(q float64) int64 {
+	return int64(math.Round(q * 1000))
+}
+
+func fromMilli(m int64) float64 {
+	return float64(m) / 1000
+}
+
+// formatQuantity menampilkan quantity untuk pesan error, misalnya "50 kg"
+func formatQuantity(m int64, unit string) string {
+	s := strconv.FormatFloat(fromMilli(m), 'f', -1, 64)
+	if unit != "" {
+		s += " " + unit
+	}
+	return s
+}
+
+// loadBatchStock mengunci dan membaca instance sumber split/merge
+func loadBatchStock(tx *sqlx.Tx, ids []int64) (map[int64]*batchStock, error) {
+	if err := lockInstances(tx, ids...); err != nil {
+		return nil, err
+	}
+	query, args, err := sqlx.In(`
+		SELECT i.id, i.template_id, COALESCE(i.template_version, 0) as template_version, i.workflow_id, COALESCE(i.workflow_version, 0) as workflow_version,
+		       COALESCE(i.node_id, '') as node_id, i.root_instance_id, COALESCE(i.batch_number, '') as batch_number,
+		       i.status, i.approved_at, i.quantity, COALESCE(i.unit, '') as unit, COALESCE(i.data_payload, '{}') as data_payload,
+		       COALESCE((SELECT SUM(l.quantity) FROM instance_links l
+		                 WHERE l.parent_instance_id = i.id AND l.link_type IN ('split', 'merged')), 0) as allocated
+		FROM process_instances i WHERE i.id IN (?)
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	var rows []batchStock
+	if err := tx.Select(&rows, query, args...); err != nil {
+		return nil, err
+	}
+	stock := make(map[int64]*batchStock, len(rows))
+	for i := range rows {
+		s := &rows[i]
+		if err := checkBatchUsable(s); err != nil {
+			return nil, err
+		}
+		stock[s.ID] = s
+	}
+	return stock, nil
+}
+
+// checkBatchUsable memastikan batch masih bisa di-split/merge. Batch yang sudah completed atau
+// disetujui ditolak karena tahap berikutnya sudah dibuat darinya; hasil split/merge di stage yang
+// sama akan memunculkan tahap berikutnya sekali lagi.
+func checkBatchUsable(s *batchStock) error {
+	switch {
+	case s.Quantity != nil && s.available() <= 0:
+		return fmt.Errorf("%w: %s sudah habis di-split/merge", ErrBatchUnavailable, s.label())
+	case s.Status == StatusCompleted || s.Status == StatusCancelled || s.Status == StatusRejected:
+		return fmt.Errorf("%w: %s berstatus %s", ErrBatchUnavailable, s.label(), s.Status)
+	case s.ApprovedAt != nil:
+		return fmt.Errorf("%w: %s sudah disetujui", ErrBatchUnavailable, s.label())
+	case s.Quantity == nil:
+		return fmt.Errorf("%w: %s belum punya quantity", ErrBatchUnavailable, s.label())
+	}
+	return nil
+}
+
+// SplitInstance membagi seluruh sisa quantity sebuah batch ke beberapa instance baru
+// (misalnya satu batch mixing untuk dua oven). Instance baru memakai template (dengan versi yang sama),
+// workflow dan stage yang sama, menyalin data_payload sumber tanpa kolom file (lampiran tetap milik sumber), dan mendapat
+// nomor batch sendiri. Jumlah semua bagian harus sama persis dengan sisa quantity sumber.
+// Sumber yang habis ditutup sebagai cancelled supaya tidak bisa completed dan memunculkan tahap berikutnya.
+func (r *EnhancedInstanceRepository) SplitInstance(sourceID int64, parts []SplitPart, userID int, reason string) (*BatchOperation, error) {
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("%w: split butuh minimal 2 bagian", ErrQuantityMismatch)
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stock, err := loadBatchStock(tx, []int64{sourceID})
+	if err != nil {
+		return nil, err
+	}
+	src := stock[sourceID]
+	total, err := splitTotal(src, parts)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := GetFieldDefsForVersion(src.TemplateID, src.TemplateVersion)
+	if err != nil {
+		return nil, err
+	}
+	data, err := withoutFileFields(src.DataPayload, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	rootID := sourceID
+	if src.RootInstanceID != nil {
+		rootID = *src.RootInstanceID
+	}
+	op := &BatchOperation{
+		Operation: LinkSplit,
+		Sources:   []BatchAllocation{{InstanceID: src.ID, BatchNumber: src.BatchNumber, Quantity: fromMilli(total), Unit: src.Unit}},
+	}
+	for _, part := range parts {
+		quantity := fromMilli(toMilli(part.Quantity))
+		id, batchNumber, err := insertInstance(tx, NewInstance{
+			WorkflowID:      src.WorkflowID,
+			WorkflowVersion: src.WorkflowVersion,
+			TemplateID:      src.TemplateID,
+			TemplateVersion: src.TemplateVersion,
+			Data:            data,
+			CreatedBy:       userID,
+			NodeID:          src.NodeID,
+			RootInstanceID:  rootID,
+			Quantity:        &quantity,
+			Unit:            src.Unit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		link := InstanceLink{ParentID: src.ID, ChildID: id, Quantity: &quantity, Unit: src.Unit}
+		if err := insertLink(tx, link, LinkSplit, userID); err != nil {
+			return nil, err
+		}
+		op.Created = append(op.Created, BatchAllocation{InstanceID: id, BatchNumber: batchNumber, Quantity: quantity, Unit: src.Unit})
+	}
+
+	if err := closeExhausted(tx, op, src, total, userID); err != nil {
+		return nil, err
+	}
+	if err := logBatchOperation(tx, op, userID, reason); err != nil {
+		return nil, err
+	}
+	return op, tx.Commit()
+}
+
+// MergeInstances menggabungkan beberapa batch (misalnya sisa-sisa kecil) menjadi satu instance baru.
+// Semua sumber harus dari template, versi template, workflow, stage dan satuan yang sama. Instance baru
+// memakai root_instance_id sumber pertama (seperti split), mulai sebagai draft dengan data kosong, dan
+// quantity-nya jumlah semua yang diambil. Sumber yang habis ditutup seperti pada split.
+func (r *EnhancedInstanceRepository) MergeInstances(sources []MergeSource, userID int, reason string) (*BatchOperation, error) {
+	if len(sources) < 2 {
+		return nil, fmt.Errorf("%w: merge butuh minimal 2 batch", ErrIncompatibleBatches)
+	}
+	ids := make([]int64, 0, len(sources))
+	seen := map[int64]bool{}
+	for _, s := range sources {
+		if seen[s.InstanceID] {
+			return nil, fmt.Errorf("%w: instance #%d disebut lebih dari sekali", ErrIncompatibleBatches, s.InstanceID)
+		}
+		seen[s.InstanceID] = true
+		ids = append(ids, s.InstanceID)
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stock, err := loadBatchStock(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+	first := stock[sources[0].InstanceID]
+
+	op := &BatchOperation{Operation: LinkMerged}
+	taken := make(map[int64]int64, len(sources))
+	var total int64
+	for _, s := range sources {
+		src := stock[s.InstanceID]
+		if err := checkMergeCompatible(first, src); err != nil {
+			return nil, err
+		}
+		take, err := mergeTake(src, s.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		taken[src.ID] = take
+		total += take
+		op.Sources = append(op.Sources, BatchAllocation{InstanceID: src.ID, BatchNumber: src.BatchNumber, Quantity: fromMilli(take), Unit: src.Unit})
+	}
+
+	rootID := first.ID
+	if first.RootInstanceID != nil {
+		rootID = *first.RootInstanceID
+	}
+	quantity := fromMilli(total)
+	id, batchNumber, err := insertInstance(tx, NewInstance{
+		WorkflowID:      first.WorkflowID,
+		WorkflowVersion: first.WorkflowVersion,
+		TemplateID:      first.TemplateID,
+		TemplateVersion: first.TemplateVersion,
+		Data:            []byte("{}"),
+		CreatedBy:       userID,
+		NodeID:          first.NodeID,
+		RootInstanceID:  rootID,
+		Quantity:        &quantity,
+		Unit:            first.Unit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range op.Sources {
+		quantity := a.Quantity
+		link := InstanceLink{ParentID: a.InstanceID, ChildID: id, Quantity: &quantity, Unit: a.Unit}
+		if err := insertLink(tx, link, LinkMerged, userID); err != nil {
+			return nil, err
+		}
+	}
+	op.Created = []BatchAllocation{{InstanceID: id, BatchNumber: batchNumber, Quantity: quantity, Unit: first.Unit}}
+
+	for _, s := range sources {
+		if err := closeExhausted(tx, op, stock[s.InstanceID], taken[s.InstanceID], userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := logBatchOperation(tx, op, userID, reason); err != nil {
+		return nil, err
+	}
+	return op, tx.Commit()
+}
+
+// checkMergeCompatible memastikan sumber merge bisa digabung dengan sumber pertama: data instance
+// hasil mengikuti satu versi template, dan instance itu harus berada di stage workflow yang sama
+// supaya completed-nya hanya memunculkan satu tahap berikutnya.
+func checkMergeCompatible(first, src *batchStock) error {
+	switch {
+	case src.TemplateID != first.TemplateID:
+		return fmt.Errorf("%w: %s memakai template lain dari %s", ErrIncompatibleBatches, src.label(), first.label())
+	case src.TemplateVersion != first.TemplateVersion:
+		return fmt.Errorf("%w: %s memakai template versi %d, %s versi %d", ErrIncompatibleBatches,
+			src.label(), src.TemplateVersion, first.label(), first.TemplateVersion)
+	case src.WorkflowID != first.WorkflowID || src.NodeID != first.NodeID:
+		return fmt.Errorf("%w: %s berada di workflow/stage lain dari %s", ErrIncompatibleBatches, src.label(), first.label())
+	case src.Unit != first.Unit:
+		return fmt.Errorf("%w: satuan %s (%s) berbeda dengan %s (%s)", ErrIncompatibleBatches, src.label(), src.Unit, first.label(), first.Unit)
+	}
+	return nil
+}
+
+// splitTotal memeriksa bahwa setiap bagian lebih dari 0 dan jumlahnya (dalam 0.001) sama persis
+// dengan sisa quantity sumber. Mengembalikan total dalam 0.001.
+func splitTotal(src *batchStock, parts []SplitPart) (int64, error) {
+	var total int64
+	for i, part := range parts {
+		if toMilli(part.Quantity) <= 0 {
+			return 0, fmt.Errorf("%w: bagian #%d harus lebih dari 0", ErrInvalidQuantity, i+1)
+		}
+		total += toMilli(part.Quantity)
+	}
+	if total != src.available() {
+		return 0, fmt.Errorf("%w: %s tersisa %s, tidak bisa dibagi menjadi %s", ErrQuantityMismatch,
+			src.label(), formatQuantity(src.available(), src.Unit), formatQuantity(total, src.Unit))
+	}
+	return total, nil
+}
+
+// mergeTake menghitung quantity yang diambil dari satu sumber merge dalam 0.001.
+// quantity nil berarti seluruh sisa sumber.
+func mergeTake(src *batchStock, quantity *float64) (int64, error) {
+	if quantity == nil {
+		return src.available(), nil
+	}
+	take := toMilli(*quantity)
+	if take <= 0 {
+		return 0, fmt.Errorf("%w: quantity dari %s harus lebih dari 0", ErrInvalidQuantity, src.label())
+	}
+	if take > src.available() {
+		return 0, fmt.Errorf("%w: %s hanya tersisa %s, tidak bisa diambil %s", ErrQuantityMismatch,
+			src.label(), formatQuantity(src.available(), src.Unit), formatQuantity(take, src.Unit))
+	}
+	return take, nil
+}
+
+// withoutFileFields menghapus kolom bertipe file dari payload. File lampiran terikat ke satu
+// instance, jadi instance hasil split tidak boleh ikut merujuknya.
+func withoutFileFields(payload []byte, fields []entity.FieldDef) ([]byte, error) {
+	data := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, fmt.Errorf("data_payload tidak valid: %w", err)
+	}
+	for _, f := range fields {
+		if f.Type == "file" {
+			delete(data, f.Key)
+		}
+	}
+	return json.Marshal(data)
+}
+
+// closeExhausted menutup sumber yang seluruh sisa quantity-nya baru saja diambil (status cancelled,
+// dicatat di riwayat) supaya batch yang sudah habis tidak bisa completed dan memunculkan tahap
+// berikutnya.
+func closeExhausted(tx *sqlx.Tx, op *BatchOperation, src *batchStock, taken int64, userID int) error {
+	if taken < src.available() {
+		return nil
+	}
+	if err := applyStatus(tx, src.ID, StatusCancelled); err != nil {
+		return err
+	}
+	comment := "seluruh quantity sudah di-split"
+	if op.Operation == LinkMerged {
+		comment = "seluruh quantity sudah di-merge"
+	}
+	oldVal, _ := json.Marshal(map[string]string{"status": src.Status})
+	newVal, _ := json.Marshal(map[string]string{"status": StatusCancelled})
+	_, err := tx.Exec(`
+		INSERT INTO instance_history (instance_id, action, old_value, new_value, changed_by, comment, created_at)
+		VALUES (?, 'status_changed', ?, ?, ?, ?, NOW())
+	`, src.ID, oldVal, newVal, nullableID(userID), comment)
+	if err != nil {
+		return err
+	}
+	op.Closed = append(op.Closed, src.ID)
+	return nil
+}
+
+// logBatchOperation mencatat split/merge di riwayat setiap sumber (old_value: yang diambil,
+// new_value: instance hasil) dan setiap instance hasil (old_value: sumber, new_value: isinya)
+func logBatchOperation(tx *sqlx.Tx, op *BatchOperation, userID int, reason string) error {
+	created, _ := json.Marshal(map[string]interface{}{"created": op.Created})
+	sources, _ := json.Marshal(map[string]interface{}{"sources": op.Sources})
+	insert := func(instanceID int64, oldVal, newVal []byte) error {
+		_, err := tx.Exec(`
+			INSERT INTO instance_history (instance_id, action, old_value, new_value, changed_by, comment, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, NOW())
+		`, instanceID, op.Operation, oldVal, newVal, nullableID(userID), reason)
+		return err
+	}
+	for _, a := range op.Sources {
+		taken, _ := json.Marshal(a)
+		if err := insert(a.InstanceID, taken, created); err != nil {
+			return err
+		}
+	}
+	for _, a := range op.Created {
+		result, _ := json.Marshal(a)
+		if err := insert(a.InstanceID, sources, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"pt-besq-core/internal/entity"
+	"testing"
+	"time"
+)
+
+func stockOf(quantity, allocated float64) *batchStock {
+	return &batchStock{ID: 7, BatchNumber: "MIX-001", Quantity: &quantity, Allocated: allocated, Unit: "kg"}
+}
+
+func TestToMilli(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want int64
+	}{
+		{0, 0},
+		{50, 50000},
+		{0.1 + 0.2, 300},
+		{12.3456, 12346},
+		{0.0004, 0},
+		{-1.5, -1500},
+	}
+	for _, tt := range tests {
+		if got := toMilli(tt.in); got != tt.want {
+			t.Errorf("toMilli(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitTotal(t *testing.T) {
+	tests := []struct {
+		name      string
+		quantity  float64
+		allocated float64
+		parts     []float64
+		want      int64
+		wantErr   error
+	}{
+		{"pas", 50, 0, []float64{30, 20}, 50000, nil},
+		{"30+30 bukan 50", 50, 0, []float64{30, 30}, 0, ErrQuantityMismatch},
+		{"kurang dari sisa", 50, 0, []float64{20, 20}, 0, ErrQuantityMismatch},
+		{"pecahan float tetap seimbang", 0.3, 0, []float64{0.1, 0.2}, 300, nil},
+		{"sepertiga", 100, 0, []float64{33.333, 33.333, 33.334}, 100000, nil},
+		{"memakai sisa setelah merge", 50, 12.5, []float64{20, 17.5}, 37500, nil},
+		{"bagian nol", 50, 0, []float64{50, 0}, 0, ErrInvalidQuantity},
+		{"bagian di bawah presisi", 50, 0, []float64{50, 0.0004}, 0, ErrInvalidQuantity},
+		{"bagian negatif", 50, 0, []float64{60, -10}, 0, ErrInvalidQuantity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := make([]SplitPart, len(tt.parts))
+			for i, q := range tt.parts {
+				parts[i] = SplitPart{Quantity: q}
+			}
+			got, err := splitTotal(stockOf(tt.quantity, tt.allocated), parts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("splitTotal = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBatchUsable(t *testing.T) {
+	approvedAt := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		modify func(s *batchStock)
+		ok     bool
+	}{
+		{"draft", func(s *batchStock) { s.Status = StatusDraft }, true},
+		{"in progress", func(s *batchStock) { s.Status = StatusInProgress }, true},
+		{"sudah completed", func(s *batchStock) { s.Status = StatusCompleted }, false},
+		{"sudah disetujui", func(s *batchStock) { s.Status = StatusInProgress; s.ApprovedAt = &approvedAt }, false},
+		{"cancelled", func(s *batchStock) { s.Status = StatusCancelled }, false},
+		{"rejected", func(s *batchStock) { s.Status = StatusRejected }, false},
+		{"sudah habis", func(s *batchStock) { s.Status = StatusDraft; s.Allocated = 50 }, false},
+		{"tanpa quantity", func(s *batchStock) { s.Status = StatusDraft; s.Quantity = nil }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := stockOf(50, 0)
+			tt.modify(s)
+			err := checkBatchUsable(s)
+			if tt.ok && err != nil {
+				t.Fatalf("checkBatchUsable: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrBatchUnavailable) {
+				t.Fatalf("err = %v, want %v", err, ErrBatchUnavailable)
+			}
+		})
+	}
+}
+
+func TestCheckMergeCompatible(t *testing.T) {
+	batch := func(id int64) *batchStock {
+		s := stockOf(50, 0)
+		s.ID, s.BatchNumber = id, ""
+		s.TemplateID, s.TemplateVersion, s.WorkflowID, s.NodeID = 1, 2, 3, "mix"
+		return s
+	}
+	tests := []struct {
+		name   string
+		modify func(s *batchStock)
+		ok     bool
+	}{
+		{"sama", func(s *batchStock) {}, true},
+		{"template lain", func(s *batchStock) { s.TemplateID = 4 }, false},
+		{"versi template lain", func(s *batchStock) { s.TemplateVersion = 1 }, false},
+		{"workflow lain", func(s *batchStock) { s.WorkflowID = 5 }, false},
+		{"stage lain", func(s *batchStock) { s.NodeID = "oven" }, false},
+		{"satuan lain", func(s *batchStock) { s.Unit = "ton" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := batch(8)
+			tt.modify(src)
+			err := checkMergeCompatible(batch(7), src)
+			if tt.ok && err != nil {
+				t.Fatalf("checkMergeCompatible: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrIncompatibleBatches) {
+				t.Fatalf("err = %v, want %v", err, ErrIncompatibleBatches)
+			}
+		})
+	}
+}
+
+func TestMergeTake(t *testing.T) {
+	q := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name     string
+		quantity *float64
+		want     int64
+		wantErr  error
+	}{
+		{"seluruh sisa", nil, 37500, nil},
+		{"sebagian", q(12.25), 12250, nil},
+		{"tepat sisa", q(37.5), 37500, nil},
+		{"selisih pembulatan float", q(37.4999999), 37500, nil},
+		{"melebihi sisa", q(37.501), 0, ErrQuantityMismatch},
+		{"nol", q(0), 0, ErrInvalidQuantity},
+		{"negatif", q(-1), 0, ErrInvalidQuantity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeTake(stockOf(50, 12.5), tt.quantity)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("mergeTake = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithoutFileFields(t *testing.T) {
+	fields := []entity.FieldDef{
+		{Key: "suhu", Type: "number"},
+		{Key: "foto", Type: "file"},
+		{Key: "sertifikat", Type: "file"},
+	}
+	out, err := withoutFileFields([]byte(`{"suhu": 180, "foto": 12, "catatan": "ok"}`), fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["foto"]; ok {
+		t.Errorf("kolom file masih ada: %s", out)
+	}
+	if got["suhu"] != float64(180) || got["catatan"] != "ok" {
+		t.Errorf("kolom lain berubah: %s", out)
+	}
+
+	if _, err := withoutFileFields([]byte(`[1, 2]`), fields); err == nil {
+		t.Error("payload bukan objek seharusnya error")
+	}
+}
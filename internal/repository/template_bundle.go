@@ -0,0 +1,311 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pt-besq-core/internal/database"
+	"pt-besq-core/internal/entity"
+	"pt-besq-core/internal/validation"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// BundleFormat adalah penanda dokumen export template
+	BundleFormat = "besq.template"
+	// BundleFormatVersion naik setiap kali struktur bundle berubah tidak kompatibel.
+	// Versi 2 menambah key template dan nama template yang dirujuk options_from.
+	BundleFormatVersion = 2
+)
+
+// maxRenameAttempts membatasi pencarian nama bebas pada mode rename
+const maxRenameAttempts = 100
+
+// Cara menangani import jika sudah ada template aktif dengan nama atau key yang sama
+const (
+	ImportFail    = "fail"    // tolak import (default)
+	ImportSkip    = "skip"    // biarkan template yang ada, tidak ada perubahan
+	ImportReplace = "replace" // timpa kolom template yang ada (versi baru dipublish)
+	ImportRename  = "rename"  // buat template baru dengan nama "Nama (2)", "Nama (3)", ...
+)
+
+var (
+	ErrUnsupportedBundle  = errors.New("unsupported template bundle")
+	ErrInvalidImportMode  = errors.New("invalid import mode")
+	ErrUnresolvedTemplate = errors.New("referenced template not found")
+)
+
+// TemplateConflictError dikembalikan saat mode fail dan nama atau key template sudah dipakai
+type TemplateConflictError struct {
+	Name       string
+	ExistingID int
+}
+
+func (e *TemplateConflictError) Error() string {
+	return fmt.Sprintf("template '%s' sudah ada (id %d)", e.Name, e.ExistingID)
+}
+
+// ImportResult menjelaskan apa yang dilakukan terhadap bundle
+type ImportResult struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Action string `json:"action"` // created, replaced, skipped
+}
+
+// ExportTemplate membuat bundle JSON dari template aktif beserta kolomnya
+func ExportTemplate(id int) (*entity.TemplateBundle, error) {
+	tmpl, err := GetTemplateByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]entity.BundleField, 0, len(tmpl.Fields))
+	for _, f := range tmpl.Fields {
+		refName, err := optionsFromTemplateName(f)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, entity.BundleField{
+			Key:            f.Key,
+			Label:          f.Label,
+			Type:           f.Type,
+			IsRequired:     f.IsRequired,
+			ValidationRule: f.ValidationRule,
+			Expression:     f.Expression,
+			ShowWhen:       f.ShowWhen,
+			RequiredWhen:   f.RequiredWhen,
+			DefaultValue:   f.DefaultValue,
+			Placeholder:    f.Placeholder,
+			HelpText:       f.HelpText,
+
+			OptionsFromTemplate: refName,
+		})
+	}
+
+	return &entity.TemplateBundle{
+		Format:        BundleFormat,
+		FormatVersion: BundleFormatVersion,
+		ExportedAt:    time.Now(),
+		Source:        entity.BundleSource{TemplateID: tmpl.ID, Version: tmpl.CurrentVersion},
+		Template: entity.BundleTemplate{
+			Name:              tmpl.Name,
+			Key:               TemplateKey(tmpl.Name),
+			Description:       tmpl.Description,
+			Category:          tmpl.Category,
+			Icon:              tmpl.Icon,
+			Color:             tmpl.Color,
+			EstimatedDuration: tmpl.EstimatedDuration,
+			Fields:            fields,
+		},
+	}, nil
+}
+
+// TemplateKey adalah kunci portabel template: nama dalam huruf kecil dengan selain huruf/angka
+// diganti "-", misalnya "Oven Curing" dan "oven-curing" sama-sama "oven-curing"
+func TemplateKey(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// optionsFromTemplateName mengembalikan nama template yang dirujuk options_from sebuah kolom ("" jika tidak ada)
+func optionsFromTemplateName(f entity.FieldDef) (string, error) {
+	rule, err := validation.ParseRule(f.ValidationRule)
+	if err != nil || rule.OptionsFrom == nil {
+		return "", err
+	}
+	var name string
+	err = database.DB.Get(&name, "SELECT name FROM process_templates WHERE id = ?", rule.OptionsFrom.TemplateID)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: kolom '%s' merujuk template %d", ErrUnresolvedTemplate, f.Key, rule.OptionsFrom.TemplateID)
+	}
+	return name, err
+}
+
+// remapOptionsFrom mengganti options_from.template_id di bundle dengan ID template yang
+// bernama sama di server ini. Import ditolak jika template rujukannya belum ada.
+func remapOptionsFrom(bundle *entity.TemplateBundle) error {
+	for i, f := range bundle.Template.Fields {
+		rule, err := validation.ParseRule(f.ValidationRule)
+		if err != nil {
+			return fmt.Errorf("field '%s': %v", f.Key, err)
+		}
+		if rule.OptionsFrom == nil {
+			continue
+		}
+		if f.OptionsFromTemplate == "" {
+			return fmt.Errorf("%w: kolom '%s' memakai options_from tanpa nama template (export ulang dengan versi terbaru)", ErrUnresolvedTemplate, f.Key)
+		}
+		id, err := findTemplate(f.OptionsFromTemplate, TemplateKey(f.OptionsFromTemplate))
+		if err != nil {
+			return err
+		}
+		if id == 0 {
+			return fmt.Errorf("%w: kolom '%s' merujuk template '%s' yang belum ada di server ini", ErrUnresolvedTemplate, f.Key, f.OptionsFromTemplate)
+		}
+
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(f.ValidationRule), &raw); err != nil {
+			return err
+		}
+		var source map[string]interface{}
+		if err := json.Unmarshal(raw["options_from"], &source); err != nil {
+			return err
+		}
+		source["template_id"] = id
+		if raw["options_from"], err = json.Marshal(source); err != nil {
+			return err
+		}
+		remapped, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		bundle.Template.Fields[i].ValidationRule = string(remapped)
+	}
+	return nil
+}
+
+// ImportTemplate membuat (atau menimpa) template dari bundle hasil ExportTemplate.
+// Template dianggap sudah ada jika nama atau key-nya sama dengan template aktif di server ini.
+func ImportTemplate(bundle entity.TemplateBundle, mode string, userID int) (*ImportResult, error) {
+	if bundle.Format != BundleFormat || bundle.FormatVersion < 1 || bundle.FormatVersion > BundleFormatVersion {
+		return nil, fmt.Errorf("%w: format '%s' versi %d", ErrUnsupportedBundle, bundle.Format, bundle.FormatVersion)
+	}
+	switch mode {
+	case "":
+		mode = ImportFail
+	case ImportFail, ImportSkip, ImportReplace, ImportRename:
+	default:
+		return nil, fmt.Errorf("%w: '%s'", ErrInvalidImportMode, mode)
+	}
+
+	if err := remapOptionsFrom(&bundle); err != nil {
+		return nil, err
+	}
+	tmpl := bundleToTemplate(bundle.Template)
+	if strings.TrimSpace(tmpl.Name) == "" {
+		return nil, fmt.Errorf("%w: nama template kosong", ErrUnsupportedBundle)
+	}
+	if err := CheckFieldDefs(tmpl.Fields); err != nil {
+		return nil, err
+	}
+
+	key := bundle.Template.Key
+	if key == "" {
+		key = TemplateKey(tmpl.Name)
+	}
+	existingID, err := findTemplate(tmpl.Name, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if existingID == 0 {
+		id, err := CreateTemplate(tmpl, userID)
+		if err != nil {
+			return nil, err
+		}
+		return &ImportResult{ID: int(id), Name: tmpl.Name, Action: "created"}, nil
+	}
+
+	switch mode {
+	case ImportFail:
+		return nil, &TemplateConflictError{Name: tmpl.Name, ExistingID: existingID}
+
+	case ImportSkip:
+		return &ImportResult{ID: existingID, Name: tmpl.Name, Action: "skipped"}, nil
+
+	case ImportRename:
+		base := tmpl.Name
+		for n := 2; ; n++ {
+			if n > maxRenameAttempts {
+				return nil, &TemplateConflictError{Name: base, ExistingID: existingID}
+			}
+			tmpl.Name = fmt.Sprintf("%s (%d)", base, n)
+			taken, err := findTemplate(tmpl.Name, TemplateKey(tmpl.Name))
+			if err != nil {
+				return nil, err
+			}
+			if taken == 0 {
+				break
+			}
+		}
+		id, err := CreateTemplate(tmpl, userID)
+		if err != nil {
+			return nil, err
+		}
+		return &ImportResult{ID: int(id), Name: tmpl.Name, Action: "created"}, nil
+	}
+
+	// ImportReplace
+	tmpl.ID = existingID
+	if err := UpdateTemplate(tmpl, userID); err != nil {
+		return nil, err
+	}
+	return &ImportResult{ID: existingID, Name: tmpl.Name, Action: "replaced"}, nil
+}
+
+func bundleToTemplate(b entity.BundleTemplate) entity.ProcessTemplate {
+	tmpl := entity.ProcessTemplate{
+		Name:              strings.TrimSpace(b.Name),
+		Description:       b.Description,
+		Category:          b.Category,
+		Icon:              b.Icon,
+		Color:             b.Color,
+		EstimatedDuration: b.EstimatedDuration,
+		Fields:            make([]entity.FieldDef, 0, len(b.Fields)),
+	}
+	for _, f := range b.Fields {
+		tmpl.Fields = append(tmpl.Fields, entity.FieldDef{
+			Key:            f.Key,
+			Label:          f.Label,
+			Type:           f.Type,
+			IsRequired:     f.IsRequired,
+			ValidationRule: f.ValidationRule,
+			Expression:     f.Expression,
+			ShowWhen:       f.ShowWhen,
+			RequiredWhen:   f.RequiredWhen,
+			DefaultValue:   f.DefaultValue,
+			Placeholder:    f.Placeholder,
+			HelpText:       f.HelpText,
+			IsActive:       true,
+		})
+	}
+	return tmpl
+}
+
+// findTemplate mencari template aktif dengan nama yang sama atau key yang sama (0 jika tidak ada)
+func findTemplate(name, key string) (int, error) {
+	var id int
+	err := database.DB.Get(&id, "SELECT id FROM process_templates WHERE name = ? AND is_active = 1 LIMIT 1", name)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+
+	var templates []struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	if err := database.DB.Select(&templates, "SELECT id, name FROM process_templates WHERE is_active = 1 ORDER BY id"); err != nil {
+		return 0, err
+	}
+	for _, t := range templates {
+		if TemplateKey(t.Name) == key {
+			return t.ID, nil
+		}
+	}
+	return 0, nil
+}
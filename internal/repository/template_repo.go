@@ -1,26 +1,289 @@
 package repository
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"pt-besq-core/internal/database"
 	"pt-besq-core/internal/entity"
+	"pt-besq-core/internal/validation"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrTemplateNotFound  = errors.New("template not found")
+	ErrDuplicateFieldKey = errors.New("duplicate field_key")
+	ErrFieldNotFound     = errors.New("field not found")
 )
 
+// FieldTypes adalah daftar tipe kolom yang sesuai dengan ENUM field_type di init.sql
+var FieldTypes = []string{"text", "number", "date", "datetime", "select", "textarea", "checkbox", "file", "computed"}
+
+const templateColumns = `
+	id, name, COALESCE(description, '') as description, COALESCE(category, '') as category,
+	COALESCE(icon, '') as icon, COALESCE(color, '') as color, estimated_duration,
+	COALESCE(current_version, 0) as current_version, is_active, created_by, created_at, updated_at
+`
+
+const fieldDefColumns = `
+	id, template_id, field_key, field_label, field_type, is_required,
+	COALESCE(validation_rule, '') as validation_rule, COALESCE(expression, '') as expression,
+	COALESCE(show_when, '') as show_when, COALESCE(required_when, '') as required_when,
+	COALESCE(default_value, '') as default_value,
+	COALESCE(placeholder, '') as placeholder, COALESCE(help_text, '') as help_text,
+	display_order, is_active
+`
+
 // GetAllTemplates
 func GetAllTemplates() ([]entity.ProcessTemplate, error) {
 	var templates []entity.ProcessTemplate
-	query := "SELECT id, name, description, created_at FROM process_templates"
+	query := "SELECT " + templateColumns + " FROM process_templates WHERE is_active = 1 ORDER BY name"
 	err := database.DB.Select(&templates, query)
 	return templates, err
 }
 
+// GetTemplateByID mengambil satu template lengkap dengan definisi kolomnya
+func GetTemplateByID(id int) (*entity.ProcessTemplate, error) {
+	var tmpl entity.ProcessTemplate
+	query := "SELECT " + templateColumns + " FROM process_templates WHERE id = ? AND is_active = 1"
+	err := database.DB.Get(&tmpl, query, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl.Fields, err = GetFieldDefs(id)
+	if err != nil {
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
 // GetFieldDefs mengambil aturan kolom (Ini adalah Single Source of Truth sekarang)
 func GetFieldDefs(templateID int) ([]entity.FieldDef, error) {
 	var fields []entity.FieldDef
-	query := `
-		SELECT id, template_id, field_key, field_label, field_type, is_required 
-		FROM field_definitions 
-		WHERE template_id = ?
+	query := "SELECT " + fieldDefColumns + `
+		FROM field_definitions
+		WHERE template_id = ? AND is_active = 1
+		ORDER BY display_order, id
 	`
 	err := database.DB.Select(&fields, query, templateID)
 	return fields, err
-}
\ No newline at end of file
+}
+
+// CheckFieldDefs memastikan daftar kolom valid sebelum disimpan.
+// field_key dibandingkan tanpa membedakan huruf besar/kecil, sama seperti collation kolomnya.
+func CheckFieldDefs(fields []entity.FieldDef) error {
+	seen := make(map[string]bool, len(fields))
+	for i, f := range fields {
+		key := strings.TrimSpace(f.Key)
+		if key == "" {
+			return fmt.Errorf("field #%d: field_key wajib diisi", i+1)
+		}
+		if strings.TrimSpace(f.Label) == "" {
+			return fmt.Errorf("field '%s': label wajib diisi", key)
+		}
+		if !isFieldType(f.Type) {
+			return fmt.Errorf("field '%s': tipe '%s' tidak dikenal", key, f.Type)
+		}
+		if seen[strings.ToLower(key)] {
+			return fmt.Errorf("%w: '%s'", ErrDuplicateFieldKey, key)
+		}
+		if _, err := validation.ParseRule(f.ValidationRule); err != nil {
+			return fmt.Errorf("field '%s': %v", key, err)
+		}
+		seen[strings.ToLower(key)] = true
+	}
+	if err := validation.CheckConditions(fields); err != nil {
+		return err
+	}
+	return validation.CheckComputed(fields)
+}
+
+func isFieldType(t string) bool {
+	for _, ft := range FieldTypes {
+		if ft == t {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateTemplate menyimpan template baru beserta kolomnya dalam satu transaksi
+func CreateTemplate(tmpl entity.ProcessTemplate, createdBy int) (int64, error) {
+	if err := CheckFieldDefs(tmpl.Fields); err != nil {
+		return 0, err
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO process_templates (name, description, category, icon, color, estimated_duration, is_active, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, 1, ?, NOW())
+	`, tmpl.Name, tmpl.Description, tmpl.Category, tmpl.Icon, tmpl.Color, tmpl.EstimatedDuration, nullableID(createdBy))
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := saveFieldDefs(tx, int(id), tmpl.Fields); err != nil {
+		return 0, err
+	}
+	if _, err := publishTemplateVersion(tx, int(id), createdBy); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// UpdateTemplate memperbarui template dan mengganti daftar kolomnya sesuai urutan yang dikirim.
+// Jika fields tidak dikirim (nil), kolom tidak diubah. Jika kolomnya berubah, versi template baru otomatis dipublish.
+func UpdateTemplate(tmpl entity.ProcessTemplate, updatedBy int) error {
+	if err := CheckFieldDefs(tmpl.Fields); err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE process_templates
+		SET name = ?, description = ?, category = ?, icon = ?, color = ?, estimated_duration = ?, updated_at = NOW()
+		WHERE id = ? AND is_active = 1
+	`, tmpl.Name, tmpl.Description, tmpl.Category, tmpl.Icon, tmpl.Color, tmpl.EstimatedDuration, tmpl.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// RowsAffected = 0 juga terjadi kalau datanya sama persis, jadi cek ulang keberadaannya
+		var exists int
+		if err := tx.Get(&exists, "SELECT COUNT(*) FROM process_templates WHERE id = ? AND is_active = 1", tmpl.ID); err != nil {
+			return err
+		}
+		if exists == 0 {
+			return ErrTemplateNotFound
+		}
+	}
+
+	if tmpl.Fields != nil {
+		if err := saveFieldDefs(tx, tmpl.ID, tmpl.Fields); err != nil {
+			return err
+		}
+		if _, err := publishTemplateVersion(tx, tmpl.ID, updatedBy); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteTemplate melakukan soft delete (is_active = 0) agar instance lama tetap bisa dibaca
+func DeleteTemplate(id int) error {
+	res, err := database.DB.Exec(`
+		UPDATE process_templates SET is_active = 0, updated_at = NOW()
+		WHERE id = ? AND is_active = 1
+	`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// saveFieldDefs menyinkronkan field_definitions sebuah template dengan daftar baru.
+// Kolom dicocokkan lewat field_key (tanpa membedakan huruf besar/kecil): yang ada di-update, yang baru di-insert,
+// dan yang tidak dikirim lagi dinonaktifkan (bukan dihapus) supaya data lama tetap terbaca.
+// display_order yang dikirim dipakai apa adanya; jika 0, urutan di array yang dipakai.
+func saveFieldDefs(tx *sqlx.Tx, templateID int, fields []entity.FieldDef) error {
+	var existing []struct {
+		ID  int    `db:"id"`
+		Key string `db:"field_key"`
+	}
+	if err := tx.Select(&existing, "SELECT id, field_key FROM field_definitions WHERE template_id = ?", templateID); err != nil {
+		return err
+	}
+	idByKey := make(map[string]int, len(existing))
+	for _, e := range existing {
+		idByKey[strings.ToLower(e.Key)] = e.ID
+	}
+
+	kept := make(map[string]bool, len(fields))
+	for i, f := range fields {
+		key := strings.TrimSpace(f.Key)
+		kept[strings.ToLower(key)] = true
+		order := f.DisplayOrder
+		if order <= 0 {
+			order = i + 1
+		}
+
+		if id, ok := idByKey[strings.ToLower(key)]; ok {
+			_, err := tx.Exec(`
+				UPDATE field_definitions
+				SET field_key = ?, field_label = ?, field_type = ?, is_required = ?, validation_rule = ?, expression = ?,
+				    show_when = ?, required_when = ?, default_value = ?,
+				    placeholder = ?, help_text = ?, display_order = ?, is_active = 1
+				WHERE id = ?
+			`, key, f.Label, f.Type, f.IsRequired, nullableString(f.ValidationRule), nullableString(f.Expression),
+				nullableString(f.ShowWhen), nullableString(f.RequiredWhen), nullableString(f.DefaultValue),
+				nullableString(f.Placeholder), nullableString(f.HelpText), order, id)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, err := tx.Exec(`
+			INSERT INTO field_definitions (template_id, field_key, field_label, field_type, is_required, validation_rule,
+			                               expression, show_when, required_when, default_value, placeholder, help_text,
+			                               display_order, is_active)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
+		`, templateID, key, f.Label, f.Type, f.IsRequired, nullableString(f.ValidationRule), nullableString(f.Expression),
+			nullableString(f.ShowWhen), nullableString(f.RequiredWhen), nullableString(f.DefaultValue),
+			nullableString(f.Placeholder), nullableString(f.HelpText), order)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, e := range existing {
+		if kept[strings.ToLower(e.Key)] {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE field_definitions SET is_active = 0 WHERE id = ?", e.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nullableString mengubah string kosong menjadi NULL di database
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullableID mengubah ID 0 (tidak diketahui) menjadi NULL agar foreign key tidak gagal
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"pt-besq-core/internal/database"
+	"pt-besq-core/internal/entity"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type templateVersionRow struct {
+	ID         int           `db:"id"`
+	TemplateID int           `db:"template_id"`
+	Version    int           `db:"version"`
+	Snapshot   string        `db:"fields_snapshot"`
+	CreatedBy  sql.NullInt64 `db:"created_by"`
+	CreatedAt  sql.NullTime  `db:"created_at"`
+}
+
+func (row templateVersionRow) toEntity() (entity.TemplateVersion, error) {
+	v := entity.TemplateVersion{
+		ID:         row.ID,
+		TemplateID: row.TemplateID,
+		Version:    row.Version,
+		CreatedAt:  row.CreatedAt.Time,
+	}
+	if row.CreatedBy.Valid {
+		id := int(row.CreatedBy.Int64)
+		v.CreatedBy = &id
+	}
+	if err := json.Unmarshal([]byte(row.Snapshot), &v.Fields); err != nil {
+		return v, fmt.Errorf("snapshot template %d v%d rusak: %w", row.TemplateID, row.Version, err)
+	}
+	return v, nil
+}
+
+// GetTemplateVersions mengambil seluruh riwayat versi sebuah template (terbaru dulu)
+func GetTemplateVersions(templateID int) ([]entity.TemplateVersion, error) {
+	var rows []templateVersionRow
+	query := `
+		SELECT id, template_id, version, fields_snapshot, created_by, created_at
+		FROM template_versions
+		WHERE template_id = ?
+		ORDER BY version DESC
+	`
+	if err := database.DB.Select(&rows, query, templateID); err != nil {
+		return nil, err
+	}
+
+	versions := make([]entity.TemplateVersion, 0, len(rows))
+	for _, row := range rows {
+		v, err := row.toEntity()
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// GetFieldDefsForVersion mengambil definisi kolom sesuai versi yang dipakai sebuah instance.
+// Instance lama yang belum punya versi (version <= 0) dibaca dengan kolom yang aktif sekarang.
+func GetFieldDefsForVersion(templateID, version int) ([]entity.FieldDef, error) {
+	if version <= 0 {
+		return GetFieldDefs(templateID)
+	}
+
+	var row templateVersionRow
+	query := `
+		SELECT id, template_id, version, fields_snapshot, created_by, created_at
+		FROM template_versions
+		WHERE template_id = ? AND version = ?
+	`
+	err := database.DB.Get(&row, query, templateID, version)
+	if err == sql.ErrNoRows {
+		return GetFieldDefs(templateID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := row.toEntity()
+	return v.Fields, err
+}
+
+// currentTemplateVersion membaca versi template yang berlaku untuk instance baru tanpa mengunci
+// baris template, supaya pembuatan instance tidak saling menunggu. Versi dipublish saat template
+// dibuat/diubah; hanya template lama yang belum pernah dipublish dibuatkan versi pertamanya di sini.
+func currentTemplateVersion(tx *sqlx.Tx, templateID int) (int, error) {
+	var current int
+	err := tx.Get(&current, "SELECT COALESCE(current_version, 0) FROM process_templates WHERE id = ?", templateID)
+	if err == sql.ErrNoRows {
+		return 0, ErrTemplateNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if current > 0 {
+		return current, nil
+	}
+	return publishTemplateVersion(tx, templateID, 0)
+}
+
+// publishTemplateVersion membuat snapshot immutable dari kolom aktif sebuah template.
+// Kalau isinya sama dengan versi terakhir, tidak ada versi baru yang dibuat.
+// Mengembalikan nomor versi yang berlaku.
+func publishTemplateVersion(tx *sqlx.Tx, templateID int, createdBy int) (int, error) {
+	var fields []entity.FieldDef
+	query := "SELECT " + fieldDefColumns + `
+		FROM field_definitions
+		WHERE template_id = ? AND is_active = 1
+		ORDER BY display_order, id
+	`
+	if err := tx.Select(&fields, query, templateID); err != nil {
+		return 0, err
+	}
+	if fields == nil {
+		fields = []entity.FieldDef{}
+	}
+	snapshot, err := json.Marshal(fields)
+	if err != nil {
+		return 0, err
+	}
+
+	// Kunci baris template supaya dua penyimpanan bersamaan tidak membuat nomor versi yang sama
+	var current int
+	if err := tx.Get(&current, "SELECT COALESCE(current_version, 0) FROM process_templates WHERE id = ? FOR UPDATE", templateID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrTemplateNotFound
+		}
+		return 0, err
+	}
+
+	if current > 0 {
+		var latest string
+		err := tx.Get(&latest, "SELECT fields_snapshot FROM template_versions WHERE template_id = ? AND version = ?", templateID, current)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+		if err == nil && sameSnapshot(latest, snapshot) {
+			return current, nil
+		}
+	}
+
+	next := current + 1
+	_, err = tx.Exec(`
+		INSERT INTO template_versions (template_id, version, fields_snapshot, created_by, created_at)
+		VALUES (?, ?, ?, ?, NOW())
+	`, templateID, next, snapshot, nullableID(createdBy))
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec("UPDATE process_templates SET current_version = ? WHERE id = ?", next, templateID); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// sameSnapshot membandingkan snapshot lama dengan yang baru setelah snapshot lama dibaca ulang
+// ke struct FieldDef sekarang, jadi menambah atribut baru di FieldDef tidak membuat versi baru
+// selama nilainya masih kosong
+func sameSnapshot(latest string, snapshot []byte) bool {
+	var fields []entity.FieldDef
+	if err := json.Unmarshal([]byte(latest), &fields); err != nil {
+		return false
+	}
+	if fields == nil {
+		fields = []entity.FieldDef{}
+	}
+	normalized, err := json.Marshal(fields)
+	return err == nil && bytes.Equal(normalized, snapshot)
+}
+
+// RenderPayload memasangkan isi data_payload dengan label kolom dari versi template-nya.
+// Key yang tidak ada di definisi tetap ditampilkan dengan key sebagai label.
+func RenderPayload(fields []entity.FieldDef, payload json.RawMessage) ([]entity.FieldValue, error) {
+	data := map[string]interface{}{}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &data); err != nil {
+			return nil, err
+		}
+	}
+
+	rendered := make([]entity.FieldValue, 0, len(data))
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f.Key] = true
+		val, exists := data[f.Key]
+		if !exists {
+			continue
+		}
+		rendered = append(rendered, entity.FieldValue{Key: f.Key, Label: f.Label, Type: f.Type, Value: val})
+	}
+	extra := make([]string, 0)
+	for key := range data {
+		if !known[key] {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	for _, key := range extra {
+		rendered = append(rendered, entity.FieldValue{Key: key, Label: key, Value: data[key]})
+	}
+	return rendered, nil
+}
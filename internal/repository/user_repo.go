@@ -24,10 +24,22 @@ func (r *AuthRepository) CreateUser(user entity.User) error {
 func (r *AuthRepository) GetUserByUsername(username string) (entity.User, error) {
 	var user entity.User
 	query := `SELECT id, username, password_hash, role, created_at FROM users WHERE username = ?`
-	
+
 	err := database.DB.Get(&user, query, username)
 	if err == sql.ErrNoRows {
 		return user, nil // User tidak ditemukan, return kosong tanpa error
 	}
 	return user, err
-}
\ No newline at end of file
+}
+
+// GetUserByID mengambil user aktif berdasarkan ID (dipakai untuk verifikasi ulang password)
+func (r *AuthRepository) GetUserByID(id int) (entity.User, error) {
+	var user entity.User
+	query := `SELECT id, username, password_hash, role, created_at FROM users WHERE id = ? AND is_active = 1`
+
+	err := database.DB.Get(&user, query, id)
+	if err == sql.ErrNoRows {
+		return user, nil // User tidak ditemukan, return kosong tanpa error
+	}
+	return user, err
+}
@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pt-besq-core/internal/database"
+	"pt-besq-core/internal/workflow"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrWorkflowNotFound    = errors.New("workflow not found")
+	ErrInvalidEntryNode    = errors.New("invalid workflow entry node")
+	ErrInstanceNotFound    = errors.New("instance not found")
+	ErrWorkflowUnpublished = errors.New("workflow has not been published")
+)
+
+// loadWorkflowGraph membaca graf workflow yang dipakai engine.
+// version > 0 membaca snapshot versi tersebut. version 0 berarti versi publish terakhir.
+// Workflow yang belum pernah dipublish hanya boleh dipakai jika canvas-nya belum punya stage
+// (data lama); jika sudah punya stage error ErrWorkflowUnpublished, supaya instance tidak
+// pernah berjalan di atas draft yang masih bisa diedit.
+// Mengembalikan nomor versi yang benar-benar dipakai (0 jika draft tanpa stage).
+func loadWorkflowGraph(q sqlx.Queryer, workflowID, version int) (*workflow.Graph, int, error) {
+	if version <= 0 {
+		err := sqlx.Get(q, &version, "SELECT COALESCE(version, 0) FROM workflows WHERE id = ? AND is_active = 1", workflowID)
+		if err == sql.ErrNoRows {
+			return nil, 0, ErrWorkflowNotFound
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	canvas, err := loadWorkflowCanvas(q, workflowID, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	graph, err := workflow.NewGraph(canvas)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version == 0 && graph.HasStages() {
+		return nil, 0, fmt.Errorf("%w: publish workflow %d terlebih dahulu", ErrWorkflowUnpublished, workflowID)
+	}
+	return graph, version, nil
+}
+
+// ResolveEntryNode menentukan node stage dan versi workflow untuk instance baru.
+// nodeID boleh kosong jika hanya ada satu entry node untuk template tersebut.
+// Workflow yang canvas-nya belum punya stage (data lama) tidak dibatasi dan mengembalikan "";
+// workflow dengan stage harus sudah dipublish (ErrWorkflowUnpublished).
+func ResolveEntryNode(workflowID, templateID int, nodeID string) (string, int, error) {
+	graph, version, err := loadWorkflowGraph(database.DB, workflowID, 0)
+	if err != nil {
+		return "", 0, err
+	}
+	if !graph.HasStages() {
+		return "", version, nil
+	}
+
+	var candidates []string
+	for _, n := range graph.EntryNodes() {
+		if n.Data.TemplateID != templateID {
+			continue
+		}
+		if nodeID == "" || n.ID == nodeID {
+			candidates = append(candidates, n.ID)
+		}
+	}
+
+	switch {
+	case len(candidates) == 1:
+		return candidates[0], version, nil
+	case len(candidates) > 1:
+		return "", 0, fmt.Errorf("%w: template %d punya beberapa entry node, node_id wajib diisi", ErrInvalidEntryNode, templateID)
+	case nodeID != "":
+		return "", 0, fmt.Errorf("%w: node '%s' bukan awal workflow untuk template %d", ErrInvalidEntryNode, nodeID, templateID)
+	}
+	return "", 0, fmt.Errorf("%w: template %d bukan tahap awal workflow ini", ErrInvalidEntryNode, templateID)
+}
+
+// advanceWorkflow dipanggil di dalam transaksi saat sebuah instance berstatus completed.
+// Untuk setiap stage berikutnya di canvas dibuatkan instance draft baru. Percabangan
+// dievaluasi terhadap data_payload dan status instance; jika tidak ada cabang yang cocok
+// error membungkus workflow.ErrNoMatchingBranch dan transaksi harus dibatalkan.
+// Mengembalikan ID instance yang dibuat (kosong jika tidak ada tahap lanjutan).
+func advanceWorkflow(tx *sqlx.Tx, instanceID int64, userID int) ([]int64, error) {
+	var inst struct {
+		WorkflowID      int            `db:"workflow_id"`
+		WorkflowVersion int            `db:"workflow_version"`
+		NodeID          sql.NullString `db:"node_id"`
+		Payload         sql.NullString `db:"data_payload"`
+		Status          string         `db:"status"`
+		RootInstanceID  int64          `db:"root_instance_id"`
+	}
+	err := tx.Get(&inst, `
+		SELECT workflow_id, COALESCE(workflow_version, 0) as workflow_version, node_id, data_payload, status,
+		       COALESCE(root_instance_id, id) as root_instance_id
+		FROM process_instances WHERE id = ?
+	`, instanceID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInstanceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !inst.NodeID.Valid || inst.NodeID.String == "" {
+		return nil, nil
+	}
+
+	// Tahap berikutnya mengikuti versi workflow tempat instance ini dimulai,
+	// bukan draft yang mungkin sedang diedit
+	graph, version, err := loadWorkflowGraph(tx, inst.WorkflowID, inst.WorkflowVersion)
+	if err == ErrWorkflowNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var payload map[string]interface{}
+	if inst.Payload.Valid && inst.Payload.String != "" {
+		if err := json.Unmarshal([]byte(inst.Payload.String), &payload); err != nil {
+			return nil, fmt.Errorf("data_payload instance %d tidak valid: %w", instanceID, err)
+		}
+	}
+	vars := workflow.BranchVars(payload, inst.Status)
+	nextStages, arrivals, err := graph.Route(inst.NodeID.String, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cabang paralel yang sampai di join dicatat; join yang sudah lengkap diteruskan
+	for len(arrivals) > 0 {
+		a := arrivals[0]
+		arrivals = arrivals[1:]
+		released, err := arriveAtJoin(tx, inst.RootInstanceID, inst.WorkflowID, version, graph, a, instanceID)
+		if err != nil {
+			return nil, err
+		}
+		if !released {
+			continue
+		}
+		stages, more, err := graph.Route(a.Join.ID, vars)
+		if err != nil {
+			return nil, err
+		}
+		nextStages = append(nextStages, stages...)
+		arrivals = append(arrivals, more...)
+	}
+
+	var created []int64
+	spawned := map[string]bool{}
+	for _, next := range nextStages {
+		if spawned[next.ID] {
+			continue
+		}
+		spawned[next.ID] = true
+
+		// Jangan membuat tahap yang sama dua kali kalau status completed diset ulang
+		var exists int
+		if err := tx.Get(&exists, `
+			SELECT COUNT(*) FROM process_instances WHERE source_instance_id = ? AND node_id = ?
+		`, instanceID, next.ID); err != nil {
+			return nil, err
+		}
+		if exists > 0 {
+			continue
+		}
+
+		id, _, err := insertInstance(tx, NewInstance{
+			WorkflowID:       inst.WorkflowID,
+			WorkflowVersion:  version,
+			TemplateID:       next.Data.TemplateID,
+			Data:             []byte("{}"),
+			CreatedBy:        userID,
+			NodeID:           next.ID,
+			SourceInstanceID: instanceID,
+			RootInstanceID:   inst.RootInstanceID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("gagal membuat tahap '%s': %w", next.ID, err)
+		}
+		created = append(created, id)
+	}
+	return created, nil
+}
+
+// arriveAtJoin mencatat cabang yang sampai di node join untuk satu jalannya workflow
+// (root instance) dan mengembalikan true jika cabang ini yang melengkapi join.
+// Status join disimpan di workflow_join_states sehingga tetap utuh meski server restart.
+func arriveAtJoin(tx *sqlx.Tx, rootID int64, workflowID, version int, graph *workflow.Graph, a workflow.Arrival, instanceID int64) (bool, error) {
+	// Kunci instance pertama supaya cabang yang selesai bersamaan tidak membuat dua state untuk join yang sama
+	var locked int64
+	if err := tx.Get(&locked, "SELECT id FROM process_instances WHERE id = ? FOR UPDATE", rootID); err != nil {
+		return false, err
+	}
+
+	var state struct {
+		ID       int64        `db:"id"`
+		Required int          `db:"required"`
+		Released sql.NullTime `db:"released_at"`
+	}
+	err := tx.Get(&state, `
+		SELECT id, required, released_at FROM workflow_join_states
+		WHERE root_instance_id = ? AND node_id = ?
+		ORDER BY id DESC LIMIT 1
+	`, rootID, a.Join.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	newRound := err == sql.ErrNoRows
+
+	if !newRound {
+		var prev sql.NullInt64
+		err := tx.Get(&prev, "SELECT instance_id FROM workflow_join_arrivals WHERE join_state_id = ? AND edge_key = ?", state.ID, a.EdgeKey)
+		if err != nil && err != sql.ErrNoRows {
+			return false, err
+		}
+		arrived := err == nil
+		// Instance yang sama diselesaikan ulang: sudah tercatat, tidak ada yang berubah
+		if arrived && prev.Valid && prev.Int64 == instanceID {
+			return false, nil
+		}
+		switch {
+		case !state.Released.Valid:
+			if arrived {
+				// Cabang ini diulang (rework) sebelum join lengkap; cukup perbarui instance-nya
+				_, err := tx.Exec("UPDATE workflow_join_arrivals SET instance_id = ?, arrived_at = NOW() WHERE join_state_id = ? AND edge_key = ?", instanceID, state.ID, a.EdgeKey)
+				return false, err
+			}
+		case !arrived:
+			// Join N-dari-M sudah dilepas; cabang yang terlambat hanya dicatat
+			_, err := tx.Exec("INSERT INTO workflow_join_arrivals (join_state_id, edge_key, instance_id, arrived_at) VALUES (?, ?, ?, NOW())", state.ID, a.EdgeKey, instanceID)
+			return false, err
+		default:
+			// Join sudah dilepas dan cabang ini datang lagi (loop): mulai putaran baru
+			newRound = true
+		}
+	}
+
+	if newRound {
+		state.Required = graph.JoinQuorum(a.Join.ID)
+		res, err := tx.Exec(`
+			INSERT INTO workflow_join_states (root_instance_id, workflow_id, workflow_version, node_id, required, created_at)
+			VALUES (?, ?, ?, ?, ?, NOW())
+		`, rootID, workflowID, nullableID(version), a.Join.ID, state.Required)
+		if err != nil {
+			return false, err
+		}
+		if state.ID, err = res.LastInsertId(); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO workflow_join_arrivals (join_state_id, edge_key, instance_id, arrived_at) VALUES (?, ?, ?, NOW())", state.ID, a.EdgeKey, instanceID); err != nil {
+		return false, err
+	}
+	var count int
+	if err := tx.Get(&count, "SELECT COUNT(*) FROM workflow_join_arrivals WHERE join_state_id = ?", state.ID); err != nil {
+		return false, err
+	}
+	if count < state.Required {
+		return false, nil
+	}
+	_, err = tx.Exec("UPDATE workflow_join_states SET released_at = NOW(), released_by_instance_id = ? WHERE id = ?", instanceID, state.ID)
+	return err == nil, err
+}
@@ -1,8 +1,10 @@
 package repository
 
 import (
+	"database/sql"
 	"pt-besq-core/internal/database"
 	"pt-besq-core/internal/entity"
+	"pt-besq-core/internal/workflow"
 )
 
 type WorkflowRepository struct{}
@@ -14,7 +16,7 @@ func NewWorkflowRepository() *WorkflowRepository {
 func (r *WorkflowRepository) GetAll() ([]entity.Workflow, error) {
 	var workflows []entity.Workflow
 	// Ambil semua workflow (default kosong jika null)
-	query := "SELECT id, name, canvas_config, is_active, created_at FROM workflows"
+	query := "SELECT id, name, canvas_config, COALESCE(version, 0) as version, is_published, is_active, revision, created_at FROM workflows"
 	err := database.DB.Select(&workflows, query)
 	return workflows, err
 }
@@ -32,8 +34,75 @@ func (r *WorkflowRepository) Create(wf entity.Workflow) (int64, error) {
 	return res.LastInsertId()
 }
 
-func (r *WorkflowRepository) UpdateLayout(id int, configJSON string) error {
-	query := `UPDATE workflows SET canvas_config = ? WHERE id = ?`
-	_, err := database.DB.Exec(query, configJSON, id)
-	return err
+// GetByID mengambil satu workflow beserta draft canvas dan revision-nya
+func (r *WorkflowRepository) GetByID(id int) (*entity.Workflow, error) {
+	var wf entity.Workflow
+	query := "SELECT id, name, canvas_config, COALESCE(version, 0) as version, is_published, is_active, revision, created_at FROM workflows WHERE id = ?"
+	err := database.DB.Get(&wf, query, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrWorkflowNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wf, nil
+}
+
+// UpdateLayout menyimpan draft canvas jika revision workflow masih sama dengan yang dibaca client.
+// Revision yang usang menghasilkan ErrRevisionConflict tanpa menulis apa pun.
+// Mengembalikan revision setelah disimpan.
+func (r *WorkflowRepository) UpdateLayout(id int, configJSON string, revision int) (int, error) {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var current int
+	err = tx.Get(&current, "SELECT revision FROM workflows WHERE id = ? FOR UPDATE", id)
+	if err == sql.ErrNoRows {
+		return 0, ErrWorkflowNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if current != revision {
+		return current, ErrRevisionConflict
+	}
+
+	// Yang diubah hanya draft; is_published menandai apakah draft masih sama dengan versi publish terakhir
+	query := `
+		UPDATE workflows w
+		SET canvas_config = ?,
+		    is_published = EXISTS (
+		        SELECT 1 FROM workflow_versions v
+		        WHERE v.workflow_id = w.id AND v.version = w.version AND v.canvas_snapshot = ?
+		    ),
+		    revision = revision + 1
+		WHERE id = ?
+	`
+	if _, err := tx.Exec(query, configJSON, configJSON, id); err != nil {
+		return 0, err
+	}
+	return current + 1, tx.Commit()
+}
+
+// CheckCanvas mem-parse canvas_config dan mengembalikan daftar masalahnya (nil jika valid).
+// Error hanya dikembalikan jika JSON rusak atau database gagal dibaca.
+func (r *WorkflowRepository) CheckCanvas(raw []byte) (workflow.Problems, error) {
+	canvas, err := workflow.ParseCanvas(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	if err := database.DB.Select(&ids, "SELECT id FROM process_templates WHERE is_active = 1"); err != nil {
+		return nil, err
+	}
+	templates := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		templates[id] = true
+	}
+
+	return workflow.Check(canvas, func(id int) bool { return templates[id] }), nil
 }
\ No newline at end of file
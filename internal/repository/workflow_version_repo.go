@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"pt-besq-core/internal/database"
+	"pt-besq-core/internal/entity"
+	"pt-besq-core/internal/workflow"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrWorkflowVersionNotFound = errors.New("workflow version not found")
+	ErrNothingToPublish        = errors.New("draft has no changes since the last published version")
+)
+
+// WorkflowVersionInfo adalah satu versi workflow beserta perubahannya dari versi sebelumnya
+type WorkflowVersionInfo struct {
+	entity.WorkflowVersion
+	Changes workflow.Diff `json:"changes"`
+}
+
+// PublishWorkflow memeriksa draft canvas lalu menyimpannya sebagai versi baru yang immutable.
+// Jika canvas tidak valid, error bertipe workflow.Problems.
+func (r *WorkflowRepository) PublishWorkflow(workflowID, userID int) (int, error) {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Kunci baris workflow supaya dua publish bersamaan tidak membuat nomor versi yang sama
+	var wf struct {
+		Canvas  sql.NullString `db:"canvas_config"`
+		Version int            `db:"version"`
+	}
+	err = tx.Get(&wf, "SELECT canvas_config, COALESCE(version, 0) as version FROM workflows WHERE id = ? AND is_active = 1 FOR UPDATE", workflowID)
+	if err == sql.ErrNoRows {
+		return 0, ErrWorkflowNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	draft := []byte(wf.Canvas.String)
+	problems, err := r.CheckCanvas(draft)
+	if err != nil {
+		return 0, err
+	}
+	canvas, _ := workflow.ParseCanvas(draft)
+	if len(canvas.Nodes) == 0 {
+		problems = append(problems, workflow.Problem{Code: "empty", Message: "canvas masih kosong, tidak ada yang bisa dipublish"})
+	}
+	if len(problems) > 0 {
+		return 0, problems
+	}
+
+	if wf.Version > 0 {
+		var latest string
+		err := tx.Get(&latest, "SELECT canvas_snapshot FROM workflow_versions WHERE workflow_id = ? AND version = ?", workflowID, wf.Version)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+		if err == nil && bytes.Equal(bytes.TrimSpace([]byte(latest)), bytes.TrimSpace(draft)) {
+			return wf.Version, ErrNothingToPublish
+		}
+	}
+
+	next := wf.Version + 1
+	_, err = tx.Exec(`
+		INSERT INTO workflow_versions (workflow_id, version, canvas_snapshot, created_by, created_at)
+		VALUES (?, ?, ?, ?, NOW())
+	`, workflowID, next, wf.Canvas.String, nullableID(userID))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE workflows SET version = ?, is_published = 1 WHERE id = ?", next, workflowID); err != nil {
+		return 0, err
+	}
+	return next, tx.Commit()
+}
+
+// GetWorkflowVersions mengambil semua versi yang pernah dipublish (terbaru dulu),
+// masing-masing dengan daftar perubahan dibanding versi sebelumnya.
+func (r *WorkflowRepository) GetWorkflowVersions(workflowID int) ([]WorkflowVersionInfo, error) {
+	var versions []entity.WorkflowVersion
+	query := `
+		SELECT id, workflow_id, version, canvas_snapshot, created_by, created_at
+		FROM workflow_versions
+		WHERE workflow_id = ?
+		ORDER BY version ASC
+	`
+	if err := database.DB.Select(&versions, query, workflowID); err != nil {
+		return nil, err
+	}
+
+	result := make([]WorkflowVersionInfo, len(versions))
+	prev := &workflow.Canvas{}
+	for i, v := range versions {
+		canvas, err := workflow.ParseCanvas(v.Canvas)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot workflow %d v%d rusak: %w", workflowID, v.Version, err)
+		}
+		// Ditulis dari belakang supaya urutannya terbaru dulu
+		result[len(versions)-1-i] = WorkflowVersionInfo{WorkflowVersion: v, Changes: workflow.Compare(prev, canvas)}
+		prev = canvas
+	}
+	return result, nil
+}
+
+// DiffWorkflowVersions membandingkan dua versi. Versi 0 berarti draft yang sedang diedit.
+func (r *WorkflowRepository) DiffWorkflowVersions(workflowID, from, to int) (workflow.Diff, error) {
+	fromCanvas, err := loadWorkflowCanvas(database.DB, workflowID, from)
+	if err != nil {
+		return workflow.Diff{}, err
+	}
+	toCanvas, err := loadWorkflowCanvas(database.DB, workflowID, to)
+	if err != nil {
+		return workflow.Diff{}, err
+	}
+	return workflow.Compare(fromCanvas, toCanvas), nil
+}
+
+// loadWorkflowCanvas membaca canvas versi tertentu, atau draft jika version 0
+func loadWorkflowCanvas(q sqlx.Queryer, workflowID, version int) (*workflow.Canvas, error) {
+	var raw sql.NullString
+	var err error
+	if version > 0 {
+		err = sqlx.Get(q, &raw, "SELECT canvas_snapshot FROM workflow_versions WHERE workflow_id = ? AND version = ?", workflowID, version)
+		if err == sql.ErrNoRows {
+			return nil, ErrWorkflowVersionNotFound
+		}
+	} else {
+		err = sqlx.Get(q, &raw, "SELECT canvas_config FROM workflows WHERE id = ?", workflowID)
+		if err == sql.ErrNoRows {
+			return nil, ErrWorkflowNotFound
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return workflow.ParseCanvas([]byte(raw.String))
+}
+
+// SimulateWorkflow menjalankan dry-run workflow memakai estimated_duration tiap template.
+// version 0 mensimulasikan draft yang sedang diedit. Tidak ada data yang ditulis.
+func (r *WorkflowRepository) SimulateWorkflow(workflowID, version int, input workflow.SimulationInput) (*workflow.SimulationResult, error) {
+	canvas, err := loadWorkflowCanvas(database.DB, workflowID, version)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := workflow.NewGraph(canvas)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ID       int `db:"id"`
+		Duration int `db:"estimated_duration"`
+	}
+	err = database.DB.Select(&rows, "SELECT id, estimated_duration FROM process_templates WHERE estimated_duration IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	durations := make(map[int]int, len(rows))
+	for _, row := range rows {
+		durations[row.ID] = row.Duration
+	}
+
+	return workflow.Simulate(graph, durations, input)
+}
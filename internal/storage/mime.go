@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// allowedTypes adalah whitelist tipe file lampiran beserta ekstensi yang boleh dipakai
+var allowedTypes = map[string][]string{
+	"image/jpeg":      {".jpg", ".jpeg"},
+	"image/png":       {".png"},
+	"image/gif":       {".gif"},
+	"image/webp":      {".webp"},
+	"application/pdf": {".pdf"},
+	"text/plain":      {".txt", ".log"},
+	"text/csv":        {".csv"},
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         {".xlsx"},
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   {".docx"},
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": {".pptx"},
+}
+
+// containerTypes adalah hasil deteksi yang isinya bisa beberapa format; tipe akhirnya
+// ditentukan dari ekstensi (misal file Office terdeteksi sebagai zip, CSV sebagai teks biasa)
+var containerTypes = map[string]map[string]string{
+	"application/zip": {
+		".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	},
+	"text/plain": {
+		".csv": "text/csv",
+	},
+}
+
+// DetectType menentukan MIME type dari isi file (maksimal 512 byte pertama), bukan dari
+// Content-Type kiriman client. ok false jika tipenya tidak ada di whitelist atau
+// ekstensi nama file tidak cocok dengan isinya.
+func DetectType(head []byte, filename string) (mimeType string, ok bool) {
+	mimeType = http.DetectContentType(head)
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:i])
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if refined, found := containerTypes[mimeType][ext]; found {
+		mimeType = refined
+	}
+	for _, allowed := range allowedTypes[mimeType] {
+		if allowed == ext {
+			return mimeType, true
+		}
+	}
+	return mimeType, false
+}
+
+// AllowedExtensions mengembalikan semua ekstensi yang boleh diunggah, urut abjad (untuk pesan error)
+func AllowedExtensions() []string {
+	var exts []string
+	for _, list := range allowedTypes {
+		exts = append(exts, list...)
+	}
+	sort.Strings(exts)
+	return exts
+}
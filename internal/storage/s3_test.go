@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Vektor di bawah diambil dari contoh resmi AWS Signature Version 4
+// (dokumentasi "Deriving the signing key" dan contoh GET Object di S3 API Reference).
+
+func TestSigningKeyAWSExample(t *testing.T) {
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if got := hex.EncodeToString(key); got != want {
+		t.Fatalf("signing key = %s, want %s", got, want)
+	}
+}
+
+func TestSignV4AWSGetObjectExample(t *testing.T) {
+	const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	canonical, signedHeaders := canonicalRequest("GET", "/test.txt", map[string]string{
+		"host":                 "examplebucket.s3.amazonaws.com",
+		"range":                "bytes=0-9",
+		"x-amz-content-sha256": emptyHash,
+		"x-amz-date":           "20130524T000000Z",
+	}, emptyHash)
+
+	wantCanonical := strings.Join([]string{
+		"GET",
+		"/test.txt",
+		"",
+		"host:examplebucket.s3.amazonaws.com",
+		"range:bytes=0-9",
+		"x-amz-content-sha256:" + emptyHash,
+		"x-amz-date:20130524T000000Z",
+		"",
+		"host;range;x-amz-content-sha256;x-amz-date",
+		emptyHash,
+	}, "\n")
+	if canonical != wantCanonical {
+		t.Fatalf("canonical request:\n%s\nwant:\n%s", canonical, wantCanonical)
+	}
+	if signedHeaders != "host;range;x-amz-content-sha256;x-amz-date" {
+		t.Fatalf("signed headers = %s", signedHeaders)
+	}
+	if got, want := sha256Hex([]byte(canonical)), "7344ae5b7ee6c3e7e6b0fe0640412a37625d1fbfff95c48bbb2dc43964946972"; got != want {
+		t.Fatalf("canonical request hash = %s, want %s", got, want)
+	}
+
+	scope, signature := signV4("wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", "us-east-1", "s3", "20130524T000000Z", canonical)
+	if scope != "20130524/us-east-1/s3/aws4_request" {
+		t.Fatalf("scope = %s", scope)
+	}
+	if want := "f0e8bdb87c964420e857bd35b5d6ed310bd44f0170aba48dd91039c6036bdb41"; signature != want {
+		t.Fatalf("signature = %s, want %s", signature, want)
+	}
+}
+
+func TestEncodeS3Path(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/bucket/2024/01/a.jpg", "/bucket/2024/01/a.jpg"},
+		{"/bucket/foto QC (1).jpg", "/bucket/foto%20QC%20%281%29.jpg"},
+		{"/bucket/a+b~c_d-e.txt", "/bucket/a%2Bb~c_d-e.txt"},
+		{"/bucket/é.png", "/bucket/%C3%A9.png"},
+	}
+	for _, tt := range tests {
+		if got := encodeS3Path(tt.in); got != tt.want {
+			t.Errorf("encodeS3Path(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// fakeS3 adalah server S3 minimal di memori yang memeriksa signature setiap request
+// dari sudut pandang server (host dan path yang benar-benar diterima).
+type fakeS3 struct {
+	t         *testing.T
+	accessKey string
+	secretKey string
+	region    string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f.verify(r); err != nil {
+		f.t.Errorf("%s %s: %v", r.Method, r.URL.EscapedPath(), err)
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	path := r.URL.Path
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			http.Error(w, "<Error><Code>MissingContentLength</Code></Error>", http.StatusLengthRequired)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.objects[path] = body
+		f.types[path] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		body, ok := f.objects[path]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) verify(r *http.Request) error {
+	amzDate := r.Header.Get("X-Amz-Date")
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	canonical, signedHeaders := canonicalRequest(r.Method, r.URL.EscapedPath(), map[string]string{
+		"host":                 r.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}, payloadHash)
+	scope, signature := signV4(f.secretKey, f.region, "s3", amzDate, canonical)
+	want := "AWS4-HMAC-SHA256 Credential=" + f.accessKey + "/" + scope +
+		", SignedHeaders=" + signedHeaders + ", Signature=" + signature
+	if got := r.Header.Get("Authorization"); got != want {
+		return errors.New("authorization = " + got + ", want " + want)
+	}
+	return nil
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	fake := &fakeS3{
+		t: t, accessKey: "AKIDEXAMPLE", secretKey: "secret", region: "ap-southeast-1",
+		objects: map[string][]byte{}, types: map[string]string{},
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	s, err := NewS3(S3Config{
+		Endpoint: srv.URL + "/", Region: fake.region, Bucket: "qc-files",
+		AccessKey: fake.accessKey, SecretKey: fake.secretKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return time.Date(2024, 3, 5, 23, 59, 59, 0, time.FixedZone("WIB", 7*3600)) }
+
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		key  string
+		body []byte
+		size int64
+	}{
+		{"ukuran diketahui", "2024/03/foto.jpg", []byte("jpeg bytes"), 10},
+		{"ukuran tidak diketahui", "2024/03/laporan.pdf", []byte("%PDF-1.7"), -1},
+		{"key dengan spasi dan simbol", "2024/03/foto QC (1)+rev.png", []byte{0x89, 'P', 'N', 'G'}, 4},
+		{"isi kosong", "2024/03/kosong.txt", []byte{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Put(ctx, tt.key, bytes.NewReader(tt.body), tt.size, "application/octet-stream"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if got := fake.types["/qc-files/"+tt.key]; got != "application/octet-stream" {
+				t.Errorf("content type tersimpan = %q", got)
+			}
+
+			rc, err := s.Get(ctx, tt.key)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			got, _ := io.ReadAll(rc)
+			rc.Close()
+			if !bytes.Equal(got, tt.body) {
+				t.Fatalf("Get = %q, want %q", got, tt.body)
+			}
+
+			if err := s.Delete(ctx, tt.key); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := s.Get(ctx, tt.key); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get setelah Delete = %v, want ErrNotFound", err)
+			}
+			// Menghapus key yang sudah tidak ada bukan error
+			if err := s.Delete(ctx, tt.key); err != nil {
+				t.Fatalf("Delete ulang: %v", err)
+			}
+		})
+	}
+
+	if err := s.Put(ctx, "../luar.txt", strings.NewReader("x"), 1, ""); err == nil {
+		t.Fatal("Put dengan key keluar root seharusnya ditolak")
+	}
+}
+
+func TestS3ErrorIncludesResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	s, err := NewS3(S3Config{Endpoint: srv.URL, Bucket: "b", AccessKey: "a", SecretKey: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Put(context.Background(), "x.txt", strings.NewReader("x"), 1, "")
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Fatalf("Put error = %v, want pesan AccessDenied", err)
+	}
+}
@@ -0,0 +1,63 @@
+// Package storage menyimpan isi file lampiran. Database hanya menyimpan metadata dan key;
+// isi file ada di backend yang dipilih lewat environment:
+//
+//	STORAGE_DRIVER=local (default)  UPLOAD_DIR=./uploads
+//	STORAGE_DRIVER=s3               S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY, S3_SECRET_KEY
+//
+// Backend s3 memakai API S3 standar (path-style) sehingga bisa diarahkan ke AWS S3
+// maupun pengganti lokal seperti MinIO.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+var ErrNotFound = errors.New("stored file not found")
+
+// Storage adalah backend penyimpanan isi file. Key berupa path relatif dengan pemisah '/'.
+type Storage interface {
+	// Put menyimpan isi r sebagai key. size adalah jumlah byte r (-1 jika tidak diketahui).
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get membuka isi file; pemanggil wajib menutupnya. ErrNotFound jika key tidak ada.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete menghapus file. Menghapus key yang tidak ada tidak dianggap error.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewFromEnv membuat backend sesuai STORAGE_DRIVER
+func NewFromEnv() (Storage, error) {
+	switch driver := strings.ToLower(os.Getenv("STORAGE_DRIVER")); driver {
+	case "", "local":
+		dir := os.Getenv("UPLOAD_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return NewLocal(dir)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("STORAGE_DRIVER '%s' tidak dikenal (gunakan local atau s3)", driver)
+	}
+}
+
+// cleanKey menormalkan key dan menolak key yang keluar dari root (misal "../")
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(key, `\`, "/"))
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "" || cleaned == "." || cleaned != strings.TrimPrefix(key, "/") {
+		return "", fmt.Errorf("key file tidak valid: '%s'", key)
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,147 @@
+package validation
+
+import (
+	"fmt"
+	"math"
+	"pt-besq-core/internal/entity"
+	"pt-besq-core/internal/expr"
+	"strings"
+)
+
+// computedField adalah kolom computed yang ekspresinya sudah di-parse
+type computedField struct {
+	field entity.FieldDef
+	expr  *expr.Expr
+}
+
+// CheckComputed memastikan setiap kolom computed punya ekspresi yang valid,
+// hanya merujuk kolom lain di template yang sama, dan tidak saling bergantung melingkar.
+func CheckComputed(fields []entity.FieldDef) error {
+	for _, f := range fields {
+		if f.Type != "computed" && strings.TrimSpace(f.Expression) != "" {
+			return fmt.Errorf("field '%s': expression hanya untuk tipe computed", f.Key)
+		}
+	}
+	_, err := computeOrder(fields)
+	return err
+}
+
+// computeOrder mengurutkan kolom computed sesuai ketergantungannya,
+// sehingga kolom yang memakai hasil kolom computed lain dihitung belakangan.
+func computeOrder(fields []entity.FieldDef) ([]computedField, error) {
+	known := make(map[string]bool, len(fields))
+	pending := map[string]computedField{}
+	var keys []string
+	for _, f := range fields {
+		known[f.Key] = true
+		if f.Type != "computed" {
+			continue
+		}
+		if strings.TrimSpace(f.Expression) == "" {
+			return nil, fmt.Errorf("field '%s': expression wajib diisi untuk tipe computed", f.Key)
+		}
+		e, err := expr.Parse(f.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %w", f.Key, err)
+		}
+		pending[f.Key] = computedField{field: f, expr: e}
+		keys = append(keys, f.Key)
+	}
+
+	for _, key := range keys {
+		for _, name := range pending[key].expr.Identifiers() {
+			if name == key {
+				return nil, fmt.Errorf("field '%s': expression tidak boleh merujuk dirinya sendiri", key)
+			}
+			if !known[name] {
+				return nil, fmt.Errorf("field '%s': kolom '%s' tidak ada di template", key, name)
+			}
+		}
+	}
+
+	ordered := make([]computedField, 0, len(keys))
+	done := map[string]bool{}
+	for len(ordered) < len(keys) {
+		progressed := false
+		for _, key := range keys {
+			if done[key] {
+				continue
+			}
+			ready := true
+			for _, name := range pending[key].expr.Identifiers() {
+				if _, isComputed := pending[name]; isComputed && !done[name] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, pending[key])
+				done[key] = true
+				progressed = true
+			}
+		}
+		if !progressed {
+			var cycle []string
+			for _, key := range keys {
+				if !done[key] {
+					cycle = append(cycle, key)
+				}
+			}
+			return nil, fmt.Errorf("kolom computed saling bergantung melingkar: %s", strings.Join(cycle, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// compute menghitung semua kolom computed dan menimpa nilai yang mungkin dikirim client.
+// Jika ada kolom sumber yang kosong atau tidak valid, hasilnya dibiarkan kosong.
+func (v *Validator) compute(errs *Errors, input map[string]interface{}, invalid map[string]bool) {
+	ordered, err := computeOrder(v.Fields)
+	if err != nil {
+		*errs = append(*errs, FieldError{Code: "invalid_expression", Message: err.Error()})
+		return
+	}
+
+	for _, cf := range ordered {
+		delete(input, cf.field.Key)
+
+		missing, broken := false, false
+		for _, name := range cf.expr.Identifiers() {
+			if invalid[name] {
+				broken = true
+			} else if isEmpty(input[name]) {
+				missing = true
+			}
+		}
+		if broken {
+			// Kesalahan sudah dilaporkan di kolom sumbernya
+			invalid[cf.field.Key] = true
+			continue
+		}
+		if missing {
+			continue
+		}
+
+		val, err := cf.expr.Eval(input)
+		if err != nil {
+			errs.add(cf.field, "compute", "kolom '%s' gagal dihitung: %v", cf.field.Label, err)
+			invalid[cf.field.Key] = true
+			continue
+		}
+		if f, ok := val.(float64); ok {
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				errs.add(cf.field, "compute", "kolom '%s' menghasilkan angka tidak valid", cf.field.Label)
+				invalid[cf.field.Key] = true
+				continue
+			}
+			// Hilangkan sisa pembulatan float seperti 0.30000000000000004
+			val = math.Round(f*1e9) / 1e9
+		}
+		if _, isList := val.([]interface{}); isList {
+			errs.add(cf.field, "compute", "kolom '%s' tidak boleh menghasilkan daftar", cf.field.Label)
+			invalid[cf.field.Key] = true
+			continue
+		}
+		input[cf.field.Key] = val
+	}
+}
@@ -0,0 +1,114 @@
+package validation
+
+import (
+	"pt-besq-core/internal/entity"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func computedDef(key, expression string) entity.FieldDef {
+	return entity.FieldDef{Key: key, Label: key, Type: "computed", Expression: expression}
+}
+
+func TestCheckComputed(t *testing.T) {
+	number := func(key string) entity.FieldDef { return entity.FieldDef{Key: key, Label: key, Type: "number"} }
+	tests := []struct {
+		name    string
+		fields  []entity.FieldDef
+		wantErr string // potongan pesan error; kosong berarti valid
+	}{
+		{"sederhana", []entity.FieldDef{number("a"), number("b"), computedDef("total", "a * b")}, ""},
+		{"bergantung pada computed lain", []entity.FieldDef{computedDef("c", "b + 1"), computedDef("b", "a * 2"), number("a")}, ""},
+		{"tanpa variabel", []entity.FieldDef{computedDef("pi", "round(3.14159, 2)")}, ""},
+		{"expression kosong", []entity.FieldDef{computedDef("x", " ")}, "expression wajib diisi"},
+		{"expression di kolom biasa", []entity.FieldDef{{Key: "a", Type: "number", Expression: "1 + 1"}}, "hanya untuk tipe computed"},
+		{"tidak bisa di-parse", []entity.FieldDef{number("a"), computedDef("x", "a +")}, "field 'x'"},
+		{"merujuk diri sendiri", []entity.FieldDef{computedDef("x", "x + 1")}, "dirinya sendiri"},
+		{"kolom tidak ada", []entity.FieldDef{computedDef("x", "berat * 2")}, "kolom 'berat' tidak ada"},
+		{"melingkar", []entity.FieldDef{number("a"), computedDef("x", "y + a"), computedDef("y", "x * 2")}, "melingkar: x, y"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckComputed(tt.fields)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckComputed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CheckComputed err = %v, want memuat %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestComputeOrder(t *testing.T) {
+	fields := []entity.FieldDef{
+		computedDef("d", "c + b"),
+		computedDef("c", "b * 2"),
+		{Key: "a", Type: "number"},
+		computedDef("b", "a + 1"),
+	}
+	ordered, err := computeOrder(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, cf := range ordered {
+		got = append(got, cf.field.Key)
+	}
+	if want := []string{"b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("computeOrder = %v, want %v", got, want)
+	}
+}
+
+func TestValidateComputed(t *testing.T) {
+	fields := []entity.FieldDef{
+		{Key: "berat", Label: "Berat", Type: "number"},
+		{Key: "jumlah", Label: "Jumlah", Type: "number"},
+		{Key: "kode", Label: "Kode", Type: "text"},
+		{Key: "total", Label: "Total", Type: "computed", Expression: "berat * jumlah", IsRequired: true, ValidationRule: `{"max": 100}`},
+		{Key: "per_item", Label: "Per item", Type: "computed", Expression: "total / jumlah"},
+		{Key: "label", Label: "Label", Type: "computed", Expression: "kode + '-' + kode"},
+	}
+	tests := []struct {
+		name  string
+		input map[string]interface{}
+		want  map[string]interface{} // nilai computed yang diharapkan (nil = tidak ada di input)
+		codes []string               // "field:code"
+	}{
+		{"dihitung dan menimpa kiriman client",
+			map[string]interface{}{"berat": 0.1, "jumlah": 3.0, "kode": "A", "total": 999.0},
+			map[string]interface{}{"total": 0.3, "per_item": 0.1, "label": "A-A"}, nil},
+		{"sumber kosong membuat hasil kosong dan wajib",
+			map[string]interface{}{"berat": 2.0, "kode": "B"},
+			map[string]interface{}{"total": nil, "per_item": nil, "label": "B-B"}, []string{"total:required"}},
+		{"batas angka berlaku pada hasil",
+			map[string]interface{}{"berat": 50.0, "jumlah": 3.0, "kode": "C"},
+			map[string]interface{}{"total": 150.0, "per_item": 50.0, "label": "C-C"}, []string{"total:max"}},
+		{"pembagian nol dilaporkan di kolom computed",
+			map[string]interface{}{"berat": 2.0, "jumlah": 0.0, "kode": "D"},
+			map[string]interface{}{"total": 0.0, "per_item": nil, "label": "D-D"}, []string{"per_item:compute"}},
+		{"sumber tidak valid tidak dilaporkan dua kali",
+			map[string]interface{}{"berat": "berat", "jumlah": 2.0, "kode": "E"},
+			map[string]interface{}{"total": nil, "per_item": nil, "label": "E-E"}, []string{"berat:type"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var codes []string
+			for _, fe := range New(fields).Validate(tt.input) {
+				codes = append(codes, fe.Field+":"+fe.Code)
+			}
+			if !reflect.DeepEqual(codes, tt.codes) {
+				t.Errorf("errors = %v, want %v", codes, tt.codes)
+			}
+			for key, want := range tt.want {
+				if got := tt.input[key]; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %#v, want %#v", key, got, want)
+				}
+			}
+		})
+	}
+}
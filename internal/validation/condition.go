@@ -0,0 +1,121 @@
+package validation
+
+import (
+	"fmt"
+	"pt-besq-core/internal/entity"
+	"pt-besq-core/internal/expr"
+	"strings"
+)
+
+// conditions adalah show_when dan required_when sebuah kolom yang sudah di-parse
+type conditions struct {
+	show     *expr.Expr
+	required *expr.Expr
+}
+
+// CheckConditions memastikan show_when dan required_when bisa di-parse
+// dan hanya merujuk kolom lain di template yang sama.
+func CheckConditions(fields []entity.FieldDef) error {
+	_, err := parseConditions(fields)
+	return err
+}
+
+func parseConditions(fields []entity.FieldDef) (map[string]conditions, error) {
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f.Key] = true
+	}
+
+	parse := func(f entity.FieldDef, name, src string) (*expr.Expr, error) {
+		if strings.TrimSpace(src) == "" {
+			return nil, nil
+		}
+		e, err := expr.Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %s: %w", f.Key, name, err)
+		}
+		for _, ident := range e.Identifiers() {
+			if ident == f.Key {
+				return nil, fmt.Errorf("field '%s': %s tidak boleh merujuk dirinya sendiri", f.Key, name)
+			}
+			if !known[ident] {
+				return nil, fmt.Errorf("field '%s': %s merujuk kolom '%s' yang tidak ada", f.Key, name, ident)
+			}
+		}
+		return e, nil
+	}
+
+	out := make(map[string]conditions, len(fields))
+	for _, f := range fields {
+		var c conditions
+		var err error
+		if c.show, err = parse(f, "show_when", f.ShowWhen); err != nil {
+			return nil, err
+		}
+		if c.required, err = parse(f, "required_when", f.RequiredWhen); err != nil {
+			return nil, err
+		}
+		out[f.Key] = c
+	}
+	return out, nil
+}
+
+// resolveVisibility menentukan kolom mana yang tersembunyi dan menghapus nilainya dari input.
+// Kolom yang tersembunyi dianggap kosong oleh kondisi kolom lain, jadi perhitungan
+// diulang sampai hasilnya stabil (misal C bergantung pada B yang bergantung pada A).
+func (v *Validator) resolveVisibility(errs *Errors, input map[string]interface{}, conds map[string]conditions, invalid map[string]bool) map[string]bool {
+	hidden := map[string]bool{}
+	for pass := 0; pass <= len(v.Fields); pass++ {
+		var passErrs Errors
+		v.compute(&passErrs, input, invalid)
+
+		changed := false
+		for _, f := range v.Fields {
+			show := conds[f.Key].show
+			if show == nil || hidden[f.Key] {
+				continue
+			}
+			visible, err := show.EvalBool(input)
+			if err != nil {
+				passErrs.add(f, "condition", "kondisi tampil kolom '%s' gagal dievaluasi: %v", f.Label, err)
+				continue
+			}
+			if !visible {
+				hidden[f.Key] = true
+				delete(input, f.Key)
+				delete(invalid, f.Key)
+				changed = true
+			}
+		}
+
+		if !changed {
+			for _, fe := range passErrs {
+				if !hidden[fe.Field] {
+					*errs = append(*errs, fe)
+				}
+			}
+			break
+		}
+	}
+	// Kolom computed yang tersembunyi juga tidak disimpan
+	for key := range hidden {
+		delete(input, key)
+	}
+	return hidden
+}
+
+// isRequired menggabungkan is_required dengan required_when
+func (v *Validator) isRequired(errs *Errors, f entity.FieldDef, c conditions, input map[string]interface{}) bool {
+	if f.IsRequired {
+		return true
+	}
+	if c.required == nil {
+		return false
+	}
+	required, err := c.required.EvalBool(input)
+	if err != nil {
+		errs.add(f, "condition", "kondisi wajib kolom '%s' gagal dievaluasi: %v", f.Label, err)
+		return false
+	}
+	return required
+}
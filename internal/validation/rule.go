@@ -0,0 +1,148 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"pt-besq-core/internal/expr"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule adalah isi kolom field_definitions.validation_rule (format JSON).
+//
+// Contoh:
+//
+//	{"min": 0, "max": 250, "integer": true}
+//	{"pattern": "^BATCH-[0-9]+$", "min_length": 6}
+//	{"options": ["fast", "slow"]}
+//	{"options_from": {"template_id": 1, "field_key": "batch_code", "status": ["completed"]}}
+//	{"min_date": "today-30d", "max_date": "today"}
+//	{"rules": ["curing_time >= 30 when oven_temp > 180"]}
+type Rule struct {
+	Min         *float64      `json:"min,omitempty"`
+	Max         *float64      `json:"max,omitempty"`
+	Integer     bool          `json:"integer,omitempty"`
+	Pattern     string        `json:"pattern,omitempty"`
+	MinLength   *int          `json:"min_length,omitempty"`
+	MaxLength   *int          `json:"max_length,omitempty"`
+	Options     []string      `json:"options,omitempty"`
+	OptionsFrom *OptionSource `json:"options_from,omitempty"`
+	MinDate     string        `json:"min_date,omitempty"`
+	MaxDate     string        `json:"max_date,omitempty"`
+	Rules       []CrossRule   `json:"rules,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// OptionSource mengambil pilihan kolom select dari instance template lain.
+// Nilai yang diambil adalah isi FieldKey di data_payload; jika FieldKey kosong, batch_number yang dipakai.
+type OptionSource struct {
+	TemplateID int      `json:"template_id"`
+	FieldKey   string   `json:"field_key,omitempty"`
+	Status     []string `json:"status,omitempty"`
+}
+
+// CrossRule adalah aturan antar kolom: Assert harus benar setiap kali When benar.
+// Bisa ditulis sebagai objek {"assert": "...", "when": "...", "message": "..."}
+// atau string singkat "curing_time >= 30 when oven_temp > 180".
+type CrossRule struct {
+	Assert  string `json:"assert"`
+	When    string `json:"when,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	assert *expr.Expr
+	when   *expr.Expr
+}
+
+func (r *CrossRule) UnmarshalJSON(data []byte) error {
+	var short string
+	if err := json.Unmarshal(data, &short); err == nil {
+		assert, when, _ := strings.Cut(short, " when ")
+		r.Assert = strings.TrimSpace(assert)
+		r.When = strings.TrimSpace(when)
+		return nil
+	}
+
+	type plain CrossRule
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*r = CrossRule(p)
+	return nil
+}
+
+// ParseRule membaca dan meng-compile validation_rule. String kosong berarti tanpa aturan.
+func ParseRule(raw string) (*Rule, error) {
+	rule := &Rule{}
+	if strings.TrimSpace(raw) == "" {
+		return rule, nil
+	}
+	if err := json.Unmarshal([]byte(raw), rule); err != nil {
+		return nil, fmt.Errorf("validation_rule bukan JSON yang valid: %w", err)
+	}
+
+	if rule.Pattern != "" {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern tidak valid: %w", err)
+		}
+		rule.pattern = re
+	}
+	if rule.OptionsFrom != nil && rule.OptionsFrom.TemplateID <= 0 {
+		return nil, fmt.Errorf("options_from.template_id wajib diisi")
+	}
+	for _, d := range []string{rule.MinDate, rule.MaxDate} {
+		if d == "" {
+			continue
+		}
+		if _, err := resolveDate(d, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	for i := range rule.Rules {
+		cr := &rule.Rules[i]
+		if cr.Assert == "" {
+			return nil, fmt.Errorf("rules[%d]: assert wajib diisi", i)
+		}
+		var err error
+		if cr.assert, err = expr.Parse(cr.Assert); err != nil {
+			return nil, fmt.Errorf("rules[%d]: %w", i, err)
+		}
+		if cr.When != "" {
+			if cr.when, err = expr.Parse(cr.When); err != nil {
+				return nil, fmt.Errorf("rules[%d]: %w", i, err)
+			}
+		}
+	}
+	return rule, nil
+}
+
+// resolveDate menerjemahkan tanggal absolut (2006-01-02) atau relatif ("today", "today-7d", "today+1d")
+func resolveDate(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	if !strings.HasPrefix(s, "today") {
+		t, err := time.ParseInLocation("2006-01-02", s, now.Location())
+		if err != nil {
+			return time.Time{}, fmt.Errorf("tanggal '%s' harus format YYYY-MM-DD atau today±Nd", s)
+		}
+		return t, nil
+	}
+
+	offset := strings.TrimPrefix(s, "today")
+	if offset == "" {
+		return today, nil
+	}
+	if !strings.HasSuffix(offset, "d") {
+		return time.Time{}, fmt.Errorf("tanggal relatif '%s' harus diakhiri 'd', misal today-7d", s)
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(offset, "d"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("tanggal relatif '%s' tidak valid", s)
+	}
+	return today.AddDate(0, 0, days), nil
+}
@@ -0,0 +1,186 @@
+package validation
+
+import (
+	"errors"
+	"pt-besq-core/internal/entity"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string // potongan pesan error; kosong berarti valid
+	}{
+		{"kosong", "  ", ""},
+		{"angka", `{"min": 0, "max": 250, "integer": true}`, ""},
+		{"pattern", `{"pattern": "^BATCH-[0-9]+$", "min_length": 6}`, ""},
+		{"tanggal relatif", `{"min_date": "today-30d", "max_date": "today"}`, ""},
+		{"aturan singkat", `{"rules": ["curing_time >= 30 when oven_temp > 180"]}`, ""},
+		{"aturan objek", `{"rules": [{"assert": "a > 1", "message": "a terlalu kecil"}]}`, ""},
+		{"bukan JSON", `{min: 1}`, "bukan JSON yang valid"},
+		{"pattern rusak", `{"pattern": "([a-z"}`, "pattern tidak valid"},
+		{"options_from tanpa template", `{"options_from": {"field_key": "x"}}`, "template_id wajib"},
+		{"tanggal salah format", `{"min_date": "31-01-2026"}`, "YYYY-MM-DD"},
+		{"tanggal relatif tanpa d", `{"max_date": "today+7"}`, "diakhiri 'd'"},
+		{"assert kosong", `{"rules": [{"when": "a > 1"}]}`, "rules[0]: assert wajib"},
+		{"assert tidak bisa di-parse", `{"rules": ["a >"]}`, "rules[0]"},
+		{"when tidak bisa di-parse", `{"rules": ["a > 1", "b > 1 when ("]}`, "rules[1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRule(tt.raw)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseRule(%s): %v", tt.raw, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseRule(%s) err = %v, want memuat %q", tt.raw, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCrossRuleShortForm(t *testing.T) {
+	rule, err := ParseRule(`{"rules": ["curing_time >= 30 when oven_temp > 180", "a != b"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rule.Rules[0]; got.Assert != "curing_time >= 30" || got.When != "oven_temp > 180" {
+		t.Errorf("rules[0] = %+v", got)
+	}
+	if got := rule.Rules[1]; got.Assert != "a != b" || got.When != "" {
+		t.Errorf("rules[1] = %+v", got)
+	}
+}
+
+func TestResolveDate(t *testing.T) {
+	now := time.Date(2026, 3, 1, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"today", "2026-03-01"},
+		{"today-1d", "2026-02-28"},
+		{"today+30d", "2026-03-31"},
+		{" 2025-12-31 ", "2025-12-31"},
+	}
+	for _, tt := range tests {
+		got, err := resolveDate(tt.in, now)
+		if err != nil {
+			t.Errorf("resolveDate(%q): %v", tt.in, err)
+			continue
+		}
+		if got.Format("2006-01-02 15:04") != tt.want+" 00:00" {
+			t.Errorf("resolveDate(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+	if _, err := resolveDate("todayx", now); err == nil {
+		t.Error("resolveDate(todayx) seharusnya error")
+	}
+}
+
+// fakeResolver menjawab pilihan options_from dan kepemilikan file tanpa database
+type fakeResolver struct {
+	options []string
+	files   map[int64]bool
+}
+
+func (r fakeResolver) OptionValues(src OptionSource) ([]string, error) {
+	if src.TemplateID == 99 {
+		return nil, errors.New("database mati")
+	}
+	return r.options, nil
+}
+
+func (r fakeResolver) AttachmentUsable(id, instanceID int64, userID int) (bool, error) {
+	return r.files[id], nil
+}
+
+func TestValidateRules(t *testing.T) {
+	field := func(key, typ, rule string) entity.FieldDef {
+		return entity.FieldDef{Key: key, Label: key, Type: typ, ValidationRule: rule}
+	}
+	tests := []struct {
+		name   string
+		fields []entity.FieldDef
+		input  map[string]interface{}
+		want   []string // "field:code" sesuai urutan error
+	}{
+		{"angka dalam batas", []entity.FieldDef{field("suhu", "number", `{"min": 0, "max": 250}`)},
+			map[string]interface{}{"suhu": 180.0}, nil},
+		{"angka di luar batas dan bukan bulat", []entity.FieldDef{field("suhu", "number", `{"max": 250, "integer": true}`)},
+			map[string]interface{}{"suhu": 250.5}, []string{"suhu:integer", "suhu:max"}},
+		{"angka bukan angka", []entity.FieldDef{field("suhu", "number", "")},
+			map[string]interface{}{"suhu": "panas"}, []string{"suhu:type"}},
+		{"teks pattern dan panjang", []entity.FieldDef{field("kode", "text", `{"pattern": "^B-[0-9]+$", "min_length": 5}`)},
+			map[string]interface{}{"kode": "X-1"}, []string{"kode:min_length", "kode:pattern"}},
+		{"panjang dihitung per karakter", []entity.FieldDef{field("nama", "text", `{"max_length": 3}`)},
+			map[string]interface{}{"nama": "éèê"}, nil},
+		{"select statis", []entity.FieldDef{field("mode", "select", `{"options": ["fast", "slow"]}`)},
+			map[string]interface{}{"mode": "turbo"}, []string{"mode:option"}},
+		{"select dari template lain", []entity.FieldDef{field("bahan", "select", `{"options_from": {"template_id": 1}}`)},
+			map[string]interface{}{"bahan": "MIX-002"}, nil},
+		{"select dari template lain gagal", []entity.FieldDef{field("bahan", "select", `{"options_from": {"template_id": 99}}`)},
+			map[string]interface{}{"bahan": "MIX-002"}, []string{"bahan:option"}},
+		{"select tanpa pilihan", []entity.FieldDef{field("mode", "select", "")},
+			map[string]interface{}{"mode": "fast"}, []string{"mode:option"}},
+		{"tanggal relatif", []entity.FieldDef{field("tgl", "date", `{"min_date": "today-7d", "max_date": "today"}`)},
+			map[string]interface{}{"tgl": "2026-02-20"}, []string{"tgl:min_date"}},
+		{"datetime di hari max_date masih lolos", []entity.FieldDef{field("jam", "datetime", `{"max_date": "today"}`)},
+			map[string]interface{}{"jam": "2026-03-01T23:59:00"}, nil},
+		{"datetime besok ditolak", []entity.FieldDef{field("jam", "datetime", `{"max_date": "today"}`)},
+			map[string]interface{}{"jam": "2026-03-02T00:00:00+07:00"}, []string{"jam:max_date"}},
+		{"file milik instance lain", []entity.FieldDef{field("foto", "file", "")},
+			map[string]interface{}{"foto": 8.0}, []string{"foto:file"}},
+		{"wajib diisi", []entity.FieldDef{{Key: "op", Label: "Operator", Type: "text", IsRequired: true}},
+			map[string]interface{}{"op": "  "}, []string{"op:required"}},
+		{"aturan antar kolom berlaku",
+			[]entity.FieldDef{field("oven_temp", "number", ""), field("curing_time", "number", `{"rules": ["curing_time >= 30 when oven_temp > 180"]}`)},
+			map[string]interface{}{"oven_temp": 200.0, "curing_time": 20.0}, []string{"curing_time:rule"}},
+		{"aturan antar kolom tidak berlaku",
+			[]entity.FieldDef{field("oven_temp", "number", ""), field("curing_time", "number", `{"rules": ["curing_time >= 30 when oven_temp > 180"]}`)},
+			map[string]interface{}{"oven_temp": 150.0, "curing_time": 20.0}, nil},
+		{"aturan antar kolom gagal dievaluasi", []entity.FieldDef{field("a", "text", `{"rules": ["a + 1 > 2"]}`)},
+			map[string]interface{}{"a": "x"}, []string{"a:rule"}},
+		{"aturan rusak", []entity.FieldDef{field("a", "text", `{"pattern": "("}`)},
+			map[string]interface{}{"a": "x"}, []string{"a:invalid_rule"}},
+	}
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.FixedZone("WIB", 7*3600))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New(tt.fields)
+			v.Now = func() time.Time { return now }
+			v.Resolver = fakeResolver{options: []string{"MIX-001", "MIX-002"}, files: map[int64]bool{7: true}}
+
+			var got []string
+			for _, fe := range v.Validate(tt.input) {
+				got = append(got, fe.Field+":"+fe.Code)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Validate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCrossRuleMessage(t *testing.T) {
+	fields := []entity.FieldDef{
+		{Key: "a", Label: "A", Type: "number", ValidationRule: `{"rules": [{"assert": "a > 1", "message": "A harus lebih dari 1"}, "a > 5 when a < 3"]}`},
+	}
+	errs := New(fields).Validate(map[string]interface{}{"a": 1.0})
+	if len(errs) != 2 {
+		t.Fatalf("Validate = %v", errs)
+	}
+	if errs[0].Message != "A harus lebih dari 1" {
+		t.Errorf("pesan kustom = %q", errs[0].Message)
+	}
+	if want := "kolom 'A' melanggar aturan: a > 5 (jika a < 3)"; errs[1].Message != want {
+		t.Errorf("pesan bawaan = %q, want %q", errs[1].Message, want)
+	}
+}
@@ -0,0 +1,414 @@
+// Package validation memeriksa data_payload sebuah instance terhadap definisi kolom template-nya.
+package validation
+
+import (
+	"fmt"
+	"math"
+	"pt-besq-core/internal/entity"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError adalah satu pelanggaran aturan pada satu kolom
+type FieldError struct {
+	Field   string `json:"field"`
+	Label   string `json:"label"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors adalah kumpulan pelanggaran. Semua pelanggaran dikumpulkan, tidak berhenti di yang pertama.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *Errors) add(f entity.FieldDef, code, format string, args ...interface{}) {
+	*e = append(*e, FieldError{
+		Field:   f.Key,
+		Label:   f.Label,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Resolver menyediakan data dari database yang dibutuhkan saat validasi
+// (pilihan select dinamis dan kepemilikan file lampiran).
+type Resolver interface {
+	// OptionValues mengembalikan semua nilai yang boleh dipilih dari instance template lain
+	OptionValues(src OptionSource) ([]string, error)
+	// AttachmentUsable memastikan file_attachments dengan id tersebut milik instance ini.
+	// Untuk instance baru (instanceID 0), file harus berupa upload yang belum terikat milik userID.
+	AttachmentUsable(attachmentID int64, instanceID int64, userID int) (bool, error)
+}
+
+// Validator menjalankan pengecekan tipe dan validation_rule untuk satu set kolom
+type Validator struct {
+	Fields   []entity.FieldDef
+	Now      func() time.Time
+	Resolver Resolver
+
+	// InstanceID adalah instance yang sedang divalidasi (0 jika instance baru)
+	InstanceID int64
+	// UserID adalah user yang mengirim data
+	UserID int
+}
+
+// New membuat Validator untuk definisi kolom sebuah template
+func New(fields []entity.FieldDef) *Validator {
+	return &Validator{Fields: fields, Now: time.Now}
+}
+
+// Validate memeriksa input dan mengembalikan semua pelanggaran (nil jika valid).
+// Nilai checkbox, datetime dan file ikut dinormalkan langsung di map input
+// (misal "yes" menjadi true, datetime menjadi RFC3339 dengan zona waktu),
+// kolom computed dihitung ulang oleh server, dan kolom yang tersembunyi karena
+// show_when dihapus dari input sehingga tidak pernah wajib dan tidak ikut tersimpan.
+func (v *Validator) Validate(input map[string]interface{}) Errors {
+	var errs Errors
+	conds, err := parseConditions(v.Fields)
+	if err != nil {
+		return Errors{{Code: "invalid_condition", Message: err.Error()}}
+	}
+
+	// Tahap 1: cek tipe dan normalkan nilai yang dikirim
+	var typeErrs Errors
+	rules := make(map[string]*Rule, len(v.Fields))
+	invalid := map[string]bool{}
+	for _, field := range v.Fields {
+		rule, err := ParseRule(field.ValidationRule)
+		if err != nil {
+			errs.add(field, "invalid_rule", "aturan validasi kolom '%s' rusak: %v", field.Label, err)
+			invalid[field.Key] = true
+			continue
+		}
+		rules[field.Key] = rule
+		if field.Type == "computed" {
+			continue
+		}
+
+		val, exists := input[field.Key]
+		if !exists || isEmpty(val) {
+			continue
+		}
+		if normalized, ok := v.checkValue(&typeErrs, field, rule, val); ok {
+			input[field.Key] = normalized
+		} else {
+			invalid[field.Key] = true
+		}
+	}
+
+	// Tahap 2: hitung kolom computed dan tentukan kolom yang tersembunyi
+	hidden := v.resolveVisibility(&errs, input, conds, invalid)
+	for _, fe := range typeErrs {
+		if !hidden[fe.Field] {
+			errs = append(errs, fe)
+		}
+	}
+
+	// Tahap 3: kolom wajib dan aturan antar kolom, hanya untuk kolom yang tampil
+	for _, field := range v.Fields {
+		rule, ok := rules[field.Key]
+		if !ok || hidden[field.Key] {
+			continue
+		}
+		required := v.isRequired(&errs, field, conds[field.Key], input)
+		if field.Type == "computed" {
+			v.checkComputedValue(&errs, field, rule, input[field.Key], required && !invalid[field.Key])
+		} else if required && isEmpty(input[field.Key]) {
+			errs.add(field, "required", "kolom '%s' wajib diisi", field.Label)
+		}
+		v.checkCrossRules(&errs, field, rule, input)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// checkComputedValue menerapkan kewajiban isi dan batas angka pada hasil kolom computed
+func (v *Validator) checkComputedValue(errs *Errors, field entity.FieldDef, rule *Rule, val interface{}, required bool) {
+	if val == nil {
+		if required {
+			errs.add(field, "required", "kolom '%s' tidak bisa dihitung karena kolom sumbernya belum diisi", field.Label)
+		}
+		return
+	}
+	num, ok := val.(float64)
+	if !ok {
+		return
+	}
+	if rule.Integer && num != math.Trunc(num) {
+		errs.add(field, "integer", "kolom '%s' harus bilangan bulat", field.Label)
+	}
+	if rule.Min != nil && num < *rule.Min {
+		errs.add(field, "min", "kolom '%s' minimal %v", field.Label, *rule.Min)
+	}
+	if rule.Max != nil && num > *rule.Max {
+		errs.add(field, "max", "kolom '%s' maksimal %v", field.Label, *rule.Max)
+	}
+}
+
+// checkValue mengecek satu nilai sesuai tipe kolomnya.
+// Mengembalikan nilai yang sudah dinormalkan dan true jika tipe nilainya bisa diterima.
+func (v *Validator) checkValue(errs *Errors, field entity.FieldDef, rule *Rule, val interface{}) (interface{}, bool) {
+	switch field.Type {
+	case "number":
+		num, ok := val.(float64)
+		if !ok {
+			errs.add(field, "type", "kolom '%s' harus berupa angka", field.Label)
+			return nil, false
+		}
+		if rule.Integer && num != math.Trunc(num) {
+			errs.add(field, "integer", "kolom '%s' harus bilangan bulat", field.Label)
+		}
+		if rule.Min != nil && num < *rule.Min {
+			errs.add(field, "min", "kolom '%s' minimal %v", field.Label, *rule.Min)
+		}
+		if rule.Max != nil && num > *rule.Max {
+			errs.add(field, "max", "kolom '%s' maksimal %v", field.Label, *rule.Max)
+		}
+		return num, true
+
+	case "checkbox":
+		b, ok := toBool(val)
+		if !ok {
+			errs.add(field, "type", "kolom '%s' harus berupa ya/tidak", field.Label)
+			return nil, false
+		}
+		return b, true
+
+	case "date":
+		s, ok := val.(string)
+		if !ok {
+			errs.add(field, "type", "kolom '%s' harus berupa teks", field.Label)
+			return nil, false
+		}
+		d, err := time.ParseInLocation("2006-01-02", s, v.Now().Location())
+		if err != nil {
+			errs.add(field, "format", "kolom '%s' harus format tanggal YYYY-MM-DD", field.Label)
+			return nil, false
+		}
+		v.checkDateRange(errs, field, rule, d)
+		return s, true
+
+	case "datetime":
+		s, ok := val.(string)
+		if !ok {
+			errs.add(field, "type", "kolom '%s' harus berupa teks", field.Label)
+			return nil, false
+		}
+		t, err := parseDateTime(s, v.Now().Location())
+		if err != nil {
+			errs.add(field, "format", "kolom '%s' harus format waktu RFC3339, misal 2026-01-31T08:00:00+07:00", field.Label)
+			return nil, false
+		}
+		v.checkDateRange(errs, field, rule, t)
+		return t.Format(time.RFC3339), true
+
+	case "file":
+		id, ok := toID(val)
+		if !ok {
+			errs.add(field, "type", "kolom '%s' harus berisi ID file lampiran", field.Label)
+			return nil, false
+		}
+		if v.Resolver == nil {
+			return float64(id), true
+		}
+		usable, err := v.Resolver.AttachmentUsable(id, v.InstanceID, v.UserID)
+		if err != nil {
+			errs.add(field, "file", "file kolom '%s' gagal dicek: %v", field.Label, err)
+			return nil, false
+		}
+		if !usable {
+			errs.add(field, "file", "file #%d pada kolom '%s' tidak ditemukan atau bukan milik instance ini", id, field.Label)
+			return nil, false
+		}
+		return float64(id), true
+
+	default: // text, textarea, select
+		s, ok := val.(string)
+		if !ok {
+			errs.add(field, "type", "kolom '%s' harus berupa teks", field.Label)
+			return nil, false
+		}
+		length := len([]rune(s))
+		if rule.MinLength != nil && length < *rule.MinLength {
+			errs.add(field, "min_length", "kolom '%s' minimal %d karakter", field.Label, *rule.MinLength)
+		}
+		if rule.MaxLength != nil && length > *rule.MaxLength {
+			errs.add(field, "max_length", "kolom '%s' maksimal %d karakter", field.Label, *rule.MaxLength)
+		}
+		if rule.pattern != nil && !rule.pattern.MatchString(s) {
+			errs.add(field, "pattern", "format kolom '%s' tidak sesuai", field.Label)
+		}
+		if field.Type == "select" {
+			v.checkOption(errs, field, rule, s)
+		} else if len(rule.Options) > 0 && !contains(rule.Options, s) {
+			errs.add(field, "option", "nilai '%s' tidak ada dalam pilihan kolom '%s'", s, field.Label)
+		}
+		return s, true
+	}
+}
+
+// checkOption memastikan nilai select ada di pilihan statis atau pilihan dari template lain
+func (v *Validator) checkOption(errs *Errors, field entity.FieldDef, rule *Rule, s string) {
+	options := rule.Options
+	if rule.OptionsFrom != nil {
+		if v.Resolver == nil {
+			return
+		}
+		dynamic, err := v.Resolver.OptionValues(*rule.OptionsFrom)
+		if err != nil {
+			errs.add(field, "option", "pilihan kolom '%s' gagal diambil: %v", field.Label, err)
+			return
+		}
+		options = append(append([]string{}, options...), dynamic...)
+	}
+	if len(options) == 0 {
+		errs.add(field, "option", "kolom '%s' belum punya daftar pilihan", field.Label)
+		return
+	}
+	if !contains(options, s) {
+		errs.add(field, "option", "nilai '%s' tidak ada dalam pilihan kolom '%s'", s, field.Label)
+	}
+}
+
+func (v *Validator) checkDateRange(errs *Errors, field entity.FieldDef, rule *Rule, d time.Time) {
+	now := v.Now()
+	if rule.MinDate != "" {
+		if min, err := resolveDate(rule.MinDate, now); err == nil && d.Before(min) {
+			errs.add(field, "min_date", "kolom '%s' tidak boleh sebelum %s", field.Label, min.Format("2006-01-02"))
+		}
+	}
+	if rule.MaxDate != "" {
+		// max_date berlaku sampai akhir hari tersebut, supaya datetime di hari yang sama tetap lolos
+		if max, err := resolveDate(rule.MaxDate, now); err == nil && !d.Before(max.AddDate(0, 0, 1)) {
+			errs.add(field, "max_date", "kolom '%s' tidak boleh setelah %s", field.Label, max.Format("2006-01-02"))
+		}
+	}
+}
+
+func (v *Validator) checkCrossRules(errs *Errors, field entity.FieldDef, rule *Rule, input map[string]interface{}) {
+	for _, cr := range rule.Rules {
+		if cr.when != nil {
+			applies, err := cr.when.EvalBool(input)
+			if err != nil {
+				errs.add(field, "rule", "kondisi '%s' gagal dievaluasi: %v", cr.When, err)
+				continue
+			}
+			if !applies {
+				continue
+			}
+		}
+
+		ok, err := cr.assert.EvalBool(input)
+		if err != nil {
+			errs.add(field, "rule", "aturan '%s' gagal dievaluasi: %v", cr.Assert, err)
+			continue
+		}
+		if ok {
+			continue
+		}
+
+		msg := cr.Message
+		if msg == "" {
+			msg = fmt.Sprintf("kolom '%s' melanggar aturan: %s", field.Label, cr.Assert)
+			if cr.When != "" {
+				msg += " (jika " + cr.When + ")"
+			}
+		}
+		errs.add(field, "rule", "%s", msg)
+	}
+}
+
+func isEmpty(val interface{}) bool {
+	if val == nil {
+		return true
+	}
+	s, ok := val.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// FileRefs mengembalikan ID file lampiran yang dirujuk kolom bertipe file di input
+func FileRefs(input map[string]interface{}, fields []entity.FieldDef) []int64 {
+	var ids []int64
+	for _, f := range fields {
+		if f.Type != "file" {
+			continue
+		}
+		if id, ok := toID(input[f.Key]); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// toBool menerima true/false, 1/0, dan teks umum seperti "yes", "ya", "on"
+func toBool(val interface{}) (bool, bool) {
+	switch b := val.(type) {
+	case bool:
+		return b, true
+	case float64:
+		if b == 1 {
+			return true, true
+		}
+		if b == 0 {
+			return false, true
+		}
+	case string:
+		switch strings.ToLower(strings.TrimSpace(b)) {
+		case "true", "1", "yes", "ya", "y", "on":
+			return true, true
+		case "false", "0", "no", "tidak", "n", "off":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// toID menerima ID sebagai angka JSON atau teks angka
+func toID(val interface{}) (int64, bool) {
+	switch n := val.(type) {
+	case float64:
+		if n > 0 && n == math.Trunc(n) {
+			return int64(n), true
+		}
+	case string:
+		id, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+		if err == nil && id > 0 {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// parseDateTime menerima RFC3339 (dengan zona waktu). Waktu tanpa zona dianggap waktu lokal pabrik.
+func parseDateTime(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("format waktu tidak dikenal")
+}
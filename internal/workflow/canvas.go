@@ -0,0 +1,118 @@
+// Package workflow membaca canvas_config (node dan edge yang digambar di frontend)
+// menjadi graf tahapan produksi yang bisa dijalankan oleh server.
+//
+// Format canvas_config:
+//
+//	{
+//	  "nodes": [
+//	    {"id": "start", "type": "start"},
+//	    {"id": "mix", "type": "stage", "data": {"label": "Mixing", "template_id": 1}},
+//	    {"id": "oven", "data": {"label": "Oven", "template_id": 2}},
+//	    {"id": "end", "type": "end"}
+//	  ],
+//	  "edges": [
+//	    {"id": "e1", "source": "start", "target": "mix"},
+//	    {"id": "e2", "source": "mix", "target": "oven", "data": {"condition": "qc_result == 'pass'"}},
+//	    {"id": "e3", "source": "mix", "target": "rework", "data": {"default": true}},
+//	    {"id": "e4", "source": "oven", "target": "end"}
+//	  ]
+//	}
+//
+// Jika salah satu edge keluar dari sebuah node punya condition, node tersebut menjadi percabangan:
+// edge pertama yang condition-nya benar dipilih, atau edge default jika tidak ada yang cocok.
+// Tanpa condition, semua edge keluar diikuti.
+//
+// Node "fork" menjalankan semua cabang keluarnya bersamaan. Node "join" menunggu cabang
+// yang masuk sampai selesai: semuanya, atau sebanyak data.required (N dari M), baru
+// kemudian melanjutkan ke tahap berikutnya.
+//
+//	{"id": "split", "type": "fork"},
+//	{"id": "merge", "type": "join", "data": {"required": 2}}
+//
+// Node tanpa type tapi punya template_id dianggap stage. Properti lain (position, style, dll)
+// milik frontend dan diabaikan.
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Jenis node yang dikenali engine
+const (
+	NodeStart = "start"
+	NodeEnd   = "end"
+	NodeStage = "stage"
+	NodeFork  = "fork"
+	NodeJoin  = "join"
+)
+
+// Canvas adalah isi workflows.canvas_config
+type Canvas struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// Node adalah satu kotak di canvas
+type Node struct {
+	ID   string   `json:"id"`
+	Type string   `json:"type,omitempty"`
+	Data NodeData `json:"data"`
+}
+
+// NodeData adalah properti node yang dipakai server
+type NodeData struct {
+	Label      string `json:"label,omitempty"`
+	TemplateID int    `json:"template_id,omitempty"`
+	// Required hanya untuk node join: jumlah cabang masuk yang harus selesai (0 = semua)
+	Required int `json:"required,omitempty"`
+}
+
+// Edge adalah panah dari satu node ke node lain
+type Edge struct {
+	ID     string   `json:"id"`
+	Source string   `json:"source"`
+	Target string   `json:"target"`
+	Data   EdgeData `json:"data"`
+}
+
+// EdgeData adalah properti edge yang dipakai server
+type EdgeData struct {
+	Label string `json:"label,omitempty"`
+	// Condition adalah ekspresi (lihat package expr) terhadap data_payload instance yang selesai,
+	// ditambah variabel status. Contoh: "qc_result == 'pass'" atau "qc_result == 'fail'".
+	// Cabang hanya dievaluasi saat instance completed, jadi status selalu bernilai "completed".
+	Condition string `json:"condition,omitempty"`
+	// Default dipilih jika tidak ada condition lain yang cocok
+	Default bool `json:"default,omitempty"`
+	// Loop menandai panah balik yang memang disengaja (misal kembali ke tahap sebelumnya untuk rework).
+	// Siklus tanpa penanda ini dianggap kesalahan.
+	Loop bool `json:"loop,omitempty"`
+}
+
+// Kind mengembalikan jenis node setelah dinormalkan (start, end, stage, fork, join, atau type aslinya)
+func (n Node) Kind() string {
+	switch n.Type {
+	case NodeStart, NodeEnd, NodeStage, NodeFork, NodeJoin:
+		return n.Type
+	case "", "default":
+		if n.Data.TemplateID > 0 {
+			return NodeStage
+		}
+	}
+	return n.Type
+}
+
+// ParseCanvas membaca canvas_config. Isi kosong atau "{}" menghasilkan canvas tanpa node.
+func ParseCanvas(raw []byte) (*Canvas, error) {
+	canvas := &Canvas{}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return canvas, nil
+	}
+	if err := json.Unmarshal(raw, canvas); err != nil {
+		return nil, fmt.Errorf("canvas_config bukan JSON yang valid: %w", err)
+	}
+	return canvas, nil
+}
@@ -0,0 +1,278 @@
+package workflow
+
+import (
+	"fmt"
+	"pt-besq-core/internal/expr"
+	"strings"
+)
+
+// Problem adalah satu kesalahan di canvas. NodeID/EdgeID diisi supaya editor bisa menandai elemennya.
+type Problem struct {
+	NodeID  string `json:"node_id,omitempty"`
+	EdgeID  string `json:"edge_id,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problems adalah kumpulan kesalahan canvas. Semua kesalahan dikumpulkan sekaligus.
+type Problems []Problem
+
+func (p Problems) Error() string {
+	msgs := make([]string, 0, len(p))
+	for _, pr := range p {
+		msgs = append(msgs, pr.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (p *Problems) node(id, code, format string, args ...interface{}) {
+	*p = append(*p, Problem{NodeID: id, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p *Problems) edge(id, code, format string, args ...interface{}) {
+	*p = append(*p, Problem{EdgeID: id, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// Check memeriksa kelengkapan canvas sebelum disimpan. templateExists dipakai
+// untuk memastikan template_id di node stage benar-benar ada.
+// Canvas tanpa node sama sekali dianggap draft kosong dan lolos.
+func Check(canvas *Canvas, templateExists func(id int) bool) Problems {
+	var problems Problems
+	if len(canvas.Nodes) == 0 && len(canvas.Edges) == 0 {
+		return nil
+	}
+
+	// Node: id, jenis dan template
+	nodes := map[string]*Node{}
+	var starts, ends []string
+	for i := range canvas.Nodes {
+		n := &canvas.Nodes[i]
+		if n.ID == "" {
+			problems.node("", "missing_id", "node #%d tidak punya id", i+1)
+			continue
+		}
+		if _, dup := nodes[n.ID]; dup {
+			problems.node(n.ID, "duplicate_id", "id node '%s' dipakai lebih dari sekali", n.ID)
+			continue
+		}
+		nodes[n.ID] = n
+
+		switch n.Kind() {
+		case NodeStart:
+			starts = append(starts, n.ID)
+		case NodeEnd:
+			ends = append(ends, n.ID)
+		case NodeStage:
+			if n.Data.TemplateID <= 0 {
+				problems.node(n.ID, "missing_template", "stage '%s' belum dipilih template-nya", nodeName(n))
+			} else if templateExists != nil && !templateExists(n.Data.TemplateID) {
+				problems.node(n.ID, "unknown_template", "stage '%s' memakai template %d yang tidak ada", nodeName(n), n.Data.TemplateID)
+			}
+		case NodeFork, NodeJoin:
+		default:
+			problems.node(n.ID, "unknown_type", "node '%s' memakai jenis '%s' yang tidak dikenal", nodeName(n), n.Type)
+		}
+	}
+	if len(starts) == 0 {
+		problems.node("", "missing_start", "workflow belum punya node start")
+	}
+	if len(ends) == 0 {
+		problems.node("", "missing_end", "workflow belum punya node end")
+	}
+
+	// Edge: harus menghubungkan dua node yang ada
+	out := map[string][]Edge{}
+	in := map[string][]Edge{}
+	edgeIDs := map[string]bool{}
+	for i, e := range canvas.Edges {
+		label := e.ID
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+		}
+		if e.ID != "" {
+			if edgeIDs[e.ID] {
+				problems.edge(e.ID, "duplicate_id", "id edge '%s' dipakai lebih dari sekali", e.ID)
+			}
+			edgeIDs[e.ID] = true
+		}
+		if nodes[e.Source] == nil || nodes[e.Target] == nil {
+			problems.edge(e.ID, "dangling_edge", "edge %s tidak terhubung ke node yang ada (%s -> %s)", label, e.Source, e.Target)
+			continue
+		}
+		if e.Source == e.Target {
+			problems.edge(e.ID, "self_loop", "edge %s menghubungkan node '%s' ke dirinya sendiri", label, e.Source)
+			continue
+		}
+		if nodes[e.Source].Kind() == NodeEnd {
+			problems.edge(e.ID, "edge_from_end", "edge %s keluar dari node end", label)
+		}
+		if nodes[e.Target].Kind() == NodeStart {
+			problems.edge(e.ID, "edge_to_start", "edge %s masuk ke node start", label)
+		}
+		if e.Data.Condition != "" {
+			if _, err := expr.Parse(e.Data.Condition); err != nil {
+				problems.edge(e.ID, "invalid_condition", "condition edge %s tidak valid: %v", label, err)
+			}
+			switch nodes[e.Source].Kind() {
+			case NodeStart:
+				problems.edge(e.ID, "condition_on_start", "edge %s keluar dari node start dan tidak boleh punya condition", label)
+			case NodeFork, NodeJoin:
+				problems.edge(e.ID, "condition_on_parallel", "edge %s keluar dari node %s dan tidak boleh punya condition", label, nodes[e.Source].Kind())
+			}
+		}
+		out[e.Source] = append(out[e.Source], e)
+		in[e.Target] = append(in[e.Target], e)
+	}
+
+	// Fork dan join harus benar-benar menggabungkan/memecah lebih dari satu cabang
+	for i := range canvas.Nodes {
+		n := &canvas.Nodes[i]
+		if n.ID == "" || nodes[n.ID] != n {
+			continue
+		}
+		switch n.Kind() {
+		case NodeFork:
+			if len(out[n.ID]) < 2 {
+				problems.node(n.ID, "fork_branches", "fork '%s' harus punya minimal dua cabang keluar", nodeName(n))
+			}
+		case NodeJoin:
+			if len(in[n.ID]) < 2 {
+				problems.node(n.ID, "join_branches", "join '%s' harus punya minimal dua cabang masuk", nodeName(n))
+			}
+			if n.Data.Required < 0 || n.Data.Required > len(in[n.ID]) {
+				problems.node(n.ID, "join_required", "join '%s' menunggu %d cabang padahal hanya ada %d cabang masuk", nodeName(n), n.Data.Required, len(in[n.ID]))
+			}
+		}
+	}
+
+	// Percabangan: paling banyak satu edge default per node
+	for i := range canvas.Nodes {
+		n := &canvas.Nodes[i]
+		if n.ID == "" || nodes[n.ID] != n {
+			continue
+		}
+		conditional, defaults, plain := 0, 0, 0
+		for _, e := range out[n.ID] {
+			switch {
+			case e.Data.Default:
+				defaults++
+			case e.Data.Condition == "":
+				plain++
+			}
+			if e.Data.Condition != "" {
+				conditional++
+			}
+		}
+		if conditional == 0 {
+			if defaults > 0 {
+				problems.node(n.ID, "default_without_branch", "node '%s' punya edge default tetapi tidak ada edge dengan condition", nodeName(n))
+			}
+			continue
+		}
+		if defaults > 1 || (defaults == 0 && plain > 1) || (defaults == 1 && plain > 0) {
+			problems.node(n.ID, "multiple_default", "percabangan di node '%s' hanya boleh punya satu edge default (edge tanpa condition dianggap default)", nodeName(n))
+		}
+	}
+
+	// Semua node harus bisa dicapai dari start dan bisa mencapai end
+	if len(starts) > 0 {
+		reached := walk(starts, out, func(e Edge) string { return e.Target })
+		for i := range canvas.Nodes {
+			n := &canvas.Nodes[i]
+			if n.ID != "" && nodes[n.ID] == n && !reached[n.ID] {
+				problems.node(n.ID, "unreachable", "node '%s' tidak bisa dicapai dari start", nodeName(n))
+			}
+		}
+	}
+	if len(ends) > 0 {
+		reaches := walk(ends, in, func(e Edge) string { return e.Source })
+		for i := range canvas.Nodes {
+			n := &canvas.Nodes[i]
+			if n.ID != "" && nodes[n.ID] == n && !reaches[n.ID] {
+				problems.node(n.ID, "dead_end", "node '%s' tidak punya jalur ke end", nodeName(n))
+			}
+		}
+	}
+
+	// Siklus hanya boleh lewat edge yang ditandai loop
+	for _, e := range findCycles(canvas.Nodes, out) {
+		problems.edge(e.ID, "cycle", "edge %s -> %s membentuk siklus; tandai sebagai loop jika memang disengaja", e.Source, e.Target)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// walk menelusuri graf dari node awal mengikuti edges dan mengembalikan semua node yang dikunjungi
+func walk(from []string, edges map[string][]Edge, next func(Edge) string) map[string]bool {
+	visited := map[string]bool{}
+	queue := append([]string{}, from...)
+	for _, id := range from {
+		visited[id] = true
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range edges[id] {
+			target := next(e)
+			if !visited[target] {
+				visited[target] = true
+				queue = append(queue, target)
+			}
+		}
+	}
+	return visited
+}
+
+// findCycles mencari edge balik (DFS) dengan mengabaikan edge yang ditandai loop
+func findCycles(nodes []Node, out map[string][]Edge) []Edge {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	var back []Edge
+
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = visiting
+		for _, e := range out[id] {
+			if e.Data.Loop {
+				continue
+			}
+			switch state[e.Target] {
+			case unvisited:
+				visit(e.Target)
+			case visiting:
+				back = append(back, e)
+			}
+		}
+		state[id] = done
+	}
+	for _, n := range nodes {
+		if n.ID != "" && state[n.ID] == unvisited {
+			visit(n.ID)
+		}
+	}
+	return back
+}
+
+func edgeName(e Edge) string {
+	if e.Data.Label != "" {
+		return fmt.Sprintf("'%s'", e.Data.Label)
+	}
+	if e.ID != "" {
+		return e.ID
+	}
+	return e.Source + " -> " + e.Target
+}
+
+func nodeName(n *Node) string {
+	if n.Data.Label != "" {
+		return n.Data.Label
+	}
+	return n.ID
+}
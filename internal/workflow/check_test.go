@@ -0,0 +1,124 @@
+package workflow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	// stage memakai template 1-5; template 9 tidak ada
+	templateExists := func(id int) bool { return id >= 1 && id <= 5 }
+
+	tests := []struct {
+		name   string
+		canvas string
+		want   []string // "code@node_id" atau "code@edge_id", sesuai urutan
+	}{
+		{"draft kosong", `{}`, nil},
+		{"contoh QC dengan loop rework", qcCanvas, nil},
+		{"tanpa start dan end", `{
+			"nodes": [{"id": "a", "data": {"template_id": 1}}]
+		}`, []string{"missing_start@", "missing_end@"}},
+		{"node tidak valid", `{
+			"nodes": [{"id": "s", "type": "start"}, {"type": "end"}, {"id": "s", "type": "end"},
+			          {"id": "a", "type": "stage"}, {"id": "b", "data": {"template_id": 9}}, {"id": "n", "type": "note"}]
+		}`, []string{"missing_id@", "duplicate_id@s", "missing_template@a", "unknown_template@b", "unknown_type@n",
+			"missing_end@", "unreachable@a", "unreachable@b", "unreachable@n"}},
+		{"edge tidak valid", `{
+			"nodes": [{"id": "s", "type": "start"}, {"id": "a", "data": {"template_id": 1}}, {"id": "e", "type": "end"}],
+			"edges": [
+				{"id": "e1", "source": "s", "target": "a"},
+				{"id": "e1", "source": "a", "target": "e"},
+				{"id": "e3", "source": "a", "target": "x"},
+				{"id": "e4", "source": "a", "target": "a"},
+				{"id": "e5", "source": "e", "target": "s"}
+			]
+		}`, []string{"duplicate_id@e1", "dangling_edge@e3", "self_loop@e4", "edge_from_end@e5", "edge_to_start@e5", "cycle@e5"}},
+		{"condition tidak valid dan di tempat yang salah", `{
+			"nodes": [{"id": "s", "type": "start"}, {"id": "a", "data": {"template_id": 1}}, {"id": "e", "type": "end"}],
+			"edges": [
+				{"id": "e1", "source": "s", "target": "a", "data": {"condition": "x > 1"}},
+				{"id": "e2", "source": "a", "target": "e", "data": {"condition": "x >"}}
+			]
+		}`, []string{"condition_on_start@e1", "invalid_condition@e2"}},
+		{"percabangan dengan dua default", `{
+			"nodes": [{"id": "s", "type": "start"}, {"id": "a", "data": {"template_id": 1}},
+			          {"id": "b", "data": {"template_id": 2}}, {"id": "c", "data": {"template_id": 3}},
+			          {"id": "d", "data": {"template_id": 4}}, {"id": "e", "type": "end"}],
+			"edges": [
+				{"source": "s", "target": "a"},
+				{"source": "a", "target": "b", "data": {"condition": "x > 1"}},
+				{"source": "a", "target": "c"},
+				{"source": "a", "target": "d"},
+				{"source": "b", "target": "e"}, {"source": "c", "target": "e"}, {"source": "d", "target": "e"}
+			]
+		}`, []string{"multiple_default@a"}},
+		{"default tanpa percabangan", `{
+			"nodes": [{"id": "s", "type": "start"}, {"id": "a", "data": {"template_id": 1}}, {"id": "e", "type": "end"}],
+			"edges": [{"source": "s", "target": "a", "data": {"default": true}}, {"source": "a", "target": "e"}]
+		}`, []string{"default_without_branch@s"}},
+		{"node buntu dan tidak tercapai", `{
+			"nodes": [{"id": "s", "type": "start"}, {"id": "a", "data": {"template_id": 1}},
+			          {"id": "buntu", "data": {"template_id": 2}}, {"id": "yatim", "data": {"template_id": 3}},
+			          {"id": "e", "type": "end"}],
+			"edges": [
+				{"source": "s", "target": "a"},
+				{"source": "a", "target": "e", "data": {"condition": "ok == true"}},
+				{"source": "a", "target": "buntu", "data": {"default": true}},
+				{"source": "yatim", "target": "e"}
+			]
+		}`, []string{"unreachable@yatim", "dead_end@buntu"}},
+		{"siklus tanpa penanda loop", `{
+			"nodes": [{"id": "s", "type": "start"}, {"id": "a", "data": {"template_id": 1}},
+			          {"id": "b", "data": {"template_id": 2}}, {"id": "e", "type": "end"}],
+			"edges": [
+				{"id": "e1", "source": "s", "target": "a"},
+				{"id": "e2", "source": "a", "target": "b"},
+				{"id": "e3", "source": "b", "target": "a", "data": {"condition": "ulang == true"}},
+				{"id": "e4", "source": "b", "target": "e", "data": {"default": true}}
+			]
+		}`, []string{"cycle@e3"}},
+		{"siklus yang tidak pernah keluar", `{
+			"nodes": [{"id": "s", "type": "start"}, {"id": "a", "data": {"template_id": 1}},
+			          {"id": "b", "data": {"template_id": 2}}, {"id": "e", "type": "end"}],
+			"edges": [
+				{"id": "e1", "source": "s", "target": "a"},
+				{"id": "e2", "source": "a", "target": "b"},
+				{"id": "e3", "source": "b", "target": "a", "data": {"loop": true}}
+			]
+		}`, []string{"unreachable@e", "dead_end@s", "dead_end@a", "dead_end@b"}},
+		{"fork dan join yang benar", `{
+			"nodes": [{"id": "s", "type": "start"}, {"id": "f", "type": "fork"},
+			          {"id": "a", "data": {"template_id": 1}}, {"id": "b", "data": {"template_id": 2}},
+			          {"id": "j", "type": "join", "data": {"required": 1}}, {"id": "e", "type": "end"}],
+			"edges": [
+				{"source": "s", "target": "f"}, {"source": "f", "target": "a"}, {"source": "f", "target": "b"},
+				{"source": "a", "target": "j"}, {"source": "b", "target": "j"}, {"source": "j", "target": "e"}
+			]
+		}`, nil},
+		{"fork dan join dengan satu cabang", `{
+			"nodes": [{"id": "s", "type": "start"}, {"id": "f", "type": "fork"},
+			          {"id": "a", "data": {"template_id": 1}},
+			          {"id": "j", "type": "join", "data": {"required": 3}}, {"id": "e", "type": "end"}],
+			"edges": [
+				{"id": "e1", "source": "s", "target": "f"}, {"id": "e2", "source": "f", "target": "a"},
+				{"id": "e3", "source": "a", "target": "j"}, {"id": "e4", "source": "j", "target": "e", "data": {"condition": "x > 1"}}
+			]
+		}`, []string{"condition_on_parallel@e4", "fork_branches@f", "join_branches@j", "join_required@j"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canvas, err := ParseCanvas([]byte(tt.canvas))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range Check(canvas, templateExists) {
+				got = append(got, p.Code+"@"+p.NodeID+p.EdgeID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Check = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package workflow
+
+import "fmt"
+
+// Diff adalah perbedaan antara dua canvas, dilihat dari sisi yang dipakai engine
+// (posisi node di layar diabaikan)
+type Diff struct {
+	AddedNodes   []string `json:"added_nodes"`
+	RemovedNodes []string `json:"removed_nodes"`
+	ChangedNodes []string `json:"changed_nodes"`
+	AddedEdges   []string `json:"added_edges"`
+	RemovedEdges []string `json:"removed_edges"`
+	ChangedEdges []string `json:"changed_edges"`
+}
+
+// Empty bernilai true jika kedua canvas sama secara alur
+func (d Diff) Empty() bool {
+	return len(d.AddedNodes)+len(d.RemovedNodes)+len(d.ChangedNodes)+
+		len(d.AddedEdges)+len(d.RemovedEdges)+len(d.ChangedEdges) == 0
+}
+
+// Compare membandingkan canvas lama dan baru. Node dicocokkan lewat id,
+// edge lewat id (atau "source->target" jika edge tidak punya id).
+func Compare(old, new *Canvas) Diff {
+	d := Diff{
+		AddedNodes: []string{}, RemovedNodes: []string{}, ChangedNodes: []string{},
+		AddedEdges: []string{}, RemovedEdges: []string{}, ChangedEdges: []string{},
+	}
+
+	oldNodes := map[string]Node{}
+	for _, n := range old.Nodes {
+		oldNodes[n.ID] = n
+	}
+	newNodes := map[string]bool{}
+	for _, n := range new.Nodes {
+		newNodes[n.ID] = true
+		prev, ok := oldNodes[n.ID]
+		switch {
+		case !ok:
+			d.AddedNodes = append(d.AddedNodes, n.ID)
+		case prev.Kind() != n.Kind() || prev.Data != n.Data:
+			d.ChangedNodes = append(d.ChangedNodes, n.ID)
+		}
+	}
+	for _, n := range old.Nodes {
+		if !newNodes[n.ID] {
+			d.RemovedNodes = append(d.RemovedNodes, n.ID)
+		}
+	}
+
+	oldEdges := map[string]Edge{}
+	for _, e := range old.Edges {
+		oldEdges[edgeKey(e)] = e
+	}
+	newEdges := map[string]bool{}
+	for _, e := range new.Edges {
+		key := edgeKey(e)
+		newEdges[key] = true
+		prev, ok := oldEdges[key]
+		switch {
+		case !ok:
+			d.AddedEdges = append(d.AddedEdges, key)
+		case prev.Source != e.Source || prev.Target != e.Target || prev.Data != e.Data:
+			d.ChangedEdges = append(d.ChangedEdges, key)
+		}
+	}
+	for _, e := range old.Edges {
+		if key := edgeKey(e); !newEdges[key] {
+			d.RemovedEdges = append(d.RemovedEdges, key)
+		}
+	}
+	return d
+}
+
+func edgeKey(e Edge) string {
+	if e.ID != "" {
+		return e.ID
+	}
+	return fmt.Sprintf("%s->%s", e.Source, e.Target)
+}
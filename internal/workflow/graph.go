@@ -0,0 +1,291 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"pt-besq-core/internal/expr"
+)
+
+// ErrNoMatchingBranch dikembalikan jika tidak ada edge percabangan yang cocok dan tidak ada default
+var ErrNoMatchingBranch = errors.New("no matching workflow branch")
+
+// Graph adalah canvas yang sudah diindeks untuk ditelusuri
+type Graph struct {
+	nodes map[string]*Node
+	order []string // urutan node sesuai canvas, supaya hasil penelusuran stabil
+	out   map[string][]Edge
+	in    map[string][]Edge
+}
+
+// Parse membaca canvas_config dan membangun grafnya.
+// Parse hanya menolak struktur yang tidak bisa diindeks (JSON rusak, id node kosong/ganda);
+// pemeriksaan kelengkapan graf dilakukan terpisah.
+func Parse(raw []byte) (*Graph, error) {
+	canvas, err := ParseCanvas(raw)
+	if err != nil {
+		return nil, err
+	}
+	return NewGraph(canvas)
+}
+
+// NewGraph membangun graf dari canvas yang sudah di-decode
+func NewGraph(canvas *Canvas) (*Graph, error) {
+	g := &Graph{
+		nodes: make(map[string]*Node, len(canvas.Nodes)),
+		out:   map[string][]Edge{},
+		in:    map[string][]Edge{},
+	}
+	for i := range canvas.Nodes {
+		n := &canvas.Nodes[i]
+		if n.ID == "" {
+			return nil, fmt.Errorf("node #%d tidak punya id", i+1)
+		}
+		if _, dup := g.nodes[n.ID]; dup {
+			return nil, fmt.Errorf("id node '%s' dipakai lebih dari sekali", n.ID)
+		}
+		g.nodes[n.ID] = n
+		g.order = append(g.order, n.ID)
+	}
+	for _, e := range canvas.Edges {
+		g.out[e.Source] = append(g.out[e.Source], e)
+		g.in[e.Target] = append(g.in[e.Target], e)
+	}
+	return g, nil
+}
+
+// Node mengambil node berdasarkan id (nil jika tidak ada)
+func (g *Graph) Node(id string) *Node {
+	return g.nodes[id]
+}
+
+// Nodes mengembalikan semua node sesuai urutan di canvas
+func (g *Graph) Nodes() []*Node {
+	out := make([]*Node, 0, len(g.order))
+	for _, id := range g.order {
+		out = append(out, g.nodes[id])
+	}
+	return out
+}
+
+// Outgoing mengembalikan edge yang keluar dari sebuah node
+func (g *Graph) Outgoing(id string) []Edge {
+	return g.out[id]
+}
+
+// Incoming mengembalikan edge yang masuk ke sebuah node
+func (g *Graph) Incoming(id string) []Edge {
+	return g.in[id]
+}
+
+// Stages mengembalikan semua node stage (yang terikat ke template)
+func (g *Graph) Stages() []*Node {
+	var stages []*Node
+	for _, n := range g.Nodes() {
+		if n.Kind() == NodeStage {
+			stages = append(stages, n)
+		}
+	}
+	return stages
+}
+
+// HasStages bernilai false untuk workflow lama yang canvas-nya masih kosong
+func (g *Graph) HasStages() bool {
+	return len(g.Stages()) > 0
+}
+
+// EntryNodes mengembalikan stage yang boleh dipakai untuk memulai instance baru:
+// stage pertama setelah node start, atau (jika tidak ada start) stage tanpa panah masuk.
+func (g *Graph) EntryNodes() []*Node {
+	var starts []string
+	for _, n := range g.Nodes() {
+		if n.Kind() == NodeStart {
+			starts = append(starts, n.ID)
+		}
+	}
+	if len(starts) > 0 {
+		return g.nextStages(starts)
+	}
+
+	var entries []*Node
+	for _, n := range g.Stages() {
+		if len(g.in[n.ID]) == 0 {
+			entries = append(entries, n)
+		}
+	}
+	return entries
+}
+
+// IsEntry mengecek apakah node boleh dipakai sebagai awal instance
+func (g *Graph) IsEntry(id string) bool {
+	for _, n := range g.EntryNodes() {
+		if n.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Next mengembalikan semua stage yang mungkin dicapai setelah sebuah node selesai,
+// tanpa mengevaluasi condition. Node selain stage (misal penghubung) dilewati sampai ketemu stage atau end.
+func (g *Graph) Next(id string) []*Node {
+	stages, _ := g.advance([]string{id})
+	return stages
+}
+
+// Arrival adalah cabang yang sampai di node join lewat edge tertentu
+type Arrival struct {
+	Join    *Node
+	EdgeKey string // id edge masuk (atau "source->target"), unik per cabang
+}
+
+// Route menentukan stage berikutnya setelah sebuah node selesai dengan mengevaluasi
+// condition di edge terhadap vars (lihat BranchVars). Di node percabangan hanya satu edge
+// yang diikuti; jika tidak ada yang cocok dan tidak ada default, error membungkus ErrNoMatchingBranch.
+// Penelusuran berhenti di node join; cabang yang sampai di sana dikembalikan sebagai arrivals
+// dan pemanggil yang memutuskan kapan join dilepas (lanjutkan dengan Route dari node join).
+func (g *Graph) Route(id string, vars map[string]interface{}) ([]*Node, []Arrival, error) {
+	w, err := g.traverse([]string{id}, func(from string) ([]Edge, error) {
+		return g.branch(from, vars)
+	})
+	return w.stages, w.arrivals, err
+}
+
+// JoinQuorum mengembalikan jumlah cabang masuk yang harus selesai sebelum join dilepas
+func (g *Graph) JoinQuorum(id string) int {
+	inbound := len(g.in[id])
+	n := g.nodes[id]
+	if n != nil && n.Data.Required > 0 && n.Data.Required < inbound {
+		return n.Data.Required
+	}
+	return inbound
+}
+
+// BranchVars menyusun variabel untuk condition edge: isi data_payload ditambah status instance
+// (selalu "completed", karena engine hanya maju saat stage selesai).
+// Key "status" di payload tertimpa oleh status instance.
+func BranchVars(payload map[string]interface{}, status string) map[string]interface{} {
+	vars := make(map[string]interface{}, len(payload)+1)
+	for k, v := range payload {
+		vars[k] = v
+	}
+	vars["status"] = status
+	return vars
+}
+
+// IsBranch bernilai true jika salah satu edge keluar dari node punya condition
+func (g *Graph) IsBranch(id string) bool {
+	for _, e := range g.out[id] {
+		if e.Data.Condition != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// branch memilih edge keluar yang diikuti dari sebuah node. Node tanpa condition
+// mengikuti semua edge-nya. Di node percabangan, edge ber-condition dievaluasi sesuai
+// urutan di canvas dan yang pertama bernilai true dipilih; jika tidak ada, dipakai edge
+// default (ditandai default atau tanpa condition).
+func (g *Graph) branch(id string, vars map[string]interface{}) ([]Edge, error) {
+	edges := g.out[id]
+	if !g.IsBranch(id) {
+		return edges, nil
+	}
+
+	var fallback []Edge
+	for _, e := range edges {
+		if e.Data.Condition == "" {
+			fallback = append(fallback, e)
+			continue
+		}
+		cond, err := expr.Parse(e.Data.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("condition edge %s tidak valid: %w", edgeName(e), err)
+		}
+		ok, err := cond.EvalBool(vars)
+		if err != nil {
+			return nil, fmt.Errorf("condition edge %s gagal dievaluasi: %w", edgeName(e), err)
+		}
+		if ok {
+			return []Edge{e}, nil
+		}
+	}
+	for _, e := range edges {
+		if e.Data.Default {
+			return []Edge{e}, nil
+		}
+	}
+	if len(fallback) > 0 {
+		return fallback[:1], nil
+	}
+	return nil, fmt.Errorf("%w: tidak ada condition yang cocok setelah node '%s' dan tidak ada cabang default", ErrNoMatchingBranch, nodeName(g.nodes[id]))
+}
+
+// nextStages menelusuri panah keluar dari node-node asal sampai menemukan stage
+func (g *Graph) nextStages(from []string) []*Node {
+	stages, _ := g.advance(from)
+	return stages
+}
+
+// advance menelusuri semua panah keluar dari node-node asal sampai menemukan stage.
+// reachedEnd bernilai true jika salah satu jalur berakhir di node end. Node join tidak dilewati.
+func (g *Graph) advance(from []string) (stages []*Node, reachedEnd bool) {
+	w, _ := g.traverse(from, func(id string) ([]Edge, error) {
+		return g.out[id], nil
+	})
+	return w.stages, w.reachedEnd
+}
+
+// walkResult adalah hasil satu penelusuran graf
+type walkResult struct {
+	stages     []*Node
+	arrivals   []Arrival
+	reachedEnd bool
+}
+
+// traverse menelusuri edge yang dipilih follow dari node-node asal sampai menemukan stage, join atau end
+func (g *Graph) traverse(from []string, follow func(id string) ([]Edge, error)) (walkResult, error) {
+	var w walkResult
+	found := map[string]bool{}
+	visited := map[string]bool{}
+	queue := append([]string{}, from...)
+	for _, id := range from {
+		visited[id] = true
+	}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		edges, err := follow(id)
+		if err != nil {
+			return walkResult{}, err
+		}
+		for _, e := range edges {
+			target := g.nodes[e.Target]
+			if target == nil {
+				continue
+			}
+			// Join dicatat per edge masuk, jadi dua cabang yang bertemu di join yang sama tetap terhitung dua
+			if target.Kind() == NodeJoin {
+				w.arrivals = append(w.arrivals, Arrival{Join: target, EdgeKey: edgeKey(e)})
+				continue
+			}
+			if visited[target.ID] {
+				continue
+			}
+			visited[target.ID] = true
+			switch target.Kind() {
+			case NodeStage:
+				if !found[target.ID] {
+					found[target.ID] = true
+					w.stages = append(w.stages, target)
+				}
+			case NodeEnd:
+				w.reachedEnd = true
+			default:
+				queue = append(queue, target.ID)
+			}
+		}
+	}
+	return w, nil
+}
@@ -0,0 +1,318 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mustParse membaca canvas contoh untuk test
+func mustParse(t *testing.T, raw string) *Graph {
+	t.Helper()
+	g, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return g
+}
+
+func nodeIDs(nodes []*Node) []string {
+	ids := []string{}
+	for _, n := range nodes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+// qcCanvas: start -> mix -> oven jika lolos QC, scrap jika dibuang, rework jika tidak -> end.
+// Canvas ini juga lolos Check, jadi dipakai bersama oleh test graph, simulate dan check.
+const qcCanvas = `{
+	"nodes": [
+		{"id": "start", "type": "start"},
+		{"id": "mix", "data": {"label": "Mixing", "template_id": 1}},
+		{"id": "oven", "type": "stage", "data": {"label": "Oven", "template_id": 2}},
+		{"id": "rework", "data": {"label": "Rework", "template_id": 3}},
+		{"id": "scrap", "data": {"label": "Scrap", "template_id": 4}},
+		{"id": "end", "type": "end"}
+	],
+	"edges": [
+		{"id": "e1", "source": "start", "target": "mix"},
+		{"id": "e3", "source": "mix", "target": "oven", "data": {"condition": "qc_result == 'pass'"}},
+		{"id": "e4", "source": "mix", "target": "scrap", "data": {"condition": "qc_result == 'scrap'"}},
+		{"id": "e5", "source": "mix", "target": "rework", "data": {"default": true}},
+		{"id": "e6", "source": "oven", "target": "end"},
+		{"id": "e7", "source": "rework", "target": "mix", "data": {"loop": true}},
+		{"id": "e8", "source": "scrap", "target": "end"}
+	]
+}`
+
+func TestParseGraph(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+		stages  int
+	}{
+		{"kosong", "", "", 0},
+		{"null", "null", "", 0},
+		{"objek kosong", "{}", "", 0},
+		{"contoh QC", qcCanvas, "", 4},
+		{"JSON rusak", `{"nodes": [}`, "bukan JSON yang valid", 0},
+		{"id kosong", `{"nodes": [{"type": "start"}]}`, "node #1 tidak punya id", 0},
+		{"id ganda", `{"nodes": [{"id": "a"}, {"id": "a"}]}`, "'a' dipakai lebih dari sekali", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := Parse([]byte(tt.raw))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse err = %v, want memuat %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := len(g.Stages()); got != tt.stages {
+				t.Errorf("Stages = %d, want %d", got, tt.stages)
+			}
+			if g.HasStages() != (tt.stages > 0) {
+				t.Errorf("HasStages = %v", g.HasStages())
+			}
+		})
+	}
+}
+
+func TestNodeKind(t *testing.T) {
+	tests := []struct {
+		node Node
+		want string
+	}{
+		{Node{Type: "start"}, NodeStart},
+		{Node{Type: "end"}, NodeEnd},
+		{Node{Type: "fork"}, NodeFork},
+		{Node{Type: "join", Data: NodeData{Required: 2}}, NodeJoin},
+		{Node{Data: NodeData{TemplateID: 1}}, NodeStage},
+		{Node{Type: "default", Data: NodeData{TemplateID: 1}}, NodeStage},
+		{Node{Type: "default"}, "default"},
+		{Node{}, ""},
+		{Node{Type: "note", Data: NodeData{TemplateID: 1}}, "note"},
+	}
+	for _, tt := range tests {
+		if got := tt.node.Kind(); got != tt.want {
+			t.Errorf("Kind(%+v) = %q, want %q", tt.node, got, tt.want)
+		}
+	}
+}
+
+func TestEntryNodes(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []string
+	}{
+		{"setelah start", qcCanvas, []string{"mix"}},
+		{"start lewat penghubung", `{
+			"nodes": [{"id": "s", "type": "start"}, {"id": "c", "type": "connector"},
+			          {"id": "a", "data": {"template_id": 1}}, {"id": "b", "data": {"template_id": 2}}],
+			"edges": [{"source": "s", "target": "c"}, {"source": "c", "target": "a"}, {"source": "c", "target": "b"}]
+		}`, []string{"a", "b"}},
+		{"tanpa start: stage tanpa panah masuk", `{
+			"nodes": [{"id": "a", "data": {"template_id": 1}}, {"id": "b", "data": {"template_id": 2}},
+			          {"id": "c", "data": {"template_id": 3}}],
+			"edges": [{"source": "a", "target": "b"}]
+		}`, []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := mustParse(t, tt.raw)
+			if got := nodeIDs(g.EntryNodes()); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("EntryNodes = %v, want %v", got, tt.want)
+			}
+			for _, id := range tt.want {
+				if !g.IsEntry(id) {
+					t.Errorf("IsEntry(%s) = false", id)
+				}
+			}
+		})
+	}
+	if mustParse(t, qcCanvas).IsEntry("oven") {
+		t.Error("IsEntry(oven) = true")
+	}
+}
+
+func TestNext(t *testing.T) {
+	g := mustParse(t, qcCanvas)
+	tests := []struct {
+		from string
+		want []string
+	}{
+		{"mix", []string{"oven", "scrap", "rework"}}, // condition tidak dievaluasi
+		{"oven", []string{}},                         // hanya end
+		{"rework", []string{"mix"}},
+		{"tidak-ada", []string{}},
+	}
+	for _, tt := range tests {
+		if got := nodeIDs(g.Next(tt.from)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Next(%s) = %v, want %v", tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	g := mustParse(t, qcCanvas)
+	tests := []struct {
+		name string
+		vars map[string]interface{}
+		want []string
+	}{
+		{"lolos", map[string]interface{}{"qc_result": "pass"}, []string{"oven"}},
+		{"condition kedua", map[string]interface{}{"qc_result": "scrap"}, []string{"scrap"}},
+		{"default", map[string]interface{}{"qc_result": "fail"}, []string{"rework"}},
+		{"kosong ke default", map[string]interface{}{}, []string{"rework"}},
+		{"tipe berbeda tidak pernah sama", map[string]interface{}{"qc_result": 1.0}, []string{"rework"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stages, arrivals, err := g.Route("mix", BranchVars(tt.vars, "completed"))
+			if err != nil {
+				t.Fatalf("Route: %v", err)
+			}
+			if len(arrivals) != 0 {
+				t.Errorf("arrivals = %v", arrivals)
+			}
+			if got := nodeIDs(stages); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Route = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteBranchErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		edges   string
+		vars    map[string]interface{}
+		want    []string
+		wantErr string
+		noMatch bool
+	}{
+		{"tanpa default dan tidak cocok",
+			`[{"source": "a", "target": "b", "data": {"condition": "x > 1"}}]`,
+			map[string]interface{}{"x": 0.0}, nil, "tidak ada condition yang cocok setelah node 'A'", true},
+		{"edge tanpa condition menjadi default",
+			`[{"source": "a", "target": "b", "data": {"condition": "x > 1"}}, {"source": "a", "target": "c"}]`,
+			map[string]interface{}{"x": 0.0}, []string{"c"}, "", false},
+		{"condition rusak",
+			`[{"id": "e9", "source": "a", "target": "b", "data": {"condition": "x >"}}]`,
+			nil, nil, "condition edge", false},
+		{"condition bukan boolean",
+			`[{"source": "a", "target": "b", "data": {"condition": "x + 1"}}]`,
+			map[string]interface{}{"x": 1.0}, nil, "gagal dievaluasi", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := mustParse(t, `{
+				"nodes": [{"id": "a", "data": {"label": "A", "template_id": 1}}, {"id": "b", "data": {"template_id": 2}},
+				          {"id": "c", "data": {"template_id": 3}}],
+				"edges": `+tt.edges+`}`)
+			stages, _, err := g.Route("a", tt.vars)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Route: %v", err)
+				}
+				if got := nodeIDs(stages); !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("Route = %v, want %v", got, tt.want)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Route err = %v, want memuat %q", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrNoMatchingBranch) != tt.noMatch {
+				t.Fatalf("errors.Is(ErrNoMatchingBranch) = %v", !tt.noMatch)
+			}
+		})
+	}
+}
+
+func TestRouteForkJoin(t *testing.T) {
+	g := mustParse(t, `{
+		"nodes": [
+			{"id": "mix", "data": {"template_id": 1}},
+			{"id": "fork", "type": "fork"},
+			{"id": "a", "data": {"template_id": 2}},
+			{"id": "b", "data": {"template_id": 3}},
+			{"id": "c", "data": {"template_id": 4}},
+			{"id": "join", "type": "join", "data": {"required": 2}},
+			{"id": "pack", "data": {"template_id": 5}}
+		],
+		"edges": [
+			{"source": "mix", "target": "fork"},
+			{"source": "fork", "target": "a"}, {"source": "fork", "target": "b"}, {"source": "fork", "target": "c"},
+			{"id": "ja", "source": "a", "target": "join"}, {"source": "b", "target": "join"}, {"source": "c", "target": "join"},
+			{"source": "join", "target": "pack"}
+		]
+	}`)
+
+	stages, arrivals, err := g.Route("mix", nil)
+	if err != nil || !reflect.DeepEqual(nodeIDs(stages), []string{"a", "b", "c"}) || len(arrivals) != 0 {
+		t.Fatalf("Route(mix) = %v, %v, %v", nodeIDs(stages), arrivals, err)
+	}
+
+	// Setiap cabang berhenti di join dengan kunci edge sendiri
+	keys := map[string]bool{}
+	for _, from := range []string{"a", "b"} {
+		stages, arrivals, err := g.Route(from, nil)
+		if err != nil || len(stages) != 0 || len(arrivals) != 1 || arrivals[0].Join.ID != "join" {
+			t.Fatalf("Route(%s) = %v, %v, %v", from, nodeIDs(stages), arrivals, err)
+		}
+		keys[arrivals[0].EdgeKey] = true
+	}
+	if len(keys) != 2 {
+		t.Fatalf("kunci edge join tidak unik: %v", keys)
+	}
+
+	if got := g.JoinQuorum("join"); got != 2 {
+		t.Errorf("JoinQuorum = %d, want 2", got)
+	}
+	stages, _, err = g.Route("join", nil)
+	if err != nil || !reflect.DeepEqual(nodeIDs(stages), []string{"pack"}) {
+		t.Fatalf("Route(join) = %v, %v", nodeIDs(stages), err)
+	}
+}
+
+func TestJoinQuorum(t *testing.T) {
+	canvas := func(required int) string {
+		return fmt.Sprintf(`{"nodes": [{"id": "a"}, {"id": "b"}, {"id": "c"}, {"id": "j", "type": "join", "data": {"required": %d}}],
+			"edges": [{"source": "a", "target": "j"}, {"source": "b", "target": "j"}, {"source": "c", "target": "j"}]}`, required)
+	}
+	tests := []struct {
+		required int
+		want     int
+	}{
+		{0, 3}, // semua cabang
+		{1, 1},
+		{2, 2},
+		{3, 3},
+		{5, 3}, // melebihi cabang masuk: semua cabang
+	}
+	for _, tt := range tests {
+		if got := mustParse(t, canvas(tt.required)).JoinQuorum("j"); got != tt.want {
+			t.Errorf("required %d: JoinQuorum = %d, want %d", tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestBranchVars(t *testing.T) {
+	payload := map[string]interface{}{"qc_result": "pass", "status": "ditulis operator"}
+	vars := BranchVars(payload, "completed")
+	if vars["status"] != "completed" || vars["qc_result"] != "pass" {
+		t.Fatalf("BranchVars = %v", vars)
+	}
+	if payload["status"] != "ditulis operator" {
+		t.Fatal("BranchVars mengubah payload asli")
+	}
+}
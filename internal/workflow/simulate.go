@@ -0,0 +1,180 @@
+package workflow
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SimulationInput adalah skenario dry-run sebuah workflow
+type SimulationInput struct {
+	// StartNode adalah stage awal; kosong berarti semua entry node
+	StartNode string `json:"start_node"`
+	// Payloads adalah contoh data_payload per node stage untuk mengevaluasi condition percabangan
+	Payloads map[string]map[string]interface{} `json:"payloads"`
+}
+
+// SimulationStep adalah satu stage yang dilewati dalam simulasi
+type SimulationStep struct {
+	NodeID     string `json:"node_id"`
+	Label      string `json:"label"`
+	TemplateID int    `json:"template_id"`
+	From       string `json:"from,omitempty"`
+	Duration   int    `json:"duration_minutes"`
+	StartAt    int    `json:"start_at_minutes"`
+	EndAt      int    `json:"end_at_minutes"`
+}
+
+// SimulationResult adalah laporan dry-run: jalur yang dilalui, total lead time dan bottleneck
+type SimulationResult struct {
+	Path          []SimulationStep `json:"path"`
+	TotalLeadTime int              `json:"total_lead_time_minutes"`
+	Bottlenecks   []SimulationStep `json:"bottlenecks"`
+	ReachedEnd    bool             `json:"reached_end"`
+	Warnings      []string         `json:"warnings"`
+}
+
+// maxSimulationSteps mencegah simulasi berputar tanpa akhir di workflow yang punya loop
+const maxSimulationSteps = 500
+
+// Simulate menelusuri graf tanpa menyentuh database. durations berisi estimated_duration
+// (menit) per template_id; stage tanpa estimasi dihitung 0 menit dan diberi peringatan.
+// Setiap stage hanya dikunjungi sekali, jadi loop rework dilaporkan sebagai peringatan.
+// Percabangan dievaluasi memakai input.Payloads; cabang yang tidak bisa ditentukan
+// menghentikan jalur tersebut dengan peringatan.
+func Simulate(g *Graph, durations map[int]int, input SimulationInput) (*SimulationResult, error) {
+	result := &SimulationResult{Path: []SimulationStep{}, Bottlenecks: []SimulationStep{}, Warnings: []string{}}
+
+	var entries []*Node
+	if input.StartNode != "" {
+		n := g.Node(input.StartNode)
+		if n == nil || n.Kind() != NodeStage {
+			return nil, fmt.Errorf("start_node '%s' bukan stage di workflow ini", input.StartNode)
+		}
+		entries = []*Node{n}
+	} else {
+		entries = g.EntryNodes()
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("workflow tidak punya entry node")
+	}
+
+	// pending adalah stage yang siap dikerjakan, atau cabang yang tiba di join (arrival != nil)
+	type pending struct {
+		node    *Node
+		from    string
+		readyAt int
+		arrival *Arrival
+	}
+	// Engine hanya memajukan workflow saat instance completed
+	const status = "completed"
+	queue := make([]pending, 0, len(entries))
+	for _, n := range entries {
+		queue = append(queue, pending{node: n})
+	}
+	visited := map[string]bool{}
+	warnedDuration := map[int]bool{}
+	joined := map[string]map[string]bool{} // join id -> edge masuk yang sudah tiba
+	released := map[string]bool{}
+
+	// proceed menelusuri edge keluar dari node yang selesai dan mengantrekan hasilnya
+	proceed := func(from *Node, vars map[string]interface{}, readyAt int) {
+		w, err := g.traverse([]string{from.ID}, func(id string) ([]Edge, error) {
+			return g.branch(id, vars)
+		})
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("alur berhenti di '%s': %v", nodeName(from), err))
+			return
+		}
+		if w.reachedEnd {
+			result.ReachedEnd = true
+		}
+		if len(w.stages) == 0 && len(w.arrivals) == 0 && !w.reachedEnd {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("alur berhenti di '%s' tanpa mencapai end", nodeName(from)))
+		}
+		for _, n := range w.stages {
+			queue = append(queue, pending{node: n, from: from.ID, readyAt: readyAt})
+		}
+		for i := range w.arrivals {
+			queue = append(queue, pending{node: w.arrivals[i].Join, from: from.ID, readyAt: readyAt, arrival: &w.arrivals[i]})
+		}
+	}
+
+	for len(queue) > 0 {
+		if len(result.Path) >= maxSimulationSteps {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("simulasi dihentikan setelah %d langkah", maxSimulationSteps))
+			break
+		}
+		// Proses stage yang paling cepat siap dulu supaya urutan path mengikuti waktu
+		sort.SliceStable(queue, func(i, j int) bool { return queue[i].readyAt < queue[j].readyAt })
+		cur := queue[0]
+		queue = queue[1:]
+
+		// Join dilepas saat cabang ke-N tiba; karena antrean urut waktu, itulah waktu mulai tahap berikutnya
+		if cur.arrival != nil {
+			id := cur.node.ID
+			if released[id] {
+				continue
+			}
+			if joined[id] == nil {
+				joined[id] = map[string]bool{}
+			}
+			joined[id][cur.arrival.EdgeKey] = true
+			if len(joined[id]) >= g.JoinQuorum(id) {
+				released[id] = true
+				proceed(cur.node, BranchVars(nil, status), cur.readyAt)
+			}
+			continue
+		}
+
+		if visited[cur.node.ID] {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("stage '%s' dicapai lagi dari '%s' (loop), tidak disimulasikan ulang", nodeName(cur.node), cur.from))
+			continue
+		}
+		visited[cur.node.ID] = true
+
+		duration, ok := durations[cur.node.Data.TemplateID]
+		if !ok && !warnedDuration[cur.node.Data.TemplateID] {
+			warnedDuration[cur.node.Data.TemplateID] = true
+			result.Warnings = append(result.Warnings, fmt.Sprintf("template %d (stage '%s') belum punya estimated_duration", cur.node.Data.TemplateID, nodeName(cur.node)))
+		}
+		step := SimulationStep{
+			NodeID:     cur.node.ID,
+			Label:      nodeName(cur.node),
+			TemplateID: cur.node.Data.TemplateID,
+			From:       cur.from,
+			Duration:   duration,
+			StartAt:    cur.readyAt,
+			EndAt:      cur.readyAt + duration,
+		}
+		result.Path = append(result.Path, step)
+		if step.EndAt > result.TotalLeadTime {
+			result.TotalLeadTime = step.EndAt
+		}
+
+		proceed(cur.node, BranchVars(input.Payloads[cur.node.ID], status), step.EndAt)
+	}
+
+	for _, n := range g.Nodes() {
+		if n.Kind() == NodeJoin && len(joined[n.ID]) > 0 && !released[n.ID] {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("join '%s' masih menunggu: %d dari %d cabang selesai", nodeName(n), len(joined[n.ID]), g.JoinQuorum(n.ID)))
+		}
+	}
+
+	result.Bottlenecks = bottlenecks(result.Path)
+	return result, nil
+}
+
+// bottlenecks mengambil stage dengan durasi terpanjang (maksimal 3) yang durasinya di atas nol
+func bottlenecks(path []SimulationStep) []SimulationStep {
+	sorted := make([]SimulationStep, 0, len(path))
+	for _, s := range path {
+		if s.Duration > 0 {
+			sorted = append(sorted, s)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Duration > sorted[j].Duration })
+	if len(sorted) > 3 {
+		sorted = sorted[:3]
+	}
+	return sorted
+}
@@ -0,0 +1,195 @@
+package workflow
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	// Durasi per template: mix 30, oven 90, rework 45, scrap 5
+	durations := map[int]int{1: 30, 2: 90, 3: 45, 4: 5}
+	tests := []struct {
+		name       string
+		canvas     string
+		durations  map[int]int
+		input      SimulationInput
+		path       []string // node id sesuai urutan
+		leadTime   int
+		reachedEnd bool
+		warnings   []string // potongan pesan, sesuai urutan
+	}{
+		{"lolos QC sampai end", qcCanvas, durations,
+			SimulationInput{Payloads: map[string]map[string]interface{}{"mix": {"qc_result": "pass"}}},
+			[]string{"mix", "oven"}, 120, true, nil},
+		{"gagal QC lalu rework kembali ke mix", qcCanvas, durations,
+			SimulationInput{Payloads: map[string]map[string]interface{}{"mix": {"qc_result": "fail"}}},
+			[]string{"mix", "rework"}, 75, false, []string{"stage 'Mixing' dicapai lagi dari 'rework' (loop)"}},
+		{"mulai dari stage tertentu", qcCanvas, durations,
+			SimulationInput{StartNode: "oven"},
+			[]string{"oven"}, 90, true, nil},
+		{"durasi belum diisi", qcCanvas, map[int]int{1: 30},
+			SimulationInput{Payloads: map[string]map[string]interface{}{"mix": {"qc_result": "scrap"}}},
+			[]string{"mix", "scrap"}, 30, true, []string{"template 4 (stage 'Scrap') belum punya estimated_duration"}},
+		{"tidak ada cabang yang cocok", `{
+			"nodes": [{"id": "a", "data": {"label": "A", "template_id": 1}}, {"id": "b", "data": {"template_id": 2}}],
+			"edges": [{"source": "a", "target": "b", "data": {"condition": "ok == true"}}]
+		}`, durations, SimulationInput{},
+			[]string{"a"}, 30, false, []string{"alur berhenti di 'A': no matching workflow branch"}},
+		{"tanpa start memakai stage tanpa panah masuk", `{
+			"nodes": [{"id": "a", "data": {"template_id": 1}}, {"id": "b", "data": {"template_id": 2}}, {"id": "z", "type": "end"}],
+			"edges": [{"source": "a", "target": "b"}, {"source": "b", "target": "z"}]
+		}`, durations, SimulationInput{},
+			[]string{"a", "b"}, 120, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Simulate(mustParse(t, tt.canvas), tt.durations, tt.input)
+			if err != nil {
+				t.Fatalf("Simulate: %v", err)
+			}
+			var path []string
+			for _, s := range res.Path {
+				path = append(path, s.NodeID)
+			}
+			if !reflect.DeepEqual(path, tt.path) {
+				t.Errorf("path = %v, want %v", path, tt.path)
+			}
+			if res.TotalLeadTime != tt.leadTime || res.ReachedEnd != tt.reachedEnd {
+				t.Errorf("lead time = %d, reached end = %v, want %d, %v", res.TotalLeadTime, res.ReachedEnd, tt.leadTime, tt.reachedEnd)
+			}
+			if len(res.Warnings) != len(tt.warnings) {
+				t.Fatalf("warnings = %q, want %q", res.Warnings, tt.warnings)
+			}
+			for i, w := range tt.warnings {
+				if !strings.Contains(res.Warnings[i], w) {
+					t.Errorf("warnings[%d] = %q, want memuat %q", i, res.Warnings[i], w)
+				}
+			}
+		})
+	}
+}
+
+func TestSimulateTiming(t *testing.T) {
+	res, err := Simulate(mustParse(t, qcCanvas), map[int]int{1: 30, 2: 90}, SimulationInput{
+		Payloads: map[string]map[string]interface{}{"mix": {"qc_result": "pass"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SimulationStep{
+		{NodeID: "mix", Label: "Mixing", TemplateID: 1, Duration: 30, StartAt: 0, EndAt: 30},
+		{NodeID: "oven", Label: "Oven", TemplateID: 2, From: "mix", Duration: 90, StartAt: 30, EndAt: 120},
+	}
+	if !reflect.DeepEqual(res.Path, want) {
+		t.Fatalf("path = %+v, want %+v", res.Path, want)
+	}
+}
+
+func TestSimulateForkJoin(t *testing.T) {
+	canvas := func(required int) string {
+		return fmt.Sprintf(`{
+			"nodes": [
+				{"id": "s", "type": "start"},
+				{"id": "mix", "data": {"label": "Mixing", "template_id": 1}},
+				{"id": "f", "type": "fork"},
+				{"id": "oven", "data": {"label": "Oven", "template_id": 2}},
+				{"id": "lab", "data": {"label": "Lab", "template_id": 3}},
+				{"id": "j", "type": "join", "data": {"label": "Gabung", "required": %d}},
+				{"id": "pack", "data": {"label": "Packing", "template_id": 4}},
+				{"id": "e", "type": "end"}
+			],
+			"edges": [
+				{"source": "s", "target": "mix"}, {"source": "mix", "target": "f"},
+				{"source": "f", "target": "oven"}, {"source": "f", "target": "lab"},
+				{"id": "jo", "source": "oven", "target": "j"}, {"id": "jl", "source": "lab", "target": "j"},
+				{"source": "j", "target": "pack"}, {"source": "pack", "target": "e"}
+			]
+		}`, required)
+	}
+	durations := map[int]int{1: 30, 2: 90, 3: 20, 4: 10}
+	tests := []struct {
+		name     string
+		required int
+		path     []string
+		leadTime int
+	}{
+		// Packing menunggu oven (cabang terlama) selesai di menit 120
+		{"menunggu semua cabang", 0, []string{"mix@0", "lab@30", "oven@30", "pack@120"}, 130},
+		// Packing mulai begitu lab selesai di menit 50; oven tetap berjalan sampai 120
+		{"menunggu satu cabang", 1, []string{"mix@0", "lab@30", "oven@30", "pack@50"}, 120},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Simulate(mustParse(t, canvas(tt.required)), durations, SimulationInput{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var path []string
+			for _, s := range res.Path {
+				path = append(path, fmt.Sprintf("%s@%d", s.NodeID, s.StartAt))
+			}
+			sort.Strings(path[1:3]) // oven dan lab mulai bersamaan
+			if !reflect.DeepEqual(path, tt.path) {
+				t.Errorf("path = %v, want %v", path, tt.path)
+			}
+			if res.TotalLeadTime != tt.leadTime || !res.ReachedEnd || len(res.Warnings) != 0 {
+				t.Errorf("lead time = %d, reached end = %v, warnings = %q", res.TotalLeadTime, res.ReachedEnd, res.Warnings)
+			}
+		})
+	}
+
+	// Join yang tidak pernah lengkap dilaporkan
+	g := mustParse(t, canvas(0))
+	res, err := Simulate(g, durations, SimulationInput{StartNode: "oven"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "join 'Gabung' masih menunggu: 1 dari 2 cabang") {
+		t.Fatalf("warnings = %q", res.Warnings)
+	}
+}
+
+func TestSimulateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		canvas  string
+		start   string
+		wantErr string
+	}{
+		{"start_node tidak ada", qcCanvas, "packing", "start_node 'packing' bukan stage"},
+		{"start_node bukan stage", qcCanvas, "end", "start_node 'end' bukan stage"},
+		{"tanpa entry node", `{"nodes": [{"id": "s", "type": "start"}, {"id": "e", "type": "end"}],
+			"edges": [{"source": "s", "target": "e"}]}`, "", "tidak punya entry node"},
+	}
+	for _, tt := range tests {
+		_, err := Simulate(mustParse(t, tt.canvas), nil, SimulationInput{StartNode: tt.start})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want memuat %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBottlenecks(t *testing.T) {
+	path := []SimulationStep{
+		{NodeID: "a", Duration: 10},
+		{NodeID: "b", Duration: 0},
+		{NodeID: "c", Duration: 60},
+		{NodeID: "d", Duration: 30},
+		{NodeID: "e", Duration: 60},
+		{NodeID: "f", Duration: 5},
+	}
+	var got []string
+	for _, s := range bottlenecks(path) {
+		got = append(got, s.NodeID)
+	}
+	// Durasi sama mempertahankan urutan path; stage 0 menit tidak pernah menjadi bottleneck
+	if want := []string{"c", "e", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("bottlenecks = %v, want %v", got, want)
+	}
+	if got := bottlenecks([]SimulationStep{{NodeID: "x"}}); len(got) != 0 {
+		t.Fatalf("bottlenecks tanpa durasi = %v", got)
+	}
+}